@@ -14,6 +14,7 @@ import (
 	"yaprakticum-go-track2/internal/config"
 	gserver "yaprakticum-go-track2/internal/grpcimp/server"
 	"yaprakticum-go-track2/internal/handlers"
+	"yaprakticum-go-track2/internal/ingest"
 	"yaprakticum-go-track2/internal/prom"
 	"yaprakticum-go-track2/internal/prom/promserver"
 	"yaprakticum-go-track2/internal/shared"
@@ -52,13 +53,23 @@ func DumpDBFile(ctx context.Context, args config.ServerConfig, dataStorage *stor
 func main() {
 	fmt.Printf("Metrics Server\nBuild version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(context.Background(), os.Args[2:], os.Stdout))
+	}
+
 	cfg := config.ServerConfig{}
 	args := cfg.Load()
+	// Ingest options are checked separately, as config package doesn't depend on their parsers
+	if err := ingest.CheckConfig(args); err != nil {
+		panic("invalid configuration: " + err.Error())
+	}
 	logger, err := zap.NewDevelopment()
 	if err != nil {
 		panic(err)
 	}
 
+	shared.Logger = logger
+
 	var parentContext context.Context = context.Background()
 	dataStorage, err := storage.InitStorage(parentContext, args, logger)
 	if err != nil {
@@ -66,15 +77,13 @@ func main() {
 	}
 	defer dataStorage.Close(parentContext)
 
-	shared.Logger = logger
-
 	go DumpDBFile(parentContext, args, dataStorage, logger)
 
 	// Prom Start
 	server := http.Server{Addr: args.Endp,
 		Handler: handlers.Router(handlers.NewHandlers(dataStorage, cfg),
 			prom.NewCustomPromMetrics())}
-	serverProm := promserver.NewServer(args.EndpProm, logger)
+	serverProm := promserver.NewServer(args.EndpProm, dataStorage, args.TenantKeys, logger)
 	if args.EndpProm != "" {
 		serverProm.ListenAndServeAsync()
 	}
@@ -85,7 +94,19 @@ func main() {
 		gRPCserver.ListenAndServeAsync()
 	}
 
-	go catchSignal(parentContext, []ShutdownerCtx{&server, serverProm, gRPCserver}, dataStorage, logger)
+	// StatsD start
+	statsDServer := ingest.NewStatsDServer(dataStorage, args, logger)
+	if args.StatsDAddress != "" {
+		statsDServer.ListenAndServeAsync()
+	}
+
+	// Graphite start
+	graphiteServer := ingest.NewGraphiteServer(dataStorage, args, logger)
+	if args.GraphiteAddress != "" {
+		graphiteServer.ListenAndServeAsync()
+	}
+
+	go catchSignal(parentContext, []ShutdownerCtx{&server, serverProm, gRPCserver, statsDServer, graphiteServer}, dataStorage, logger)
 
 	// HTTP server start
 	logger.Info("Server running at " + args.Endp)
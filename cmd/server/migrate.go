@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"yaprakticum-go-track2/internal/storage/dbstore"
+)
+
+const migrateUsage = `Usage: server migrate [-d DSN] up|down [steps]|status
+  up      apply all pending migrations
+  down    roll back last applied migrations (1 by default)
+  status  list migrations with their state
+DSN is taken from DATABASE_DSN environment variable if -d is not provided`
+
+// Runs `migrate` command with its arguments, returns process exit code
+func runMigrateCommand(ctx context.Context, args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprintln(out, migrateUsage) }
+	dsn := fs.String("d", os.Getenv("DATABASE_DSN"), "DB Connection string")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || *dsn == "" {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := sql.Open("pgx", *dsn)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to connect to database: %s\n", err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	err = migrate(ctx, db, fs.Args(), out)
+	if err != nil {
+		fmt.Fprintln(out, err.Error())
+		return 1
+	}
+	return 0
+}
+
+func migrate(ctx context.Context, db *sql.DB, args []string, out io.Writer) error {
+	switch args[0] {
+	case "up":
+		n, err := dbstore.MigrateUp(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Applied %d migrations\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New("number of steps must be positive integer")
+			}
+		}
+		n, err := dbstore.MigrateDown(ctx, db, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rolled back %d migrations\n", n)
+	case "status":
+		states, err := dbstore.MigrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, st := range states {
+			applied := "pending"
+			if st.Applied {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
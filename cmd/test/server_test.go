@@ -2,17 +2,22 @@ package test
 
 import (
 	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 	"yaprakticum-go-track2/internal/config"
 	"yaprakticum-go-track2/internal/handlers"
 	"yaprakticum-go-track2/internal/prom"
 	"yaprakticum-go-track2/internal/shared"
 	"yaprakticum-go-track2/internal/storage"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
 var once sync.Once
@@ -42,8 +47,17 @@ func performTest(t *testing.T, db *storage.Storage) {
 		{testName: "No type", method: http.MethodPost, url: "/update/", wantStatusCode: http.StatusBadRequest, wantKv: nil},
 		{testName: "Initializing counter testVal", method: http.MethodPost, url: "/update/counter/testVal/1", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "counter", key: "testVal", value: int64(1)}}},
 		{testName: "Adding value to existing counter testVal", method: http.MethodPost, url: "/update/counter/testVal/2", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "counter", key: "testVal", value: int64(3)}}},
-		{testName: "Initializing gauge testVal", method: http.MethodPost, url: "/update/gauge/testVal/1", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "gauge", key: "testVal", value: float64(1)}}},
-		{testName: "Setting value to existing gauge testVal", method: http.MethodPost, url: "/update/gauge/testVal/2", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "gauge", key: "testVal", value: float64(2)}}},
+		{testName: "Writing counter testVal as gauge", method: http.MethodPost, url: "/update/gauge/testVal/1", wantStatusCode: http.StatusConflict, wantKv: []kv{{typ: "counter", key: "testVal", value: int64(3)}}},
+		{testName: "Initializing gauge testGauge", method: http.MethodPost, url: "/update/gauge/testGauge/1", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "gauge", key: "testGauge", value: float64(1)}}},
+		{testName: "Setting value to existing gauge testGauge", method: http.MethodPost, url: "/update/gauge/testGauge/2", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "gauge", key: "testGauge", value: float64(2)}}},
+		{testName: "Deleting not existing gauge", method: http.MethodDelete, url: "/value/gauge/noVal", wantStatusCode: http.StatusNotFound, wantKv: nil},
+		{testName: "Deleting metric of unknown type", method: http.MethodDelete, url: "/value/gaugge/testGauge", wantStatusCode: http.StatusBadRequest, wantKv: nil},
+		{testName: "Initializing labeled gauge testGauge", method: http.MethodPost, url: "/update/gauge/testGauge/3?host=a", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "gauge", key: `testGauge{host="a"}`, value: float64(3)}, {typ: "gauge", key: "testGauge", value: float64(2)}}},
+		{testName: "Deleting labeled gauge testGauge", method: http.MethodDelete, url: "/value/gauge/testGauge?host=a", wantStatusCode: http.StatusOK, wantKv: []kv{{typ: "gauge", key: `testGauge{host="a"}`, value: nil}, {typ: "gauge", key: "testGauge", value: float64(2)}}},
+		{testName: "Reading metadata", method: http.MethodGet, url: "/metadata?name=testGauge", wantStatusCode: http.StatusOK, wantKv: nil},
+		{testName: "Reading metadata of unknown metric", method: http.MethodGet, url: "/metadata?name=noVal", wantStatusCode: http.StatusNotFound, wantKv: nil},
+		{testName: "Querying range of gauge", method: http.MethodGet, url: "/api/v1/query_range?metric=testGauge&step=30s&agg=max", wantStatusCode: http.StatusOK, wantKv: nil},
+		{testName: "Querying range with unknown aggregation", method: http.MethodGet, url: "/api/v1/query_range?metric=testGauge&agg=median", wantStatusCode: http.StatusBadRequest, wantKv: nil},
 	}
 
 	ctx := context.Background()
@@ -69,6 +83,10 @@ func performTest(t *testing.T, db *storage.Storage) {
 			if tt.method == http.MethodGet {
 				res, _ = srv.Client().Get(srv.URL + tt.url)
 				res.Body.Close()
+			} else if tt.method == http.MethodDelete {
+				r, _ := http.NewRequest(http.MethodDelete, srv.URL+tt.url, nil)
+				res, _ = srv.Client().Do(r)
+				res.Body.Close()
 			} else {
 				res, _ = srv.Client().Post(srv.URL+tt.url, "text/plain", nil)
 				res.Body.Close()
@@ -80,6 +98,10 @@ func performTest(t *testing.T, db *storage.Storage) {
 				switch v.typ {
 				case "gauge":
 					val, _ := db.GetGauges().ReadData(ctx, v.key)
+					if v.value == nil {
+						assert.NotContains(t, val, v.key)
+						continue
+					}
 					assert.Equal(t, v.value, val[v.key])
 				case "counter":
 					val, _ := db.GetCounters().ReadData(ctx, v.key)
@@ -98,6 +120,78 @@ func TestInMemory(t *testing.T) {
 	performTest(t, db)
 }
 
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	z, _ := zap.NewDevelopment()
+	shared.Logger = z
+	cfg := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "metrics.json"), TenantKeys: map[string]string{"key-a": "team_a"}}
+	db, _ := storage.InitStorage(ctx, cfg, z)
+	defer db.Close(ctx)
+
+	once.Do(func() {
+		cpm = prom.NewCustomPromMetrics()
+	})
+	srv := httptest.NewServer(handlers.Router(handlers.NewHandlers(db, cfg), cpm))
+	defer srv.Close()
+
+	post := func(url string, key string) int {
+		r, _ := http.NewRequest(http.MethodPost, srv.URL+url, nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		res, err := srv.Client().Do(r)
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, post("/update/counter/c/1", "key-a"))
+	assert.Equal(t, http.StatusOK, post("/update/counter/c/5", ""))
+	assert.Equal(t, http.StatusUnauthorized, post("/update/counter/c/1", "unknown"))
+
+	val, _ := db.GetCounters().ReadData(storagecommons.WithTenant(ctx, "team_a"), "c")
+	assert.Equal(t, int64(1), val["c"])
+	val, _ = db.GetCounters().ReadData(ctx, "c")
+	assert.Equal(t, int64(5), val["c"])
+}
+
+func TestInfluxWrite(t *testing.T) {
+	ctx := context.Background()
+	z, _ := zap.NewDevelopment()
+	shared.Logger = z
+	cfg := config.ServerConfig{InfluxIntRules: []string{"net_bytes_*=counter", "errors=delta"}}
+	db, _ := storage.InitStorage(ctx, cfg, z)
+	defer db.Close(ctx)
+
+	once.Do(func() {
+		cpm = prom.NewCustomPromMetrics()
+	})
+	srv := httptest.NewServer(handlers.Router(handlers.NewHandlers(db, cfg), cpm))
+	defer srv.Close()
+
+	write := func(body string, query string) int {
+		res, err := srv.Client().Post(srv.URL+"/write"+query, "text/plain", strings.NewReader(body))
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	now := time.Now()
+	assert.Equal(t, http.StatusNoContent, write(fmt.Sprintf("net,host=a bytes_sent=100i,up=true %d\nerrors value=2i\ncpu,host=a usage=0.5,procs=12i", now.UnixNano()), ""))
+	assert.Equal(t, http.StatusNoContent, write(fmt.Sprintf("net,host=a bytes_sent=150i %d\nerrors value=3i", now.Unix()+1), "?precision=s"))
+	assert.Equal(t, http.StatusBadRequest, write("cpu usage=", ""))
+	assert.Equal(t, http.StatusBadRequest, write("net,host=a bytes_sent=200i 1700000000", "?precision=s"))
+	assert.Equal(t, http.StatusBadRequest, write("cpu usage=1", "?precision=d"))
+
+	counters, _ := db.GetCounters().ReadData(ctx)
+	assert.Equal(t, int64(150), counters[`net_bytes_sent{host="a"}`])
+	assert.Equal(t, int64(5), counters["errors"])
+	gauges, _ := db.GetGauges().ReadData(ctx)
+	assert.Equal(t, 1.0, gauges[`net_up{host="a"}`])
+	assert.Equal(t, 0.5, gauges[`cpu_usage{host="a"}`])
+	assert.Equal(t, 12.0, gauges[`cpu_procs{host="a"}`])
+}
+
 // To complete github test2B
 /*func TestPostgres(t *testing.T) {
 	postgres, err := testhelpers.NewPostgresContainer()
@@ -22,6 +22,8 @@ type ClientConfig struct {
 	UseRSA         bool
 	RSAPublicKey   rsa.PublicKey
 	RealIP         net.IP
+	Labels         map[string]string
+	APIKey         string
 }
 
 // Raw Agent configuration with possible null fields
@@ -34,15 +36,19 @@ type clientConfigNull struct {
 	ReportInterval   *time.Duration
 	UseRSA           *bool
 	RSAPublicKeyFile *string
+	Labels           *map[string]string
+	APIKey           *string
 	ConfigFile       *string
 }
 
 // Representation of JSON config file
 type ClientConfigFile struct {
-	Address        *string `json:"address,omitempty"`
-	ReportInterval *string `json:"report_interval,omitempty"`
-	PollInterval   *string `json:"poll_interval,omitempty"`
-	CryptoKey      *string `json:"crypto_key,omitempty"`
+	Address        *string            `json:"address,omitempty"`
+	ReportInterval *string            `json:"report_interval,omitempty"`
+	PollInterval   *string            `json:"poll_interval,omitempty"`
+	CryptoKey      *string            `json:"crypto_key,omitempty"`
+	Labels         *map[string]string `json:"labels,omitempty"`
+	APIKey         *string            `json:"api_key,omitempty"`
 }
 
 // Parses Agent configuration from Command Line args
@@ -55,6 +61,8 @@ func getClientConfigFromCLArgs() clientConfigNull {
 	key := flag.String("k", "", "Key")
 	rateLimit := flag.Int64("l", 5, "Limit of simultaneous requests")
 	rsakey := flag.String("crypto-key", "", "RSA public key file name")
+	labels := flag.String("labels", "", "Labels attached to all metrics: name=value,...")
+	apiKey := flag.String("api-key", "", "API key identifying tenant on server")
 	configFile := flag.String("c", "", "Config file")
 	flag.StringVar(configFile, "config", "", "Config file")
 	flag.Parse()
@@ -68,6 +76,8 @@ func getClientConfigFromCLArgs() clientConfigNull {
 	clientConfig.Key = getParWithSetCheck(*key, slices.Contains(usedFlags, "k"))
 	clientConfig.ReqLimit = getParWithSetCheck(*rateLimit, slices.Contains(usedFlags, "l"))
 	clientConfig.RSAPublicKeyFile = getParWithSetCheck(*rsakey, slices.Contains(usedFlags, "crypto-key") || slices.Contains(usedFlags, "c"))
+	clientConfig.Labels = getParWithSetCheck(parseLabels(*labels), slices.Contains(usedFlags, "labels"))
+	clientConfig.APIKey = getParWithSetCheck(*apiKey, slices.Contains(usedFlags, "api-key"))
 	clientConfig.ConfigFile = getParWithSetCheck(*configFile, slices.Contains(usedFlags, "c") || slices.Contains(usedFlags, "config"))
 
 	return clientConfig
@@ -83,6 +93,8 @@ func getClientConfigFromEnvVar() clientConfigNull {
 	key := envflag.String("KEY", "", "Key")
 	rateLimit := envflag.Int64("RATE_LIMIT", 5, "Limit of simultaneous requests")
 	rsakey := envflag.String("CRYPTO_KEY", "", "RSA public key file name")
+	labels := envflag.String("LABELS", "", "Labels attached to all metrics: name=value,...")
+	apiKey := envflag.String("API_KEY", "", "API key identifying tenant on server")
 	configFile := envflag.String("CONFIG", "", "Config file")
 	envflag.Parse()
 
@@ -95,6 +107,8 @@ func getClientConfigFromEnvVar() clientConfigNull {
 	clientConfig.Key = getParWithSetCheck[string](*key, slices.Contains(usedFlags, "KEY"))
 	clientConfig.ReqLimit = getParWithSetCheck[int64](*rateLimit, slices.Contains(usedFlags, "RATE_LIMIT"))
 	clientConfig.RSAPublicKeyFile = getParWithSetCheck[string](*rsakey, slices.Contains(usedFlags, "CRYPTO_KEY"))
+	clientConfig.Labels = getParWithSetCheck(parseLabels(*labels), slices.Contains(usedFlags, "LABELS"))
+	clientConfig.APIKey = getParWithSetCheck(*apiKey, slices.Contains(usedFlags, "API_KEY"))
 	clientConfig.ConfigFile = getParWithSetCheck[string](*configFile, slices.Contains(usedFlags, "CONFIG"))
 
 	return clientConfig
@@ -125,6 +139,8 @@ func getClientConfigFromJSON(filename string) clientConfigNull {
 	clientConfig.Key = nil
 	clientConfig.ReqLimit = nil
 	clientConfig.RSAPublicKeyFile = ccf.CryptoKey
+	clientConfig.Labels = ccf.Labels
+	clientConfig.APIKey = ccf.APIKey
 	clientConfig.ConfigFile = nil
 
 	return clientConfig
@@ -150,6 +166,8 @@ func CombineClientConfigs(configs ...clientConfigNull) ClientConfig {
 		combineParameter(&clientConfig.ReportInterval, cfg.ReportInterval)
 		combineParameter(&clientConfig.ReqLimit, cfg.ReqLimit)
 		combineParameter(&clientConfig.Key, cfg.Key)
+		combineParameter(&clientConfig.Labels, cfg.Labels)
+		combineParameter(&clientConfig.APIKey, cfg.APIKey)
 		var (
 			rsaUse bool
 			rsaKey rsa.PublicKey
@@ -8,6 +8,9 @@ import (
 	"flag"
 	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -48,6 +51,51 @@ func combineParameter[S any](dst *S, src *S) {
 	*dst = *src
 }
 
+// Parses labels from "name=value,name2=value2" string representation
+func parseLabels(sRepr string) map[string]string {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(sRepr, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			continue
+		}
+		res[name] = strings.TrimSpace(value)
+	}
+	return res
+}
+
+// Parses list of non-empty items from "item1,item2,..." string representation
+func parseList(sRepr string) []string {
+	return parseListSep(sRepr, ",")
+}
+
+// Parses list of non-empty items separated by sep
+func parseListSep(sRepr string, sep string) []string {
+	res := make([]string, 0)
+	for _, item := range strings.Split(sRepr, sep) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Parses sorted list of numbers from "n1,n2,..." string representation
+func parseFloatList(sRepr string) []float64 {
+	res := make([]float64, 0)
+	for _, item := range strings.Split(sRepr, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, v)
+	}
+	slices.Sort(res)
+	return res
+}
+
 // Returns RSA Private Key object stored in file
 func getRSAPrivateKey(filename string) (PK rsa.PrivateKey, UseRSA bool) {
 	var key rsa.PrivateKey
@@ -26,6 +26,29 @@ type ServerConfig struct {
 	RSAPrivateKey       rsa.PrivateKey
 	BandwidthPriority   bool
 	CachedWriteInterval time.Duration
+	RetentionRaw        time.Duration
+	RetentionMinute     time.Duration
+	RetentionHour       time.Duration
+	CompactionInterval  time.Duration
+	HistogramBuckets    []float64
+	SummaryAccuracy     float64
+	MetricTTL           time.Duration
+	TTLCheckInterval    time.Duration
+	SnapshotsKeep       int
+	DumpCompression     string
+	TenantKeys          map[string]string
+	ReadCacheSize       int
+	Replicas            []string
+	Follower            bool
+	TieredFlushInterval time.Duration
+	InfluxIntRules      []string
+	StatsDAddress       string
+	StatsDFlushInterval time.Duration
+	StatsDTimers        string
+	StatsDTimerBuckets  []float64
+	GraphiteAddress     string
+	GraphiteTemplates   []string
+	NoHistory           bool // Memory storage doesn't record samples (set for memory tier of tiered storage)
 }
 
 // Raw server configuration with possible null fields
@@ -42,18 +65,62 @@ type serverConfigNull struct {
 	RSAPrivateKeyFile   *string
 	BandwidthPriority   *bool
 	CachedWriteInterval *time.Duration
+	RetentionRaw        *time.Duration
+	RetentionMinute     *time.Duration
+	RetentionHour       *time.Duration
+	CompactionInterval  *time.Duration
+	HistogramBuckets    *[]float64
+	SummaryAccuracy     *float64
+	MetricTTL           *time.Duration
+	TTLCheckInterval    *time.Duration
+	SnapshotsKeep       *int
+	DumpCompression     *string
+	TenantKeys          *map[string]string
+	ReadCacheSize       *int
+	Replicas            *[]string
+	Follower            *bool
+	TieredFlushInterval *time.Duration
+	InfluxIntRules      *[]string
+	StatsDAddress       *string
+	StatsDFlushInterval *time.Duration
+	StatsDTimers        *string
+	StatsDTimerBuckets  *[]float64
+	GraphiteAddress     *string
+	GraphiteTemplates   *[]string
 	ConfigFile          *string
 }
 
 // Representation of JSON config file
 type ServerConfigFile struct {
-	Address       *string `json:"address,omitempty"`
-	Restore       *bool   `json:"restore,omitempty"`
-	StoreInterval *string `json:"store_interval,omitempty"`
-	StoreFile     *string `json:"store_file,omitempty"`
-	DatabaseDsn   *string `json:"database_dsn,omitempty"`
-	TrustedSubnet *string `json:"trusted_subnet,omitempty"`
-	CryptoKey     *string `json:"crypto_key,omitempty"`
+	Address             *string            `json:"address,omitempty"`
+	Restore             *bool              `json:"restore,omitempty"`
+	StoreInterval       *string            `json:"store_interval,omitempty"`
+	StoreFile           *string            `json:"store_file,omitempty"`
+	DatabaseDsn         *string            `json:"database_dsn,omitempty"`
+	TrustedSubnet       *string            `json:"trusted_subnet,omitempty"`
+	CryptoKey           *string            `json:"crypto_key,omitempty"`
+	RetentionRaw        *string            `json:"retention_raw,omitempty"`
+	RetentionMinute     *string            `json:"retention_minute,omitempty"`
+	RetentionHour       *string            `json:"retention_hour,omitempty"`
+	CompactionInterval  *string            `json:"compaction_interval,omitempty"`
+	HistogramBuckets    *[]float64         `json:"histogram_buckets,omitempty"`
+	SummaryAccuracy     *float64           `json:"summary_accuracy,omitempty"`
+	MetricTTL           *string            `json:"metric_ttl,omitempty"`
+	TTLCheckInterval    *string            `json:"ttl_check_interval,omitempty"`
+	SnapshotsKeep       *int               `json:"snapshots_keep,omitempty"`
+	DumpCompression     *string            `json:"dump_compression,omitempty"`
+	TenantKeys          *map[string]string `json:"tenant_keys,omitempty"`
+	ReadCacheSize       *int               `json:"read_cache_size,omitempty"`
+	Replicas            *[]string          `json:"replicas,omitempty"`
+	Follower            *bool              `json:"follower,omitempty"`
+	TieredFlushInterval *string            `json:"tiered_flush_interval,omitempty"`
+	InfluxIntRules      *[]string          `json:"influx_int_rules,omitempty"`
+	StatsDAddress       *string            `json:"statsd_address,omitempty"`
+	StatsDFlushInterval *string            `json:"statsd_flush_interval,omitempty"`
+	StatsDTimers        *string            `json:"statsd_timers,omitempty"`
+	StatsDTimerBuckets  *[]float64         `json:"statsd_timer_buckets,omitempty"`
+	GraphiteAddress     *string            `json:"graphite_address,omitempty"`
+	GraphiteTemplates   *[]string          `json:"graphite_templates,omitempty"`
 }
 
 // Parses Server configuration from Command Line args
@@ -65,11 +132,33 @@ func getServerConfigFromCLArgs() serverConfigNull {
 	storeInterval := flag.Int64("i", 300, "Store interval")
 	fileStoragePath := flag.String("f", "/tmp/metrics-db.json", "File storage path")
 	restoreData := flag.Bool("r", true, "Restore data from disc")
-	connString := flag.String("d", "", "DB Connection string")
+	connString := flag.String("d", "", "DB Connection string (bolt://<path> for embedded storage)")
 	key := flag.String("k", "", "Key")
 	trustedSubnet := flag.String("t", "", "Trusted Subnet")
 	rsakey := flag.String("crypto-key", "", "RSA private key file name")
 	cachedWriteInterval := flag.Int64("cwi", 0, "Cached write interval, ms")
+	retentionRaw := flag.Duration("retention-raw", 24*time.Hour, "Raw samples retention (0 - forever)")
+	retentionMinute := flag.Duration("retention-minute", 30*24*time.Hour, "1-minute rollups retention (0 - forever)")
+	retentionHour := flag.Duration("retention-hour", 365*24*time.Hour, "1-hour rollups retention (0 - forever)")
+	compactionInterval := flag.Duration("compaction-interval", time.Minute, "History compaction interval (0 - disabled)")
+	histogramBuckets := flag.String("histogram-buckets", "", "Default histogram bucket bounds: b1,b2,...")
+	summaryAccuracy := flag.Float64("summary-accuracy", 0.01, "Relative accuracy of summary quantiles")
+	metricTTL := flag.Duration("metric-ttl", 0, "Drop series not updated within this period (0 - never)")
+	ttlCheckInterval := flag.Duration("ttl-check-interval", time.Minute, "Expired series check interval (0 - disabled)")
+	snapshotsKeep := flag.Int("snapshots-keep", 3, "Number of kept file storage snapshots")
+	dumpCompression := flag.String("dump-compression", "gzip", "File storage snapshot compression: none, gzip or zstd")
+	tenantKeys := flag.String("tenant-keys", "", "API keys of tenants: key=tenant,...")
+	readCacheSize := flag.Int("read-cache-size", 0, "Number of DB values cached per metric type (0 - disabled, single server instance only)")
+	replicas := flag.String("replicas", "", "gRPC endpoints of follower servers to replicate writes to: host:port,...")
+	follower := flag.Bool("follower", false, "Accept writes replicated by primary server")
+	tieredFlushInterval := flag.Duration("tiered-flush-interval", 0, "Serve DB storage from memory, persisting writes with this interval (0 - disabled)")
+	influxIntRules := flag.String("influx-int-rules", "", "Kinds of metrics integer line protocol fields are written as: pattern=counter|delta|gauge,... (gauge by default)")
+	statsdAddress := flag.String("statsd-address", "", "StatsD UDP listener address:port (empty - disabled)")
+	statsdFlushInterval := flag.Duration("statsd-flush-interval", 10*time.Second, "StatsD samples aggregation interval")
+	statsdTimers := flag.String("statsd-timers", "histogram", "StatsD timers are written as: histogram or summary (gauges of statistics)")
+	statsdTimerBuckets := flag.String("statsd-timer-buckets", "", "StatsD timer histogram bucket bounds, ms: b1,b2,...")
+	graphiteAddress := flag.String("graphite-address", "", "Graphite plaintext protocol TCP listener address:port, e.g. :2003 (empty - disabled)")
+	graphiteTemplates := flag.String("graphite-templates", "", "Graphite path templates: [filter ]template[ tag=value,...];...")
 	configFile := flag.String("c", "", "Config file")
 	flag.StringVar(configFile, "config", "", "Config file")
 	flag.Parse()
@@ -87,6 +176,28 @@ func getServerConfigFromCLArgs() serverConfigNull {
 	serverConfig.Key = getParWithSetCheck(*key, slices.Contains(usedFlags, "k"))
 	serverConfig.RSAPrivateKeyFile = getParWithSetCheck(*rsakey, slices.Contains(usedFlags, "crypto-key") || slices.Contains(usedFlags, "c"))
 	serverConfig.CachedWriteInterval = getParWithSetCheck(time.Duration(*cachedWriteInterval)*time.Millisecond, slices.Contains(usedFlags, "cwi"))
+	serverConfig.RetentionRaw = getParWithSetCheck(*retentionRaw, slices.Contains(usedFlags, "retention-raw"))
+	serverConfig.RetentionMinute = getParWithSetCheck(*retentionMinute, slices.Contains(usedFlags, "retention-minute"))
+	serverConfig.RetentionHour = getParWithSetCheck(*retentionHour, slices.Contains(usedFlags, "retention-hour"))
+	serverConfig.CompactionInterval = getParWithSetCheck(*compactionInterval, slices.Contains(usedFlags, "compaction-interval"))
+	serverConfig.HistogramBuckets = getParWithSetCheck(parseFloatList(*histogramBuckets), slices.Contains(usedFlags, "histogram-buckets"))
+	serverConfig.SummaryAccuracy = getParWithSetCheck(*summaryAccuracy, slices.Contains(usedFlags, "summary-accuracy"))
+	serverConfig.MetricTTL = getParWithSetCheck(*metricTTL, slices.Contains(usedFlags, "metric-ttl"))
+	serverConfig.TTLCheckInterval = getParWithSetCheck(*ttlCheckInterval, slices.Contains(usedFlags, "ttl-check-interval"))
+	serverConfig.SnapshotsKeep = getParWithSetCheck(*snapshotsKeep, slices.Contains(usedFlags, "snapshots-keep"))
+	serverConfig.DumpCompression = getParWithSetCheck(*dumpCompression, slices.Contains(usedFlags, "dump-compression"))
+	serverConfig.TenantKeys = getParWithSetCheck(parseLabels(*tenantKeys), slices.Contains(usedFlags, "tenant-keys"))
+	serverConfig.ReadCacheSize = getParWithSetCheck(*readCacheSize, slices.Contains(usedFlags, "read-cache-size"))
+	serverConfig.Replicas = getParWithSetCheck(parseList(*replicas), slices.Contains(usedFlags, "replicas"))
+	serverConfig.Follower = getParWithSetCheck(*follower, slices.Contains(usedFlags, "follower"))
+	serverConfig.TieredFlushInterval = getParWithSetCheck(*tieredFlushInterval, slices.Contains(usedFlags, "tiered-flush-interval"))
+	serverConfig.InfluxIntRules = getParWithSetCheck(parseList(*influxIntRules), slices.Contains(usedFlags, "influx-int-rules"))
+	serverConfig.StatsDAddress = getParWithSetCheck(*statsdAddress, slices.Contains(usedFlags, "statsd-address"))
+	serverConfig.StatsDFlushInterval = getParWithSetCheck(*statsdFlushInterval, slices.Contains(usedFlags, "statsd-flush-interval"))
+	serverConfig.StatsDTimers = getParWithSetCheck(*statsdTimers, slices.Contains(usedFlags, "statsd-timers"))
+	serverConfig.StatsDTimerBuckets = getParWithSetCheck(parseFloatList(*statsdTimerBuckets), slices.Contains(usedFlags, "statsd-timer-buckets"))
+	serverConfig.GraphiteAddress = getParWithSetCheck(*graphiteAddress, slices.Contains(usedFlags, "graphite-address"))
+	serverConfig.GraphiteTemplates = getParWithSetCheck(parseListSep(*graphiteTemplates, ";"), slices.Contains(usedFlags, "graphite-templates"))
 	serverConfig.ConfigFile = getParWithSetCheck(*configFile, slices.Contains(usedFlags, "c") || slices.Contains(usedFlags, "config"))
 
 	return serverConfig
@@ -101,11 +212,33 @@ func getServerConfigFromEnvVar() serverConfigNull {
 	storeInterval := envflag.Int64("STORE_INTERVAL", 300, "Store interval")
 	fileStoragePath := envflag.String("FILE_STORAGE_PATH", "/tmp/metrics-db.json", "File storage path")
 	restoreData := envflag.Bool("RESTORE", true, "Restore data from disc")
-	connString := envflag.String("DATABASE_DSN", "", "DB Connection string")
+	connString := envflag.String("DATABASE_DSN", "", "DB Connection string (bolt://<path> for embedded storage)")
 	key := envflag.String("KEY", "", "Key")
 	trustedSubnet := envflag.String("TRUSTED_SUBNET", "", "Trusted Subnet")
 	rsakey := envflag.String("CRYPTO_KEY", "", "RSA private key file name")
 	cachedWriteInterval := envflag.Int64("CACHED_WRITE_INTERVAL", 0, "Cached write interval, ms")
+	retentionRaw := envflag.Duration("RETENTION_RAW", 24*time.Hour, "Raw samples retention (0 - forever)")
+	retentionMinute := envflag.Duration("RETENTION_MINUTE", 30*24*time.Hour, "1-minute rollups retention (0 - forever)")
+	retentionHour := envflag.Duration("RETENTION_HOUR", 365*24*time.Hour, "1-hour rollups retention (0 - forever)")
+	compactionInterval := envflag.Duration("COMPACTION_INTERVAL", time.Minute, "History compaction interval (0 - disabled)")
+	histogramBuckets := envflag.String("HISTOGRAM_BUCKETS", "", "Default histogram bucket bounds: b1,b2,...")
+	summaryAccuracy := envflag.Float64("SUMMARY_ACCURACY", 0.01, "Relative accuracy of summary quantiles")
+	metricTTL := envflag.Duration("METRIC_TTL", 0, "Drop series not updated within this period (0 - never)")
+	ttlCheckInterval := envflag.Duration("TTL_CHECK_INTERVAL", time.Minute, "Expired series check interval (0 - disabled)")
+	snapshotsKeep := envflag.Int("SNAPSHOTS_KEEP", 3, "Number of kept file storage snapshots")
+	dumpCompression := envflag.String("DUMP_COMPRESSION", "gzip", "File storage snapshot compression: none, gzip or zstd")
+	tenantKeys := envflag.String("TENANT_KEYS", "", "API keys of tenants: key=tenant,...")
+	readCacheSize := envflag.Int("READ_CACHE_SIZE", 0, "Number of DB values cached per metric type (0 - disabled, single server instance only)")
+	replicas := envflag.String("REPLICAS", "", "gRPC endpoints of follower servers to replicate writes to: host:port,...")
+	follower := envflag.Bool("FOLLOWER", false, "Accept writes replicated by primary server")
+	tieredFlushInterval := envflag.Duration("TIERED_FLUSH_INTERVAL", 0, "Serve DB storage from memory, persisting writes with this interval (0 - disabled)")
+	influxIntRules := envflag.String("INFLUX_INT_RULES", "", "Kinds of metrics integer line protocol fields are written as: pattern=counter|delta|gauge,... (gauge by default)")
+	statsdAddress := envflag.String("STATSD_ADDRESS", "", "StatsD UDP listener address:port (empty - disabled)")
+	statsdFlushInterval := envflag.Duration("STATSD_FLUSH_INTERVAL", 10*time.Second, "StatsD samples aggregation interval")
+	statsdTimers := envflag.String("STATSD_TIMERS", "histogram", "StatsD timers are written as: histogram or summary (gauges of statistics)")
+	statsdTimerBuckets := envflag.String("STATSD_TIMER_BUCKETS", "", "StatsD timer histogram bucket bounds, ms: b1,b2,...")
+	graphiteAddress := envflag.String("GRAPHITE_ADDRESS", "", "Graphite plaintext protocol TCP listener address:port, e.g. :2003 (empty - disabled)")
+	graphiteTemplates := envflag.String("GRAPHITE_TEMPLATES", "", "Graphite path templates: [filter ]template[ tag=value,...];...")
 	configFile := envflag.String("CONFIG", "", "Config file")
 	envflag.Parse()
 
@@ -122,6 +255,28 @@ func getServerConfigFromEnvVar() serverConfigNull {
 	serverConfig.Key = getParWithSetCheck(*key, slices.Contains(usedFlags, "KEY"))
 	serverConfig.RSAPrivateKeyFile = getParWithSetCheck(*rsakey, slices.Contains(usedFlags, "CRYPTO_KEY"))
 	serverConfig.CachedWriteInterval = getParWithSetCheck(time.Duration(*cachedWriteInterval)*time.Millisecond, slices.Contains(usedFlags, "cwi"))
+	serverConfig.RetentionRaw = getParWithSetCheck(*retentionRaw, slices.Contains(usedFlags, "RETENTION_RAW"))
+	serverConfig.RetentionMinute = getParWithSetCheck(*retentionMinute, slices.Contains(usedFlags, "RETENTION_MINUTE"))
+	serverConfig.RetentionHour = getParWithSetCheck(*retentionHour, slices.Contains(usedFlags, "RETENTION_HOUR"))
+	serverConfig.CompactionInterval = getParWithSetCheck(*compactionInterval, slices.Contains(usedFlags, "COMPACTION_INTERVAL"))
+	serverConfig.HistogramBuckets = getParWithSetCheck(parseFloatList(*histogramBuckets), slices.Contains(usedFlags, "HISTOGRAM_BUCKETS"))
+	serverConfig.SummaryAccuracy = getParWithSetCheck(*summaryAccuracy, slices.Contains(usedFlags, "SUMMARY_ACCURACY"))
+	serverConfig.MetricTTL = getParWithSetCheck(*metricTTL, slices.Contains(usedFlags, "METRIC_TTL"))
+	serverConfig.TTLCheckInterval = getParWithSetCheck(*ttlCheckInterval, slices.Contains(usedFlags, "TTL_CHECK_INTERVAL"))
+	serverConfig.SnapshotsKeep = getParWithSetCheck(*snapshotsKeep, slices.Contains(usedFlags, "SNAPSHOTS_KEEP"))
+	serverConfig.DumpCompression = getParWithSetCheck(*dumpCompression, slices.Contains(usedFlags, "DUMP_COMPRESSION"))
+	serverConfig.TenantKeys = getParWithSetCheck(parseLabels(*tenantKeys), slices.Contains(usedFlags, "TENANT_KEYS"))
+	serverConfig.ReadCacheSize = getParWithSetCheck(*readCacheSize, slices.Contains(usedFlags, "READ_CACHE_SIZE"))
+	serverConfig.Replicas = getParWithSetCheck(parseList(*replicas), slices.Contains(usedFlags, "REPLICAS"))
+	serverConfig.Follower = getParWithSetCheck(*follower, slices.Contains(usedFlags, "FOLLOWER"))
+	serverConfig.TieredFlushInterval = getParWithSetCheck(*tieredFlushInterval, slices.Contains(usedFlags, "TIERED_FLUSH_INTERVAL"))
+	serverConfig.InfluxIntRules = getParWithSetCheck(parseList(*influxIntRules), slices.Contains(usedFlags, "INFLUX_INT_RULES"))
+	serverConfig.StatsDAddress = getParWithSetCheck(*statsdAddress, slices.Contains(usedFlags, "STATSD_ADDRESS"))
+	serverConfig.StatsDFlushInterval = getParWithSetCheck(*statsdFlushInterval, slices.Contains(usedFlags, "STATSD_FLUSH_INTERVAL"))
+	serverConfig.StatsDTimers = getParWithSetCheck(*statsdTimers, slices.Contains(usedFlags, "STATSD_TIMERS"))
+	serverConfig.StatsDTimerBuckets = getParWithSetCheck(parseFloatList(*statsdTimerBuckets), slices.Contains(usedFlags, "STATSD_TIMER_BUCKETS"))
+	serverConfig.GraphiteAddress = getParWithSetCheck(*graphiteAddress, slices.Contains(usedFlags, "GRAPHITE_ADDRESS"))
+	serverConfig.GraphiteTemplates = getParWithSetCheck(parseListSep(*graphiteTemplates, ";"), slices.Contains(usedFlags, "GRAPHITE_TEMPLATES"))
 	serverConfig.ConfigFile = getParWithSetCheck(*configFile, slices.Contains(usedFlags, "CONFIG"))
 
 	return serverConfig
@@ -155,24 +310,59 @@ func getServerConfigFromJSON(filename string) serverConfigNull {
 	serverConfig.Key = nil
 	serverConfig.RSAPrivateKeyFile = scf.CryptoKey
 	serverConfig.CachedWriteInterval = nil
+	serverConfig.RetentionRaw = getDurationFromString(scf.RetentionRaw)
+	serverConfig.RetentionMinute = getDurationFromString(scf.RetentionMinute)
+	serverConfig.RetentionHour = getDurationFromString(scf.RetentionHour)
+	serverConfig.CompactionInterval = getDurationFromString(scf.CompactionInterval)
+	serverConfig.HistogramBuckets = scf.HistogramBuckets
+	serverConfig.SummaryAccuracy = scf.SummaryAccuracy
+	serverConfig.MetricTTL = getDurationFromString(scf.MetricTTL)
+	serverConfig.TTLCheckInterval = getDurationFromString(scf.TTLCheckInterval)
+	serverConfig.SnapshotsKeep = scf.SnapshotsKeep
+	serverConfig.DumpCompression = scf.DumpCompression
+	serverConfig.TenantKeys = scf.TenantKeys
+	serverConfig.ReadCacheSize = scf.ReadCacheSize
+	serverConfig.Replicas = scf.Replicas
+	serverConfig.Follower = scf.Follower
+	serverConfig.TieredFlushInterval = getDurationFromString(scf.TieredFlushInterval)
+	serverConfig.InfluxIntRules = scf.InfluxIntRules
+	serverConfig.StatsDAddress = scf.StatsDAddress
+	serverConfig.StatsDFlushInterval = getDurationFromString(scf.StatsDFlushInterval)
+	serverConfig.StatsDTimers = scf.StatsDTimers
+	serverConfig.StatsDTimerBuckets = scf.StatsDTimerBuckets
+	serverConfig.GraphiteAddress = scf.GraphiteAddress
+	serverConfig.GraphiteTemplates = scf.GraphiteTemplates
 
 	return serverConfig
 }
 
 func CombineServerConfigs(configs ...serverConfigNull) ServerConfig {
 	serverConfig := ServerConfig{
-		Endp:              ":8080",
-		EndpProm:          "", // 18080
-		EndpGRPC:          "", // 3200
-		FileStoragePath:   "/tmp/metrics-db.json",
-		ConnString:        "",
-		Key:               "",
-		StoreInterval:     300,
-		Restore:           true,
-		UseRSA:            false,
-		RSAPrivateKey:     rsa.PrivateKey{},
-		TrustedSubnet:     nil,
-		BandwidthPriority: false,
+		Endp:                ":8080",
+		EndpProm:            "", // 18080
+		EndpGRPC:            "", // 3200
+		FileStoragePath:     "/tmp/metrics-db.json",
+		ConnString:          "",
+		Key:                 "",
+		StoreInterval:       300,
+		Restore:             true,
+		UseRSA:              false,
+		RSAPrivateKey:       rsa.PrivateKey{},
+		TrustedSubnet:       nil,
+		BandwidthPriority:   false,
+		RetentionRaw:        24 * time.Hour,
+		RetentionMinute:     30 * 24 * time.Hour,
+		RetentionHour:       365 * 24 * time.Hour,
+		CompactionInterval:  time.Minute,
+		HistogramBuckets:    []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		SummaryAccuracy:     0.01,
+		MetricTTL:           0,
+		TTLCheckInterval:    time.Minute,
+		SnapshotsKeep:       3,
+		DumpCompression:     "gzip",
+		StatsDFlushInterval: 10 * time.Second,
+		StatsDTimers:        "histogram",
+		StatsDTimerBuckets:  []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
 	}
 
 	slices.Reverse(configs)
@@ -186,6 +376,28 @@ func CombineServerConfigs(configs ...serverConfigNull) ServerConfig {
 		combineParameter(&serverConfig.StoreInterval, cfg.StoreInterval)
 		combineParameter(&serverConfig.Restore, cfg.Restore)
 		combineParameter(&serverConfig.CachedWriteInterval, cfg.CachedWriteInterval)
+		combineParameter(&serverConfig.RetentionRaw, cfg.RetentionRaw)
+		combineParameter(&serverConfig.RetentionMinute, cfg.RetentionMinute)
+		combineParameter(&serverConfig.RetentionHour, cfg.RetentionHour)
+		combineParameter(&serverConfig.CompactionInterval, cfg.CompactionInterval)
+		combineParameter(&serverConfig.HistogramBuckets, cfg.HistogramBuckets)
+		combineParameter(&serverConfig.SummaryAccuracy, cfg.SummaryAccuracy)
+		combineParameter(&serverConfig.MetricTTL, cfg.MetricTTL)
+		combineParameter(&serverConfig.TTLCheckInterval, cfg.TTLCheckInterval)
+		combineParameter(&serverConfig.SnapshotsKeep, cfg.SnapshotsKeep)
+		combineParameter(&serverConfig.DumpCompression, cfg.DumpCompression)
+		combineParameter(&serverConfig.TenantKeys, cfg.TenantKeys)
+		combineParameter(&serverConfig.ReadCacheSize, cfg.ReadCacheSize)
+		combineParameter(&serverConfig.Replicas, cfg.Replicas)
+		combineParameter(&serverConfig.Follower, cfg.Follower)
+		combineParameter(&serverConfig.TieredFlushInterval, cfg.TieredFlushInterval)
+		combineParameter(&serverConfig.InfluxIntRules, cfg.InfluxIntRules)
+		combineParameter(&serverConfig.StatsDAddress, cfg.StatsDAddress)
+		combineParameter(&serverConfig.StatsDFlushInterval, cfg.StatsDFlushInterval)
+		combineParameter(&serverConfig.StatsDTimers, cfg.StatsDTimers)
+		combineParameter(&serverConfig.StatsDTimerBuckets, cfg.StatsDTimerBuckets)
+		combineParameter(&serverConfig.GraphiteAddress, cfg.GraphiteAddress)
+		combineParameter(&serverConfig.GraphiteTemplates, cfg.GraphiteTemplates)
 
 		// Caching
 		if cfg.CachedWriteInterval != nil && *cfg.CachedWriteInterval > time.Duration(0) {
@@ -217,6 +429,11 @@ func CombineServerConfigs(configs ...serverConfigNull) ServerConfig {
 	return serverConfig
 }
 
+// Returns configuration of gRPC client replicating writes to follower at `endp`
+func (cfg ServerConfig) ReplicaClientConfig(endp string) ClientConfig {
+	return ClientConfig{Endp: endp, Key: cfg.Key, RealIP: getPreferredIP(endp)}
+}
+
 // Parses Server configuration
 func (cfg *ServerConfig) Load() ServerConfig {
 
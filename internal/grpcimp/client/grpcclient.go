@@ -9,6 +9,7 @@ import (
 	"yaprakticum-go-track2/internal/config"
 	"yaprakticum-go-track2/internal/grpcimp"
 	"yaprakticum-go-track2/internal/grpcimp/client/middlware"
+	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
@@ -44,7 +45,7 @@ func (c *MetricsGRPCClient) Start(ctx context.Context) {
 	var err error
 	mw := middlware.GRPCClientMiddleware{Cfg: c.cfg}
 	c.conn, err = grpc.DialContext(ctx, c.cfg.Endp, grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithChainUnaryInterceptor(mw.AddAgentIP, mw.AddHMAC256))
+		grpc.WithChainUnaryInterceptor(mw.AddAgentIP, mw.AddHMAC256, mw.AddAPIKey))
 	if err != nil {
 		c.logger.Error("Failed to connect to server", zap.Error(err))
 	}
@@ -59,36 +60,7 @@ func (c *MetricsGRPCClient) Stop(ctx context.Context) error {
 
 func (c *MetricsGRPCClient) SendMetricsData(ctx context.Context, data storagecommons.MetricsDB) error {
 	// Data send
-	mdata := make([]*grpcimp.MetricData, 0)
-	for _, v := range data.MetricsDB {
-		v := v
-		typ := grpcimp.MetricData_UNSPECIFIED
-		switch v.MType {
-		case "gauge":
-			typ = grpcimp.MetricData_GAUGE
-		case "counter":
-			typ = grpcimp.MetricData_COUNTER
-		}
-		var (
-			val   float64
-			delta int64
-		)
-		if v.Delta != nil {
-			delta = *v.Delta
-		}
-		if v.Value != nil {
-			val = *v.Value
-		}
-
-		mdata = append(mdata, &grpcimp.MetricData{
-			Type:  typ,
-			Name:  v.ID,
-			Value: val,
-			Delta: delta,
-		})
-	}
-
-	_, err := c.client.UpdateMetrics(ctx, &grpcimp.UpdateMetricsRequest{Data: mdata})
+	_, err := c.client.UpdateMetrics(ctx, &grpcimp.UpdateMetricsRequest{Data: grpccommon.MetricsToData(data)})
 	if err != nil {
 		select {
 		case c.sendError <- err:
@@ -8,7 +8,6 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"yaprakticum-go-track2/internal/config"
-	"yaprakticum-go-track2/internal/grpcimp"
 	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
 )
 
@@ -21,8 +20,7 @@ func (gmw GRPCClientMiddleware) AddHMAC256(ctx context.Context, method string, r
 	opts ...grpc.CallOption) error {
 
 	if gmw.Cfg.Key != "" {
-		reqp := req.(*grpcimp.UpdateMetricsRequest)
-		b := grpccommon.MetricDataToByteSlice(reqp.Data)
+		b := grpccommon.RequestToByteSlice(req)
 
 		hmc := hmac.New(sha256.New, []byte(gmw.Cfg.Key))
 		hmc.Write(b)
@@ -42,3 +40,14 @@ func (gmw GRPCClientMiddleware) AddAgentIP(ctx context.Context, method string, r
 
 	return invoker(ctx, method, req, reply, cc, opts...)
 }
+
+func (gmw GRPCClientMiddleware) AddAPIKey(ctx context.Context, method string, req interface{},
+	reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption) error {
+
+	if gmw.Cfg.APIKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, grpccommon.APIKeyMetadata, gmw.Cfg.APIKey)
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -3,10 +3,17 @@ package grpccommon
 import (
 	"bytes"
 	"encoding/binary"
+	"google.golang.org/protobuf/proto"
 	"math"
 	"yaprakticum-go-track2/internal/grpcimp"
 )
 
+// Metadata key of API key identifying tenant
+const APIKeyMetadata = "x-api-key"
+
+// Max size of message carrying storage snapshot
+const MaxSnapshotSize = 256 << 20
+
 func float64ToByte(f float64) []byte {
 	var buf [8]byte
 	binary.BigEndian.PutUint64(buf[:], math.Float64bits(f))
@@ -40,3 +47,16 @@ func MetricDataToByteSlice(data []*grpcimp.MetricData) []byte {
 
 	return res
 }
+
+// Returns bytes of request to be signed
+func RequestToByteSlice(req interface{}) []byte {
+	switch r := req.(type) {
+	case *grpcimp.UpdateMetricsRequest:
+		return MetricDataToByteSlice(r.Data)
+	case proto.Message:
+		b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(r)
+		return b
+	default:
+		return nil
+	}
+}
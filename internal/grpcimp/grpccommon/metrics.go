@@ -0,0 +1,161 @@
+package grpccommon
+
+import (
+	"yaprakticum-go-track2/internal/grpcimp"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Returns storage name of metric type
+func MetricTypeName(t grpcimp.MetricData_Type) string {
+	switch t {
+	case grpcimp.MetricData_COUNTER:
+		return "counter"
+	case grpcimp.MetricData_GAUGE:
+		return "gauge"
+	case grpcimp.MetricData_HISTOGRAM:
+		return "histogram"
+	case grpcimp.MetricData_SUMMARY:
+		return "summary"
+	default:
+		return ""
+	}
+}
+
+// Returns metric type of storage name
+func MetricType(name string) grpcimp.MetricData_Type {
+	switch name {
+	case "gauge":
+		return grpcimp.MetricData_GAUGE
+	case "counter":
+		return grpcimp.MetricData_COUNTER
+	case "histogram":
+		return grpcimp.MetricData_HISTOGRAM
+	case "summary":
+		return grpcimp.MetricData_SUMMARY
+	default:
+		return grpcimp.MetricData_UNSPECIFIED
+	}
+}
+
+// Converts metrics batch to protobuf messages
+func MetricsToData(data storagecommons.MetricsDB) []*grpcimp.MetricData {
+	mdata := make([]*grpcimp.MetricData, 0, len(data.MetricsDB))
+	for _, v := range data.MetricsDB {
+		var (
+			val   float64
+			delta int64
+			hist  *grpcimp.Histogram
+			summ  *grpcimp.Summary
+		)
+		if v.Delta != nil {
+			delta = *v.Delta
+		}
+		if v.Value != nil {
+			val = *v.Value
+		}
+		if v.Histogram != nil {
+			hist = &grpcimp.Histogram{
+				Bounds: v.Histogram.Bounds,
+				Counts: v.Histogram.Counts,
+				Sum:    v.Histogram.Sum,
+				Count:  v.Histogram.Count,
+			}
+		}
+		if v.Summary != nil {
+			summ = &grpcimp.Summary{
+				Alpha:    v.Summary.Alpha,
+				Positive: v.Summary.Positive,
+				Negative: v.Summary.Negative,
+				Zero:     v.Summary.Zero,
+				Sum:      v.Summary.Sum,
+				Count:    v.Summary.Count,
+				Min:      v.Summary.Min,
+				Max:      v.Summary.Max,
+			}
+		}
+
+		mdata = append(mdata, &grpcimp.MetricData{
+			Type:       MetricType(v.MType),
+			Name:       v.ID,
+			Value:      val,
+			Delta:      delta,
+			Labels:     v.Labels,
+			Histogram:  hist,
+			Summary:    summ,
+			Ttl:        v.TTL,
+			Unit:       v.Unit,
+			Help:       v.Help,
+			Cumulative: v.Cumulative,
+			Source:     v.Source,
+		})
+	}
+	return mdata
+}
+
+// Converts protobuf messages to metrics batch
+func DataToMetrics(data []*grpcimp.MetricData) storagecommons.MetricsDB {
+	var dta storagecommons.MetricsDB
+
+	for _, v := range data {
+		v := v
+		m := storagecommons.Metrics{
+			ID:         v.Name,
+			MType:      MetricTypeName(v.Type),
+			Labels:     v.Labels,
+			TTL:        v.Ttl,
+			Unit:       v.Unit,
+			Help:       v.Help,
+			Cumulative: v.Cumulative,
+			Source:     v.Source,
+		}
+
+		switch v.Type {
+		case grpcimp.MetricData_COUNTER:
+			m.Delta = &v.Delta
+		case grpcimp.MetricData_GAUGE:
+			m.Value = &v.Value
+		case grpcimp.MetricData_HISTOGRAM:
+			if v.Histogram != nil {
+				m.Histogram = &storagecommons.Histogram{
+					Bounds: v.Histogram.Bounds,
+					Counts: v.Histogram.Counts,
+					Sum:    v.Histogram.Sum,
+					Count:  v.Histogram.Count,
+				}
+			}
+		case grpcimp.MetricData_SUMMARY:
+			if v.Summary != nil {
+				m.Summary = &storagecommons.Summary{
+					Alpha:    v.Summary.Alpha,
+					Positive: v.Summary.Positive,
+					Negative: v.Summary.Negative,
+					Zero:     v.Summary.Zero,
+					Sum:      v.Summary.Sum,
+					Count:    v.Summary.Count,
+					Min:      v.Summary.Min,
+					Max:      v.Summary.Max,
+				}
+			}
+		}
+
+		dta.MetricsDB = append(dta.MetricsDB, m)
+	}
+
+	return dta
+}
+
+// Converts metrics metadata to protobuf messages
+func MetadataToData(data []storagecommons.MetricMetadata) []*grpcimp.MetricMetadata {
+	mdata := make([]*grpcimp.MetricMetadata, 0, len(data))
+	for _, v := range data {
+		mdata = append(mdata, &grpcimp.MetricMetadata{
+			Name:      v.Name,
+			Type:      MetricType(v.Type),
+			Unit:      v.Unit,
+			Help:      v.Help,
+			FirstSeen: v.FirstSeen.UnixNano(),
+			LastSeen:  v.LastSeen.UnixNano(),
+		})
+	}
+	return mdata
+}
@@ -4,16 +4,24 @@ import (
 	"context"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"net"
+	"slices"
 	"yaprakticum-go-track2/internal/config"
 	"yaprakticum-go-track2/internal/grpcimp"
+	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
 	"yaprakticum-go-track2/internal/grpcimp/server/middlware"
+	"yaprakticum-go-track2/internal/replication"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
 type MetricsGRPCServer struct {
 	grpcimp.UnimplementedMetricsServer
 	dataStorage storagecommons.Storager
+	follower    *replication.Follower
 	gsrv        *grpc.Server
 	srv         net.Listener
 	cfg         config.ServerConfig
@@ -21,7 +29,7 @@ type MetricsGRPCServer struct {
 }
 
 func NewGRPCMetricsServer(dataStorage storagecommons.Storager, cfg config.ServerConfig, logger *zap.Logger) *MetricsGRPCServer {
-	return &MetricsGRPCServer{dataStorage: dataStorage, cfg: cfg, logger: logger}
+	return &MetricsGRPCServer{dataStorage: dataStorage, follower: replication.NewFollower(dataStorage, logger), cfg: cfg, logger: logger}
 }
 
 func (s *MetricsGRPCServer) ListenAndServeAsync() {
@@ -33,7 +41,8 @@ func (s *MetricsGRPCServer) ListenAndServeAsync() {
 	}
 
 	mw := middlware.GRPCServerMiddleware{Cfg: s.cfg}
-	s.gsrv = grpc.NewServer(grpc.ChainUnaryInterceptor(mw.WithLogging, mw.WithHMAC256Check, mw.WithTrustedNetworkCheck))
+	s.gsrv = grpc.NewServer(grpc.ChainUnaryInterceptor(mw.WithLogging, mw.WithHMAC256Check, mw.WithTrustedNetworkCheck, mw.WithTenant),
+		grpc.MaxRecvMsgSize(grpccommon.MaxSnapshotSize))
 	grpcimp.RegisterMetricsServer(s.gsrv, s)
 
 	go func() {
@@ -51,33 +60,25 @@ func (s *MetricsGRPCServer) Shutdown(context.Context) error {
 	return nil
 }
 
+func (s *MetricsGRPCServer) DeleteMetric(ctx context.Context, r *grpcimp.DeleteMetricRequest) (*grpcimp.DeleteMetricResponse, error) {
+	res := grpcimp.DeleteMetricResponse{}
+
+	err := s.dataStorage.Delete(ctx, storagecommons.Metrics{ID: r.Name, MType: grpccommon.MetricTypeName(r.Type), Labels: r.Labels})
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return &res, err
+}
+
 func (s *MetricsGRPCServer) UpdateMetrics(ctx context.Context, r *grpcimp.UpdateMetricsRequest) (*grpcimp.UpdateMetricsResponse, error) {
 	res := grpcimp.UpdateMetricsResponse{}
-	var dta storagecommons.MetricsDB
-
-	for _, v := range r.Data {
-		v := v
-		m := storagecommons.Metrics{}
-		m.ID = v.Name
-
-		switch v.Type {
-		case grpcimp.MetricData_COUNTER:
-			m = storagecommons.Metrics{
-				Delta: &v.Delta,
-				Value: nil,
-				ID:    v.Name,
-				MType: "counter",
-			}
-		case grpcimp.MetricData_GAUGE:
-			m = storagecommons.Metrics{
-				Delta: nil,
-				Value: &v.Value,
-				ID:    v.Name,
-				MType: "gauge",
-			}
-		}
 
-		dta.MetricsDB = append(dta.MetricsDB, m)
+	dta := grpccommon.DataToMetrics(r.Data)
+	for i, val := range dta.MetricsDB {
+		if val.Cumulative && val.Source == "" {
+			dta.MetricsDB[i].Source = requestSource(ctx)
+		}
 	}
 
 	err := s.dataStorage.WriteDataMulti(ctx, dta)
@@ -87,3 +88,54 @@ func (s *MetricsGRPCServer) UpdateMetrics(ctx context.Context, r *grpcimp.Update
 
 	return &res, err
 }
+
+// Returns agent address (X-Real-IP metadata or peer address),
+// it is source of cumulative counters written without one
+func requestSource(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("X-Real-IP"); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// Returns metadata of written metric names (all if no name requested)
+func (s *MetricsGRPCServer) GetMetadata(ctx context.Context, r *grpcimp.GetMetadataRequest) (*grpcimp.GetMetadataResponse, error) {
+	res := grpcimp.GetMetadataResponse{}
+
+	data, err := s.dataStorage.GetMetadata(ctx)
+	if err != nil {
+		res.Error = err.Error()
+		return &res, err
+	}
+
+	if r.Name != "" {
+		data = slices.DeleteFunc(data, func(md storagecommons.MetricMetadata) bool { return md.Name != r.Name })
+	}
+	res.Metadata = grpccommon.MetadataToData(data)
+
+	return &res, nil
+}
+
+// Applies write batch replicated by primary server (if server is follower)
+func (s *MetricsGRPCServer) Replicate(ctx context.Context, r *grpcimp.ReplicateRequest) (*grpcimp.ReplicateResponse, error) {
+	if !s.cfg.Follower {
+		return nil, status.Error(codes.PermissionDenied, "Server is not a follower")
+	}
+	return s.follower.Replicate(ctx, r), nil
+}
+
+// Replaces data with snapshot of primary server (if server is follower)
+func (s *MetricsGRPCServer) RestoreSnapshot(ctx context.Context, r *grpcimp.RestoreSnapshotRequest) (*grpcimp.RestoreSnapshotResponse, error) {
+	if !s.cfg.Follower {
+		return nil, status.Error(codes.PermissionDenied, "Server is not a follower")
+	}
+	return s.follower.RestoreSnapshot(ctx, r), nil
+}
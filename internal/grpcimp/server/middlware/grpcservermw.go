@@ -12,9 +12,9 @@ import (
 	"net"
 	"time"
 	"yaprakticum-go-track2/internal/config"
-	"yaprakticum-go-track2/internal/grpcimp"
 	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
 	"yaprakticum-go-track2/internal/shared"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
 type GRPCServerMiddleware struct {
@@ -45,8 +45,7 @@ func (gmw GRPCServerMiddleware) WithHMAC256Check(ctx context.Context, req interf
 			return nil, status.Error(codes.Unauthenticated, err.Error())
 		}
 
-		reqp := req.(*grpcimp.UpdateMetricsRequest)
-		b := grpccommon.MetricDataToByteSlice(reqp.Data)
+		b := grpccommon.RequestToByteSlice(req)
 
 		hmc := hmac.New(sha256.New, []byte(gmw.Cfg.Key))
 		hmc.Write(b)
@@ -124,3 +123,22 @@ func (gmw GRPCServerMiddleware) WithTrustedNetworkCheck(ctx context.Context, req
 
 	return handler(ctx, req)
 }
+
+// Scopes call to data of tenant identified by API key passed in metadata (see middleware.WithTenant of HTTP server)
+func (gmw GRPCServerMiddleware) WithTenant(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return handler(ctx, req)
+	}
+	values := md.Get(grpccommon.APIKeyMetadata)
+	if len(values) == 0 || values[0] == "" {
+		return handler(ctx, req)
+	}
+
+	tenant, ok := gmw.Cfg.TenantKeys[values[0]]
+	if !ok {
+		shared.Logger.Info("Unknown API key")
+		return nil, status.Error(codes.Unauthenticated, "Unknown API key")
+	}
+	return handler(storagecommons.WithTenant(ctx, tenant), req)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Removes metric series of given type and name with its history
+//
+// URL query parameters are treated as series labels
+func (h Handlers) DeleteMetricHandler(res http.ResponseWriter, req *http.Request) {
+
+	typ := chi.URLParam(req, "type")
+	name := chi.URLParam(req, "name")
+
+	if !slices.Contains([]string{"gauge", "counter", "histogram", "summary"}, typ) {
+		http.Error(res, "Unknown metric type: "+typ, http.StatusBadRequest)
+		return
+	}
+
+	err := h.dataStorage.Delete(req.Context(), storagecommons.Metrics{ID: name, MType: typ, Labels: labelsFromQuery(req)})
+	if errors.Is(err, storagecommons.ErrNotExists) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 
 	"github.com/go-chi/chi/v5"
@@ -19,7 +24,7 @@ func (h Handlers) PingHandler(res http.ResponseWriter, req *http.Request) {
 	res.WriteHeader(http.StatusOK)
 }
 
-// Returns response of html type with all stored metrics data displayed
+// Returns response of html type with all stored metrics data of request tenant displayed
 func (h Handlers) GetAllMetricsHandler(res http.ResponseWriter, req *http.Request) {
 
 	type Counter struct {
@@ -32,14 +37,24 @@ func (h Handlers) GetAllMetricsHandler(res http.ResponseWriter, req *http.Reques
 		Value float64
 	}
 
+	type Histogram struct {
+		Key   string
+		Count int64
+		Sum   float64
+	}
+
 	type PageData struct {
-		Counters []Counter
-		Gauges   []Gauge
+		Tenant     string
+		Counters   []Counter
+		Gauges     []Gauge
+		Histograms []Histogram
 	}
 
 	var pageData PageData
+	pageData.Tenant = storagecommons.TenantFromContext(req.Context())
 	pageData.Counters = make([]Counter, 0)
 	pageData.Gauges = make([]Gauge, 0)
+	pageData.Histograms = make([]Histogram, 0)
 
 	dta1, _ := h.dataStorage.GetCounters().ReadData(req.Context())
 	for k, v := range dta1 {
@@ -53,7 +68,14 @@ func (h Handlers) GetAllMetricsHandler(res http.ResponseWriter, req *http.Reques
 		pageData.Gauges = append(pageData.Gauges, Gauge{k, v})
 	}
 
-	tmplStr := `=========================</br>
+	dta3, _ := h.dataStorage.GetHistograms().ReadData(req.Context())
+	for k, v := range dta3 {
+		k, v := k, v
+		pageData.Histograms = append(pageData.Histograms, Histogram{k, v.Count, v.Sum})
+	}
+
+	tmplStr := `{{if .Tenant}}TENANT: {{.Tenant}}</br>
+{{end}}=========================</br>
 COUNTERS:</br>
 {{range .Counters}}
 	{{.Key}}:{{.Value}}</br>
@@ -63,6 +85,11 @@ GAUGES:</br>
 {{range .Gauges}} 
 	{{.Key}}:{{.Value}}</br> 
 {{end}}
+=========================</br>
+HISTOGRAMS:</br>
+{{range .Histograms}}
+	{{.Key}}:count={{.Count}},sum={{.Sum}}</br>
+{{end}}
 `
 	tmpl, _ := template.New("AllMetrics").Parse(tmplStr)
 
@@ -76,27 +103,146 @@ GAUGES:</br>
 
 }
 
+// Returns labels passed as URL query parameters
+func labelsFromQuery(req *http.Request, exclude ...string) map[string]string {
+	query := req.URL.Query()
+	res := make(map[string]string, len(query))
+	for k, v := range query {
+		if len(v) > 0 && !slices.Contains(exclude, k) {
+			res[k] = v[0]
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// Reads series of metric `name` which labels match `filter` (series without labels if no filter given)
+func readSeries[T any](ctx context.Context, ss storagecommons.Substorager[T], name string, filter map[string]string) (map[string]T, error) {
+	if len(filter) == 0 {
+		return ss.ReadData(ctx, name)
+	}
+
+	data, err := ss.ReadData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := storagecommons.FilterSeries(data, name, filter)
+	if len(res) == 0 {
+		return nil, errors.New("No series of " + name + " matching labels found")
+	}
+	return res, nil
+}
+
+// Writes single series value, or "series value" lines if several series found
+func writeSeries[T any](res http.ResponseWriter, data map[string]T, format func(T) string) {
+	if len(data) == 1 {
+		for _, v := range data {
+			res.Write([]byte(format(v)))
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+" "+format(data[k]))
+	}
+	res.Write([]byte(strings.Join(lines, "\n")))
+}
+
+// Returns q-quantile of summary `name` merged over all series matching `filter`
+func readSummaryQuantile(ctx context.Context, ss storagecommons.StoragerSummary, name string, filter map[string]string, q float64) (float64, error) {
+	data, err := ss.ReadData(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		merged storagecommons.Summary
+		found  bool
+	)
+	for _, v := range storagecommons.FilterSeries(data, name, filter) {
+		if !found {
+			merged, found = storagecommons.NewSummary(v.Alpha), true
+		}
+		err = merged.Merge(v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !found {
+		return 0, errors.New("No series of " + name + " matching labels found")
+	}
+
+	return merged.Quantile(q)
+}
+
 // Returns requested metric value (text format)
+//
+// URL query parameters are treated as labels filter.
+// For summaries `q` parameter requests quantile estimation over all matching series
 func (h Handlers) GetMetricHandler(res http.ResponseWriter, req *http.Request) {
 
 	typ := chi.URLParam(req, "type")
 	nam := chi.URLParam(req, "name")
+	filter := labelsFromQuery(req)
 
 	switch typ {
 	case "gauge":
-		value, err := h.dataStorage.GetGauges().ReadData(req.Context(), nam)
+		value, err := readSeries[float64](req.Context(), h.dataStorage.GetGauges(), nam, filter)
 		if err != nil {
 			http.Error(res, err.Error(), http.StatusNotFound)
 			return
 		}
-		res.Write([]byte(strconv.FormatFloat(value[nam], 'f', -1, 64)))
+		writeSeries(res, value, func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) })
 	case "counter":
-		value, err := h.dataStorage.GetCounters().ReadData(req.Context(), nam)
+		value, err := readSeries[int64](req.Context(), h.dataStorage.GetCounters(), nam, filter)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeSeries(res, value, func(v int64) string { return fmt.Sprintf("%d", v) })
+	case "histogram":
+		value, err := readSeries[storagecommons.Histogram](req.Context(), h.dataStorage.GetHistograms(), nam, filter)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeSeries(res, value, func(v storagecommons.Histogram) string {
+			jsn, _ := json.Marshal(v)
+			return string(jsn)
+		})
+	case "summary":
+		if req.URL.Query().Has("q") {
+			q, err := strconv.ParseFloat(req.URL.Query().Get("q"), 64)
+			if err != nil || q < 0 || q > 1 {
+				http.Error(res, "Quantile must be number within [0, 1]", http.StatusBadRequest)
+				return
+			}
+			value, err := readSummaryQuantile(req.Context(), h.dataStorage.GetSummaries(), nam, labelsFromQuery(req, "q"), q)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusNotFound)
+				return
+			}
+			res.Write([]byte(strconv.FormatFloat(value, 'f', -1, 64)))
+			return
+		}
+		value, err := readSeries[storagecommons.Summary](req.Context(), h.dataStorage.GetSummaries(), nam, filter)
 		if err != nil {
 			http.Error(res, err.Error(), http.StatusNotFound)
 			return
 		}
-		res.Write([]byte(fmt.Sprintf("%d", value[nam])))
+		writeSeries(res, value, func(v storagecommons.Summary) string {
+			jsn, _ := json.Marshal(v)
+			return string(jsn)
+		})
 	default:
 		http.Error(res, "Unknown type "+typ, http.StatusNotFound)
 		return
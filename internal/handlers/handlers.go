@@ -4,6 +4,7 @@ package handlers
 
 import (
 	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/ingest"
 	"yaprakticum-go-track2/internal/storage"
 )
 
@@ -11,9 +12,12 @@ import (
 type Handlers struct {
 	dataStorage *storage.Storage
 	cfg         config.ServerConfig
+	influxRules []ingest.IntRule
 }
 
 // Constructor of Handlers
 func NewHandlers(storage *storage.Storage, config config.ServerConfig) Handlers {
-	return Handlers{dataStorage: storage, cfg: config}
+	// Rules are checked at server start (see ingest.CheckConfig)
+	influxRules, _ := ingest.ParseIntRules(config.InfluxIntRules)
+	return Handlers{dataStorage: storage, cfg: config, influxRules: influxRules}
 }
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+	"yaprakticum-go-track2/internal/ingest"
+)
+
+// Packet storing of metrics data in InfluxDB line protocol (see ingest.InfluxMetrics)
+//
+// Optional `precision` URL query parameter sets unit of timestamps (ns by default).
+// Integer fields are written as counters or gauges according to configured rules
+func (h Handlers) InfluxWriteHandler(res http.ResponseWriter, req *http.Request) {
+
+	if err := checkHmacSha256(req, h.cfg); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	precision, err := ingest.InfluxPrecision(req.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, err := ingest.ParseInflux(body, precision)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dta, err := ingest.InfluxMetrics(points, h.influxRules, time.Now())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i, val := range dta.MetricsDB {
+		if val.Cumulative {
+			dta.MetricsDB[i].Source = requestSource(req)
+		}
+	}
+
+	if len(dta.MetricsDB) > 0 {
+		err = h.dataStorage.WriteDataMulti(req.Context(), dta)
+		if err != nil {
+			http.Error(res, err.Error(), writeErrorStatus(err))
+			return
+		}
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Returns metadata of written metric names (JSON format)
+//
+// Optional `name` URL query parameter limits result to single metric
+func (h Handlers) GetMetadataHandler(res http.ResponseWriter, req *http.Request) {
+
+	data, err := h.dataStorage.GetMetadata(req.Context())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if name := req.URL.Query().Get("name"); name != "" {
+		filtered := make([]storagecommons.MetricMetadata, 0, 1)
+		for _, md := range data {
+			if md.Name == name {
+				filtered = append(filtered, md)
+			}
+		}
+		if len(filtered) == 0 {
+			http.Error(res, "No metadata of "+name+" found", http.StatusNotFound)
+			return
+		}
+		data = filtered
+	}
+
+	resp, _ := json.MarshalIndent(data, "", "    ")
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(resp)
+}
+
+// Returns status of rejected write: writes conflicting with registered metric type get 409
+func writeErrorStatus(err error) int {
+	var conflict *storagecommons.TypeConflictError
+	if errors.As(err, &conflict) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
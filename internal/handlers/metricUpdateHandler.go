@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"yaprakticum-go-track2/internal/config"
@@ -59,14 +60,27 @@ func checkHmacSha256(r *http.Request, cfg config.ServerConfig) error {
 	return nil
 }
 
+// Returns agent address (X-Real-IP header or remote address of request),
+// it is source of cumulative counters written without one
+func requestSource(req *http.Request) string {
+	if ip := req.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
 // Storing metric data of given type and name
 //
-// Metric data is extracted from URL
+// Metric data is extracted from URL, URL query parameters are treated as series labels
 func (h Handlers) MetricUpdateHandler(res http.ResponseWriter, req *http.Request) {
 
 	typ := chi.URLParam(req, "type")
 	name := chi.URLParam(req, "name")
 	val := chi.URLParam(req, "value")
+	labels := labelsFromQuery(req)
 
 	switch typ {
 	case "gauge":
@@ -78,8 +92,8 @@ func (h Handlers) MetricUpdateHandler(res http.ResponseWriter, req *http.Request
 		}
 
 		if err := h.dataStorage.WriteDataMulti(req.Context(), storagecommons.MetricsDB{
-			MetricsDB: []storagecommons.Metrics{{Delta: nil, Value: &parsedVal, ID: name, MType: typ}}}); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			MetricsDB: []storagecommons.Metrics{{Delta: nil, Value: &parsedVal, ID: name, MType: typ, Labels: labels}}}); err != nil {
+			http.Error(res, err.Error(), writeErrorStatus(err))
 			return
 		}
 
@@ -97,8 +111,8 @@ func (h Handlers) MetricUpdateHandler(res http.ResponseWriter, req *http.Request
 		}
 
 		if err := h.dataStorage.WriteDataMulti(req.Context(), storagecommons.MetricsDB{
-			MetricsDB: []storagecommons.Metrics{{Delta: &parsedVal, Value: nil, ID: name, MType: typ}}}); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			MetricsDB: []storagecommons.Metrics{{Delta: &parsedVal, Value: nil, ID: name, MType: typ, Labels: labels}}}); err != nil {
+			http.Error(res, err.Error(), writeErrorStatus(err))
 			return
 		}
 
@@ -107,6 +121,42 @@ func (h Handlers) MetricUpdateHandler(res http.ResponseWriter, req *http.Request
 			return
 		}*/
 
+	case "histogram":
+
+		// Single observation, bucketed by server default bounds
+		parsedVal, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		hist := storagecommons.NewHistogram(h.cfg.HistogramBuckets)
+		hist.Observe(parsedVal)
+
+		if err := h.dataStorage.WriteDataMulti(req.Context(), storagecommons.MetricsDB{
+			MetricsDB: []storagecommons.Metrics{{Histogram: &hist, ID: name, MType: typ, Labels: labels}}}); err != nil {
+			http.Error(res, err.Error(), writeErrorStatus(err))
+			return
+		}
+
+	case "summary":
+
+		// Single observation, sketched with server default accuracy
+		parsedVal, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		summ := storagecommons.NewSummary(h.cfg.SummaryAccuracy)
+		summ.Observe(parsedVal)
+
+		if err := h.dataStorage.WriteDataMulti(req.Context(), storagecommons.MetricsDB{
+			MetricsDB: []storagecommons.Metrics{{Summary: &summ, ID: name, MType: typ, Labels: labels}}}); err != nil {
+			http.Error(res, err.Error(), writeErrorStatus(err))
+			return
+		}
+
 	default:
 
 		http.Error(res, "Unknown metric type: "+typ, http.StatusBadRequest)
@@ -137,6 +187,9 @@ func (h Handlers) MetricsUpdateHandlerREST(res http.ResponseWriter, req *http.Re
 		http.Error(res, "Error parsing JSON", http.StatusBadRequest)
 		return
 	}
+	if dta.Cumulative && dta.Source == "" {
+		dta.Source = requestSource(req)
+	}
 
 	resp, err := h.dataStorage.WriteData(req.Context(), dta)
 	val, _ := json.MarshalIndent(resp, "", "    ")
@@ -147,7 +200,7 @@ func (h Handlers) MetricsUpdateHandlerREST(res http.ResponseWriter, req *http.Re
 		return
 	}
 
-	http.Error(res, err.Error(), http.StatusBadRequest)
+	http.Error(res, err.Error(), writeErrorStatus(err))
 }
 
 // Packet storing of metrics data
@@ -171,6 +224,11 @@ func (h Handlers) MultiMetricsUpdateHandlerREST(res http.ResponseWriter, req *ht
 		http.Error(res, "Error parsing JSON", http.StatusBadRequest)
 		return
 	}
+	for i, val := range dta.MetricsDB {
+		if val.Cumulative && val.Source == "" {
+			dta.MetricsDB[i].Source = requestSource(req)
+		}
+	}
 
 	err = h.dataStorage.WriteDataMulti(req.Context(), dta)
 
@@ -178,5 +236,5 @@ func (h Handlers) MultiMetricsUpdateHandlerREST(res http.ResponseWriter, req *ht
 		return
 	}
 
-	http.Error(res, err.Error(), http.StatusBadRequest)
+	http.Error(res, err.Error(), writeErrorStatus(err))
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"yaprakticum-go-track2/internal/shared"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Header with API key identifying tenant
+const APIKeyHeader = "X-API-Key"
+
+// Scopes request to data of tenant identified by API key (`tenantKeys` maps keys to tenants).
+// Requests without key are scoped to default tenant, requests with unknown key are rejected
+func WithTenant(tenantKeys map[string]string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			tenant, ok := tenantKeys[key]
+			if !ok {
+				shared.Logger.Info("Unknown API key")
+				http.Error(w, "Unknown API key", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r.WithContext(storagecommons.WithTenant(r.Context(), tenant)))
+		})
+	}
+}
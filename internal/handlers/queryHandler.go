@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Default parameters of range query
+const (
+	defaultQueryRange = time.Hour
+	defaultQueryStep  = time.Minute
+)
+
+// Series of range query response (Prometheus matrix format)
+type querySeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]any          `json:"values"`
+}
+
+// Range query response (Prometheus API format)
+type queryResponse struct {
+	Status    string `json:"status"`
+	Data      any    `json:"data,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Parses time given as Unix timestamp (seconds, may be fractional) or in RFC 3339 format
+func parseQueryTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return t, errors.New("cannot parse time " + s)
+	}
+	return t, nil
+}
+
+// Parses duration given as number of seconds or in Go format (`30s`, `5m`, ...)
+func parseQueryStep(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultQueryStep, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return d, errors.New("cannot parse step " + s)
+	}
+	return d, nil
+}
+
+// Writes range query response
+func writeQueryResponse(res http.ResponseWriter, status int, resp queryResponse) {
+	jsn, _ := json.Marshal(resp)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(jsn)
+}
+
+// Returns series of metric aggregated by steps of time range (Prometheus API format)
+//
+// URL query parameters: `metric` name, optional `type` (registered type of metric by default),
+// `start` and `end` of range (last hour by default), `step` (1m by default)
+// and `agg` aggregation of samples within step: avg, min, max, sum, last (default) or rate.
+// Other parameters are treated as labels filter
+func (h Handlers) QueryRangeHandler(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	badData := func(err error) {
+		writeQueryResponse(res, http.StatusBadRequest, queryResponse{Status: "error", ErrorType: "bad_data", Error: err.Error()})
+	}
+
+	q := storagecommons.RangeQuery{
+		Name:   query.Get("metric"),
+		MType:  query.Get("type"),
+		Labels: labelsFromQuery(req, "metric", "type", "start", "end", "step", "agg"),
+		Agg:    query.Get("agg"),
+	}
+	if q.Agg == "" {
+		q.Agg = storagecommons.AggLast
+	}
+
+	var err error
+	if q.End, err = parseQueryTime(query.Get("end"), time.Now()); err != nil {
+		badData(err)
+		return
+	}
+	if q.Start, err = parseQueryTime(query.Get("start"), q.End.Add(-defaultQueryRange)); err != nil {
+		badData(err)
+		return
+	}
+	if q.Step, err = parseQueryStep(query.Get("step")); err != nil {
+		badData(err)
+		return
+	}
+
+	result := make([]querySeries, 0)
+	if q.MType == "" && q.Name != "" {
+		mds, err := h.dataStorage.GetMetadata(req.Context())
+		if err != nil {
+			writeQueryResponse(res, http.StatusInternalServerError, queryResponse{Status: "error", ErrorType: "internal", Error: err.Error()})
+			return
+		}
+		for _, md := range mds {
+			if md.Name == q.Name {
+				q.MType = md.Type
+			}
+		}
+		if q.MType == "" {
+			writeQueryResponse(res, http.StatusOK, queryResponse{Status: "success", Data: map[string]any{"resultType": "matrix", "result": result}})
+			return
+		}
+	}
+
+	if err = q.Validate(); err != nil {
+		badData(err)
+		return
+	}
+	series, err := storagecommons.QueryRange(req.Context(), h.dataStorage, q)
+	if err != nil {
+		writeQueryResponse(res, http.StatusInternalServerError, queryResponse{Status: "error", ErrorType: "internal", Error: err.Error()})
+		return
+	}
+
+	for _, s := range series {
+		metric := map[string]string{"__name__": s.ID}
+		for k, v := range s.Labels {
+			metric[k] = v
+		}
+		values := make([][2]any, 0, len(s.Points))
+		for _, p := range s.Points {
+			values = append(values, [2]any{float64(p.Timestamp.UnixMilli()) / 1000, strconv.FormatFloat(p.Value, 'f', -1, 64)})
+		}
+		result = append(result, querySeries{Metric: metric, Values: values})
+	}
+	writeQueryResponse(res, http.StatusOK, queryResponse{Status: "success", Data: map[string]any{"resultType": "matrix", "result": result}})
+}
@@ -14,11 +14,13 @@ func Router(h Handlers, pm *prom.CustomPromMetrics) chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.WithTrustedNetworkCheck(h.cfg.TrustedSubnet),
 		middleware.WithRSA(h.cfg),
+		middleware.WithTenant(h.cfg.TenantKeys),
 		middleware.GzipHandler,
 		middleware.WithLogging,
 		middleware.Prom(pm))
 	r.Route("/", func(r chi.Router) {
 		r.Get("/", h.GetAllMetricsHandler)
+		r.Post("/write", h.InfluxWriteHandler)
 		r.Route("/updates", func(r chi.Router) {
 			r.Post("/", h.MultiMetricsUpdateHandlerREST)
 		})
@@ -35,8 +37,15 @@ func Router(h Handlers, pm *prom.CustomPromMetrics) chi.Router {
 		})
 		r.Route("/value", func(r chi.Router) {
 			r.Get("/{type}/{name}", h.GetMetricHandler)
+			r.Delete("/{type}/{name}", h.DeleteMetricHandler)
 			r.Post("/", h.GetMetricHandlerREST)
 		})
+		r.Route("/metadata", func(r chi.Router) {
+			r.Get("/", h.GetMetadataHandler)
+		})
+		r.Route("/api/v1", func(r chi.Router) {
+			r.Get("/query_range", h.QueryRangeHandler)
+		})
 		r.Route("/ping", func(r chi.Router) {
 			r.Get("/", h.PingHandler)
 		})
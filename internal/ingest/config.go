@@ -0,0 +1,14 @@
+package ingest
+
+import (
+	"yaprakticum-go-track2/internal/config"
+)
+
+// Checks ingest options of server configuration
+func CheckConfig(cfg config.ServerConfig) error {
+	if _, err := ParseIntRules(cfg.InfluxIntRules); err != nil {
+		return err
+	}
+	_, err := ParseGraphiteTemplates(cfg.GraphiteTemplates)
+	return err
+}
@@ -0,0 +1,3 @@
+// Package contains parsers of third-party metric protocols converting them to storage metrics
+
+package ingest
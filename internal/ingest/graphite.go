@@ -0,0 +1,223 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Elements of Graphite template
+const (
+	graphiteMeasurement    = "measurement"  // Path segment is part of metric name
+	graphiteMeasurementAll = "measurement*" // Segment and all following ones are parts of metric name
+)
+
+// Point of Graphite plaintext protocol: `path[;tag=value...] value [timestamp]`
+type GraphitePoint struct {
+	Path      string
+	Tags      map[string]string // Tags of Graphite 1.1 tagged series
+	Value     float64
+	Timestamp time.Time // Zero if not given
+}
+
+// Parses line of Graphite plaintext protocol
+func ParseGraphite(line string) (GraphitePoint, error) {
+	var p GraphitePoint
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return p, errors.New("invalid Graphite line: " + line)
+	}
+
+	series := strings.Split(fields[0], ";")
+	p.Path = series[0]
+	if p.Path == "" || strings.HasPrefix(p.Path, ".") || strings.HasSuffix(p.Path, ".") || strings.Contains(p.Path, "..") {
+		return p, errors.New("invalid metric path: " + line)
+	}
+	for _, tag := range series[1:] {
+		k, v, found := strings.Cut(tag, "=")
+		if !found || k == "" || v == "" {
+			return p, errors.New("invalid tag: " + line)
+		}
+		if p.Tags == nil {
+			p.Tags = make(map[string]string)
+		}
+		p.Tags[k] = v
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return p, errors.New("invalid value: " + line)
+	}
+	p.Value = v
+
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || ts < 0 {
+			return p, errors.New("invalid timestamp: " + line)
+		}
+		sec, frac := math.Modf(ts)
+		p.Timestamp = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+	}
+
+	return p, nil
+}
+
+// Template mapping dotted path segments to metric name and labels, given as `[filter ]template[ tag=value,...]`.
+// Template elements are `measurement` (segment is part of metric name), `measurement*` (the rest of path is),
+// label name the segment is value of or empty element (segment is skipped).
+// E.g. `servers.* .host.measurement* env=prod` maps `servers.a.cpu.load` to `cpu.load{host="a",env="prod"}`
+type GraphiteTemplate struct {
+	Filter []string          // Patterns of leading path segments (see path.Match), empty filter matches any path
+	Parts  []string          // Template elements
+	Tags   map[string]string // Labels added to all metrics
+}
+
+// Parses templates, fails on first invalid one (metrics of misparsed paths would get wrong names)
+func ParseGraphiteTemplates(templates []string) ([]GraphiteTemplate, error) {
+	res := make([]GraphiteTemplate, 0, len(templates))
+	for _, t := range templates {
+		tmpl, err := parseGraphiteTemplate(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Graphite template %q: %w", t, err)
+		}
+		res = append(res, tmpl)
+	}
+	return res, nil
+}
+
+func parseGraphiteTemplate(s string) (GraphiteTemplate, error) {
+	var (
+		tmpl  GraphiteTemplate
+		parts string
+		tags  string
+	)
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 1:
+		parts = fields[0]
+	case len(fields) == 2 && strings.Contains(fields[1], "="):
+		parts, tags = fields[0], fields[1]
+	case len(fields) == 2:
+		tmpl.Filter, parts = strings.Split(fields[0], "."), fields[1]
+	case len(fields) == 3:
+		tmpl.Filter, parts, tags = strings.Split(fields[0], "."), fields[1], fields[2]
+	default:
+		return tmpl, errors.New("[filter ]template[ tag=value,...] expected")
+	}
+
+	for _, pattern := range tmpl.Filter {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return tmpl, errors.New("invalid filter pattern " + pattern)
+		}
+	}
+
+	tmpl.Parts = strings.Split(parts, ".")
+	named := false
+	for i, part := range tmpl.Parts {
+		switch part {
+		case graphiteMeasurementAll:
+			if i != len(tmpl.Parts)-1 {
+				return tmpl, errors.New(graphiteMeasurementAll + " is not last element")
+			}
+			named = true
+		case graphiteMeasurement:
+			named = true
+		}
+	}
+	if !named {
+		return tmpl, errors.New("metric name elements are missing")
+	}
+	for _, part := range tmpl.Parts {
+		if part != "" && part != graphiteMeasurement && part != graphiteMeasurementAll && !storagecommons.IsValidLabelName(part) {
+			return tmpl, errors.New("invalid label name " + part)
+		}
+	}
+
+	if tags != "" {
+		tmpl.Tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ",") {
+			k, v, found := strings.Cut(tag, "=")
+			if !found || !storagecommons.IsValidLabelName(k) || v == "" {
+				return tmpl, errors.New("invalid tag " + tag)
+			}
+			tmpl.Tags[k] = v
+		}
+	}
+	return tmpl, nil
+}
+
+// Returns true if leading segments of path match filter of template
+func (t GraphiteTemplate) matches(segments []string) bool {
+	if len(segments) < len(t.Filter) {
+		return false
+	}
+	for i, pattern := range t.Filter {
+		if ok, _ := path.Match(pattern, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns metric name and labels of path segments (segments beyond template are skipped)
+func (t GraphiteTemplate) apply(segments []string) (string, map[string]string) {
+	name := make([]string, 0, len(segments))
+	labels := make(map[string]string)
+	for k, v := range t.Tags {
+		labels[k] = v
+	}
+
+loop:
+	for i, part := range t.Parts {
+		if i >= len(segments) {
+			break
+		}
+		switch part {
+		case "":
+		case graphiteMeasurement:
+			name = append(name, segments[i])
+		case graphiteMeasurementAll:
+			name = append(name, segments[i:]...)
+			break loop
+		default:
+			labels[part] = segments[i]
+		}
+	}
+	return strings.Join(name, "."), labels
+}
+
+// Returns gauge of point named and labeled by first template matching its path (path is metric name if none matches).
+// Tags of tagged series become labels too. Point received at `now` is rejected if its timestamp is further than MaxTimestampSkew from it,
+// as storages record samples at write time
+func GraphiteMetric(p GraphitePoint, templates []GraphiteTemplate, now time.Time) (storagecommons.Metrics, error) {
+	if err := checkTimestamp(p.Timestamp, now); err != nil {
+		return storagecommons.Metrics{}, fmt.Errorf("point of %s: %w", p.Path, err)
+	}
+
+	name, labels := p.Path, make(map[string]string)
+	segments := strings.Split(p.Path, ".")
+	for _, t := range templates {
+		if t.matches(segments) {
+			name, labels = t.apply(segments)
+			break
+		}
+	}
+	if name == "" {
+		return storagecommons.Metrics{}, errors.New("metric name is missing in path " + p.Path)
+	}
+
+	for k, v := range p.Tags {
+		labels[storagecommons.SanitizeLabelName(k)] = v
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	v := p.Value
+	return storagecommons.Metrics{ID: name, MType: "gauge", Value: &v, Labels: labels}, nil
+}
@@ -0,0 +1,205 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func TestParseGraphite(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    GraphitePoint
+		wantErr bool
+	}{
+		{name: "With Timestamp", line: "servers.a.cpu 0.5 1700000000", want: GraphitePoint{Path: "servers.a.cpu", Value: 0.5, Timestamp: time.Unix(1700000000, 0)}},
+		{name: "No Timestamp", line: "jobs.done 3", want: GraphitePoint{Path: "jobs.done", Value: 3}},
+		{name: "Current Time", line: "jobs.done 3 -1", want: GraphitePoint{Path: "jobs.done", Value: 3}},
+		{name: "Tagged", line: "disk.used;host=a;mount=/ 10 1700000000", want: GraphitePoint{Path: "disk.used", Tags: map[string]string{"host": "a", "mount": "/"}, Value: 10, Timestamp: time.Unix(1700000000, 0)}},
+		{name: "No Value", line: "jobs.done", wantErr: true},
+		{name: "Invalid Value", line: "jobs.done many", wantErr: true},
+		{name: "Invalid Timestamp", line: "jobs.done 1 today", wantErr: true},
+		{name: "Empty Segment", line: "jobs..done 1", wantErr: true},
+		{name: "Invalid Tag", line: "jobs.done;host 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGraphite(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseGraphiteTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "Measurement Not Last", template: "invalid.* measurement*.host"},
+		{name: "Tags Only", template: "region=us"},
+		{name: "No Measurement", template: ".host"},
+		{name: "Invalid Filter", template: "[a.* .host.measurement"},
+		{name: "Invalid Tag", template: ".host.measurement env="},
+		{name: "Too Many Fields", template: "a.* measurement env=prod extra"},
+		{name: "Invalid Label Name", template: ".host-name.measurement"},
+		{name: "Invalid Tag Name", template: ".host.measurement data-center=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGraphiteTemplates([]string{"measurement*", tt.template})
+			assert.Error(t, err)
+		})
+	}
+
+	assert.NoError(t, CheckConfig(config.ServerConfig{GraphiteTemplates: []string{"servers.* .host.measurement*"}}))
+	assert.Error(t, CheckConfig(config.ServerConfig{GraphiteTemplates: []string{".host"}}))
+}
+
+func TestGraphiteMetric(t *testing.T) {
+	templates, err := ParseGraphiteTemplates([]string{
+		"servers.* .host.measurement* env=prod",
+		"cron.*.*.* ..job.measurement",
+		"host.measurement.measurement",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, templates, 3)
+
+	tests := []struct {
+		path    string
+		tags    map[string]string
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{path: "servers.a.cpu.load", name: "cpu.load", labels: map[string]string{"host": "a", "env": "prod"}},
+		{path: "cron.nightly.backup.duration.extra", name: "duration", labels: map[string]string{"job": "backup"}},
+		{path: "db1.disk.used", name: "disk.used", labels: map[string]string{"host": "db1"}},
+		{path: "db1.disk.used", tags: map[string]string{"mount": "/"}, name: "disk.used", labels: map[string]string{"host": "db1", "mount": "/"}},
+		{path: "db1.disk.used", tags: map[string]string{"mount-point": "/"}, name: "disk.used", labels: map[string]string{"host": "db1", "mount_point": "/"}},
+		{path: "cron.nightly.backup", name: "nightly.backup", labels: map[string]string{"host": "cron"}},
+		{path: "uptime", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			m, err := GraphiteMetric(GraphitePoint{Path: tt.path, Tags: tt.tags, Value: 1}, templates, time.Now())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.name, m.ID)
+				assert.Equal(t, "gauge", m.MType)
+				assert.Equal(t, tt.labels, m.Labels)
+			}
+		})
+	}
+
+	t.Run("Timestamps", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		for _, tt := range []struct {
+			ts      time.Time
+			wantErr bool
+		}{
+			{ts: time.Time{}},
+			{ts: now.Add(-30 * time.Second)},
+			{ts: now.Add(30 * time.Second)},
+			{ts: now.Add(-time.Hour), wantErr: true},
+			{ts: now.Add(time.Hour), wantErr: true},
+		} {
+			_, err := GraphiteMetric(GraphitePoint{Path: "uptime", Value: 1, Timestamp: tt.ts}, nil, now)
+			assert.Equal(t, tt.wantErr, err != nil, tt.ts)
+		}
+	})
+}
+
+func TestGraphiteServer(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	db, err := filestore.New(ctx, config.ServerConfig{}, logger)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	var delta int64 = 1
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "taken", MType: "counter", Delta: &delta})
+	assert.NoError(t, err)
+
+	srv := NewGraphiteServer(db, config.ServerConfig{GraphiteAddress: "127.0.0.1:0", GraphiteTemplates: []string{"servers.* .host.measurement*"}}, logger)
+	srv.ListenAndServeAsync()
+	if !assert.NotNil(t, srv.Addr()) {
+		return
+	}
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = conn.Write([]byte(fmt.Sprintf("servers.a.cpu 0.5 %d\nservers.c.cpu 0.9 1700000000\ngarbage\n\ntaken 2\njobs.done 3\nservers.b.cpu 0.7", time.Now().Unix())))
+	assert.NoError(t, err)
+	conn.Close()
+
+	// Batch with conflicting metric is written metric by metric
+	assert.Eventually(t, func() bool {
+		gauges, _ := db.GetGauges().ReadData(ctx)
+		return len(gauges) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, srv.Shutdown(ctx))
+
+	gauges, _ := db.GetGauges().ReadData(ctx)
+	assert.Equal(t, 0.5, gauges[storagecommons.SeriesKey("cpu", map[string]string{"host": "a"})])
+	assert.Equal(t, 0.7, gauges[storagecommons.SeriesKey("cpu", map[string]string{"host": "b"})])
+	assert.Equal(t, 3.0, gauges["jobs.done"])
+	assert.NotContains(t, gauges, "taken")
+	// Stale point is skipped as malformed one
+	assert.NotContains(t, gauges, storagecommons.SeriesKey("cpu", map[string]string{"host": "c"}))
+}
+
+func TestGraphiteServerLongLine(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	db, err := filestore.New(ctx, config.ServerConfig{}, logger)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	srv := NewGraphiteServer(db, config.ServerConfig{GraphiteAddress: "127.0.0.1:0"}, logger)
+	srv.ListenAndServeAsync()
+	if !assert.NotNil(t, srv.Addr()) {
+		return
+	}
+	defer srv.Shutdown(ctx)
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("jobs.done 3\n" + strings.Repeat("a", maxGraphiteLine) + " 1\n"))
+	assert.NoError(t, err)
+
+	// Lines before oversized one are written, then connection is closed by server
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	// Closed connection with unread data is reset, so EOF is not guaranteed
+	var netErr net.Error
+	if assert.Error(t, err) && errors.As(err, &netErr) {
+		assert.False(t, netErr.Timeout())
+	}
+	gauges, _ := db.GetGauges().ReadData(ctx)
+	assert.Equal(t, 3.0, gauges["jobs.done"])
+}
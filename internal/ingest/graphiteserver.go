@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Batching of Graphite writes: batch is written when it is full or connection is idle for timeout
+const (
+	graphiteBatchSize    = 1000
+	graphiteBatchTimeout = time.Second
+)
+
+// Max length of Graphite line, connection sending longer one is closed
+const maxGraphiteLine = 16 * 1024
+
+// TCP server receiving lines of Graphite plaintext protocol and writing them to storage in batches
+type GraphiteServer struct {
+	addr        string
+	templates   []GraphiteTemplate
+	dataStorage storagecommons.Storager
+	logger      *zap.Logger
+	listener    net.Listener
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+// Returns Graphite server configured by cfg (nil if Graphite address is not set)
+func NewGraphiteServer(dataStorage storagecommons.Storager, cfg config.ServerConfig, logger *zap.Logger) *GraphiteServer {
+	if cfg.GraphiteAddress == "" {
+		return nil
+	}
+	// Templates are checked at server start (see CheckConfig)
+	templates, _ := ParseGraphiteTemplates(cfg.GraphiteTemplates)
+	return &GraphiteServer{
+		addr:        cfg.GraphiteAddress,
+		templates:   templates,
+		dataStorage: dataStorage,
+		logger:      logger,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *GraphiteServer) ListenAndServeAsync() {
+	var err error
+	s.listener, err = net.Listen("tcp", s.addr)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return
+	}
+	s.logger.Info("Graphite server running at " + s.listener.Addr().String())
+
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Returns address server listens on (nil if it is not started)
+func (s *GraphiteServer) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stops accepting connections, closes active ones and writes their pending batches
+func (s *GraphiteServer) Shutdown(context.Context) error {
+	if s == nil || s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *GraphiteServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error(err.Error())
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Reads lines of connection until it is closed, malformed lines are skipped.
+// Connection is closed on line exceeding maxGraphiteLine
+func (s *GraphiteServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	batch := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0, graphiteBatchSize)}
+	flush := func() {
+		if len(batch.MetricsDB) > 0 {
+			s.write(batch)
+			// Storages may keep written batch (e.g. in replication queue), so it is not reused
+			batch = storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0, graphiteBatchSize)}
+		}
+	}
+	add := func(line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		p, err := ParseGraphite(line)
+		if err == nil {
+			var m storagecommons.Metrics
+			if m, err = GraphiteMetric(p, s.templates, time.Now()); err == nil {
+				batch.MetricsDB = append(batch.MetricsDB, m)
+			}
+		}
+		if err != nil {
+			s.logger.Debug(err.Error())
+		}
+	}
+
+	r := bufio.NewReaderSize(conn, maxGraphiteLine)
+	// Part of line read before timeout
+	var partial []byte
+	for {
+		conn.SetReadDeadline(time.Now().Add(graphiteBatchTimeout))
+		chunk, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) || len(partial)+len(chunk) > maxGraphiteLine {
+			s.logger.Info("line exceeds " + strconv.Itoa(maxGraphiteLine) + " bytes, connection " + conn.RemoteAddr().String() + " is closed")
+			flush()
+			return
+		}
+		if err == nil {
+			add(string(partial) + string(chunk))
+			partial = partial[:0]
+			if len(batch.MetricsDB) >= graphiteBatchSize {
+				flush()
+			}
+			continue
+		}
+
+		// Chunk is valid until next read only
+		partial = append(partial, chunk...)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			flush()
+			continue
+		}
+		if len(partial) > 0 {
+			add(string(partial))
+		}
+		flush()
+		return
+	}
+}
+
+// Writes batch, if storage rejects it metrics are written one by one (rewriting gauges written before rejection is harmless)
+func (s *GraphiteServer) write(batch storagecommons.MetricsDB) {
+	ctx := context.Background()
+	if err := s.dataStorage.WriteDataMulti(ctx, batch); err != nil {
+		s.logger.Info("batch is not written: " + err.Error())
+		writeMetrics(ctx, s.dataStorage, batch, s.logger)
+	}
+}
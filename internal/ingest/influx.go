@@ -0,0 +1,287 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Point of InfluxDB line protocol: `measurement[,tag=value...] field=value[,field=value...] [timestamp]`
+type InfluxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any // float64, int64, uint64, bool or string
+	Timestamp   time.Time      // Zero if not given
+}
+
+// Returns multiplier converting timestamps of precision to nanoseconds (InfluxDB v1 API `precision` values)
+func InfluxPrecision(precision string) (int64, error) {
+	switch precision {
+	case "", "n", "ns":
+		return 1, nil
+	case "u", "us":
+		return int64(time.Microsecond), nil
+	case "ms":
+		return int64(time.Millisecond), nil
+	case "s":
+		return int64(time.Second), nil
+	case "m":
+		return int64(time.Minute), nil
+	case "h":
+		return int64(time.Hour), nil
+	}
+	return 0, errors.New("unknown timestamp precision: " + precision)
+}
+
+// Parses lines of InfluxDB line protocol, timestamps are multiplied by `precision` (see InfluxPrecision).
+// Empty lines and comments are skipped, whole data is rejected on first malformed line
+func ParseInflux(data []byte, precision int64) ([]InfluxPoint, error) {
+	res := make([]InfluxPoint, 0)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p, err := parseInfluxLine(line, precision)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// Parses single line of InfluxDB line protocol
+func parseInfluxLine(line string, precision int64) (InfluxPoint, error) {
+	p := InfluxPoint{Tags: make(map[string]string), Fields: make(map[string]any)}
+
+	raw, rest := scanInflux(line, ", ")
+	p.Measurement = unescapeInflux(raw)
+	if p.Measurement == "" {
+		return p, errors.New("measurement is missing")
+	}
+
+	for len(rest) > 0 && rest[0] == ',' {
+		raw, rest = scanInflux(rest[1:], ", ")
+		key, value, found := cutInflux(raw)
+		if !found || key == "" || value == "" {
+			return p, errors.New("invalid tag " + raw)
+		}
+		p.Tags[key] = value
+	}
+
+	if len(rest) == 0 {
+		return p, errors.New("fields are missing")
+	}
+	rest = strings.TrimLeft(rest, " ")
+	for {
+		raw, rest = scanInflux(rest, "=, ")
+		key := unescapeInflux(raw)
+		if key == "" || len(rest) == 0 || rest[0] != '=' {
+			return p, errors.New("invalid field " + raw)
+		}
+		rest = rest[1:]
+
+		var (
+			value any
+			err   error
+		)
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, err = scanInfluxString(rest)
+		} else {
+			raw, rest = scanInflux(rest, ", ")
+			value, err = parseInfluxValue(raw)
+		}
+		if err != nil {
+			return p, fmt.Errorf("field %s: %w", key, err)
+		}
+		p.Fields[key] = value
+
+		if len(rest) == 0 || rest[0] != ',' {
+			break
+		}
+		rest = rest[1:]
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" {
+		ts, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return p, errors.New("invalid timestamp " + rest)
+		}
+		p.Timestamp = time.Unix(0, ts*precision)
+	}
+
+	return p, nil
+}
+
+// Returns part of `s` up to first unescaped character of `stops` (still escaped) and the rest starting with it
+func scanInflux(s string, stops string) (string, string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(stops, s[i]) >= 0 {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// Splits escaped `key=value` pair and unescapes its parts
+func cutInflux(s string) (string, string, bool) {
+	key, rest := scanInflux(s, "=")
+	if rest == "" {
+		return "", "", false
+	}
+	return unescapeInflux(key), unescapeInflux(rest[1:]), true
+}
+
+// Removes backslash escapes of commas, spaces, equal signs and backslashes
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, =\`, s[i+1]) >= 0 {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// Parses double quoted string field value at start of `s`, returns it and the rest of `s`
+func scanInfluxString(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			sb.WriteByte(s[i])
+		case s[i] == '"':
+			return sb.String(), s[i+1:], nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("string value is not terminated")
+}
+
+// Parses non-string field value: integer (`1i`), unsigned integer (`1u`), boolean or float
+func parseInfluxValue(s string) (any, error) {
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	case "":
+		return nil, errors.New("value is missing")
+	}
+
+	switch s[len(s)-1] {
+	case 'i':
+		return strconv.ParseInt(s[:len(s)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(s[:len(s)-1], 10, 64)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, errors.New("invalid value " + s)
+	}
+	return v, nil
+}
+
+// Returns metric of integer value written as metric of kind (see IntRule)
+func intMetric(name string, labels map[string]string, v int64, kind string) storagecommons.Metrics {
+	m := storagecommons.Metrics{ID: name, Labels: labels}
+	switch kind {
+	case IntAsCounter, IntAsDelta:
+		m.MType = "counter"
+		m.Delta = &v
+		m.Cumulative = kind == IntAsCounter
+	default:
+		f := float64(v)
+		m.MType = "gauge"
+		m.Value = &f
+	}
+	return m
+}
+
+// Converts points to metrics ordered by timestamps (points without timestamp are written at `now`).
+// Metric is named `measurement_field` (just `measurement` for `value` field), tags become its labels
+// (characters not allowed in label names are replaced by `_`).
+// Floats and booleans are written as gauges, integers according to `rules` (see IntKind), strings are skipped.
+// Storages record samples at write time, so points stamped further than MaxTimestampSkew from `now` are rejected
+func InfluxMetrics(points []InfluxPoint, rules []IntRule, now time.Time) (storagecommons.MetricsDB, error) {
+	type stamped struct {
+		ts time.Time
+		m  storagecommons.Metrics
+	}
+	batch := make([]stamped, 0, len(points))
+
+	for _, p := range points {
+		if err := checkTimestamp(p.Timestamp, now); err != nil {
+			return storagecommons.MetricsDB{}, fmt.Errorf("point of %s: %w", p.Measurement, err)
+		}
+		ts := p.Timestamp
+		if ts.IsZero() {
+			ts = now
+		}
+		var labels map[string]string
+		for k, v := range p.Tags {
+			if labels == nil {
+				labels = make(map[string]string, len(p.Tags))
+			}
+			labels[storagecommons.SanitizeLabelName(k)] = v
+		}
+
+		keys := make([]string, 0, len(p.Fields))
+		for k := range p.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			name := p.Measurement + "_" + k
+			if k == "value" {
+				name = p.Measurement
+			}
+
+			var m storagecommons.Metrics
+			switch v := p.Fields[k].(type) {
+			case float64:
+				m = storagecommons.Metrics{ID: name, MType: "gauge", Value: &v, Labels: labels}
+			case bool:
+				f := 0.0
+				if v {
+					f = 1
+				}
+				m = storagecommons.Metrics{ID: name, MType: "gauge", Value: &f, Labels: labels}
+			case int64:
+				m = intMetric(name, labels, v, IntKind(rules, name))
+			case uint64:
+				if v > math.MaxInt64 {
+					return storagecommons.MetricsDB{}, errors.New("value of " + name + " is out of range")
+				}
+				m = intMetric(name, labels, int64(v), IntKind(rules, name))
+			default:
+				continue
+			}
+			batch = append(batch, stamped{ts: ts, m: m})
+		}
+	}
+
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].ts.Before(batch[j].ts) })
+	res := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0, len(batch))}
+	for _, s := range batch {
+		res.MetricsDB = append(res.MetricsDB, s.m)
+	}
+	return res, nil
+}
@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+)
+
+func TestParseInflux(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    InfluxPoint
+		wantErr bool
+	}{
+		{
+			name: "Fields Of All Types",
+			line: `cpu,host=a,dc=x usage=0.5,procs=12i,total=7u,up=t,state="running fine" 1700000000000000000`,
+			want: InfluxPoint{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "a", "dc": "x"},
+				Fields:      map[string]any{"usage": 0.5, "procs": int64(12), "total": uint64(7), "up": true, "state": "running fine"},
+				Timestamp:   time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "Escaped Characters",
+			line: `disk\ io,path=C:\\data,mount\=point=a\,b read\ ops=1,note="say \"hi\""`,
+			want: InfluxPoint{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": `C:\data`, "mount=point": "a,b"},
+				Fields:      map[string]any{"read ops": 1.0, "note": `say "hi"`},
+			},
+		},
+		{name: "No Fields", line: "cpu,host=a", wantErr: true},
+		{name: "Empty Tag Value", line: "cpu,host= usage=1", wantErr: true},
+		{name: "Field Without Value", line: "cpu usage", wantErr: true},
+		{name: "Invalid Integer", line: "cpu procs=1.5i", wantErr: true},
+		{name: "Unterminated String", line: `cpu state="running`, wantErr: true},
+		{name: "Invalid Timestamp", line: "cpu usage=1 now", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := ParseInflux([]byte("# comment\n\n"+tt.line+"\n"), 1)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) && assert.Len(t, points, 1) {
+				assert.Equal(t, tt.want.Measurement, points[0].Measurement)
+				assert.Equal(t, tt.want.Tags, points[0].Tags)
+				assert.Equal(t, tt.want.Fields, points[0].Fields)
+				assert.True(t, tt.want.Timestamp.Equal(points[0].Timestamp))
+			}
+		})
+	}
+}
+
+func TestInfluxMetrics(t *testing.T) {
+	rules, err := ParseIntRules([]string{"net_*=counter", "jobs_done=delta"})
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	for _, bad := range []string{"bad", "x=unknown", "[=counter", "=gauge"} {
+		_, err := ParseIntRules([]string{"net_*=counter", bad})
+		assert.Error(t, err, bad)
+	}
+	assert.Error(t, CheckConfig(config.ServerConfig{InfluxIntRules: []string{"jobs_*=countr"}}))
+
+	now := time.Unix(1700000100, 0)
+	points, err := ParseInflux([]byte("net bytes=200i 1700000130000000000\nnet bytes=100i 1700000070000000000\njobs done=3i,queued=4i\nlog msg=\"text\""), 1)
+	assert.NoError(t, err)
+
+	mdb, err := InfluxMetrics(points, rules, now)
+	if assert.NoError(t, err) && assert.Len(t, mdb.MetricsDB, 4) {
+		// Writes are ordered by timestamps, points without timestamp are written at `now`
+		assert.Equal(t, int64(100), *mdb.MetricsDB[0].Delta)
+		assert.True(t, mdb.MetricsDB[0].Cumulative)
+		assert.Equal(t, "jobs_done", mdb.MetricsDB[1].ID)
+		assert.Equal(t, "counter", mdb.MetricsDB[1].MType)
+		assert.False(t, mdb.MetricsDB[1].Cumulative)
+		assert.Equal(t, "jobs_queued", mdb.MetricsDB[2].ID)
+		assert.Equal(t, "gauge", mdb.MetricsDB[2].MType)
+		assert.Equal(t, int64(200), *mdb.MetricsDB[3].Delta)
+	}
+
+	// Tag names not allowed as label names are sanitized
+	points, err = ParseInflux([]byte("disk,mount-point=/ used=1"), 1)
+	assert.NoError(t, err)
+	mdb, err = InfluxMetrics(points, rules, now)
+	if assert.NoError(t, err) && assert.Len(t, mdb.MetricsDB, 1) {
+		assert.Equal(t, map[string]string{"mount_point": "/"}, mdb.MetricsDB[0].Labels)
+	}
+
+	// Storages record samples at write time, so stale points are rejected
+	points, err = ParseInflux([]byte("net bytes=300i 1700000200000000000\njobs done=3i"), 1)
+	assert.NoError(t, err)
+	_, err = InfluxMetrics(points, rules, now)
+	assert.Error(t, err)
+}
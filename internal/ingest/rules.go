@@ -0,0 +1,53 @@
+package ingest
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// Kinds of metrics integer values are written as
+const (
+	IntAsCounter = "counter" // Cumulative counter, increments are computed by server
+	IntAsDelta   = "delta"   // Counter increment
+	IntAsGauge   = "gauge"
+)
+
+// Rule choosing kind of metric integer values of matching metric names are written as
+type IntRule struct {
+	Pattern string // Metric name pattern (see path.Match)
+	Kind    string
+}
+
+// Parses rules given as "pattern=kind" strings.
+// Fails on first invalid rule, as metric written with wrong kind gets its type locked
+func ParseIntRules(rules []string) ([]IntRule, error) {
+	res := make([]IntRule, 0, len(rules))
+	for _, r := range rules {
+		pattern, kind, found := strings.Cut(r, "=")
+		pattern, kind = strings.TrimSpace(pattern), strings.TrimSpace(kind)
+		if !found || pattern == "" {
+			return nil, errors.New("invalid integer rule " + r + ": pattern=kind expected")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("invalid pattern of integer rule " + r)
+		}
+		switch kind {
+		case IntAsCounter, IntAsDelta, IntAsGauge:
+			res = append(res, IntRule{Pattern: pattern, Kind: kind})
+		default:
+			return nil, errors.New("unknown kind of integer rule " + r)
+		}
+	}
+	return res, nil
+}
+
+// Returns kind of first rule matching metric name (gauge if none matches)
+func IntKind(rules []IntRule, name string) string {
+	for _, r := range rules {
+		if ok, _ := path.Match(r.Pattern, name); ok {
+			return r.Kind
+		}
+	}
+	return IntAsGauge
+}
@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Ways StatsD timers are written
+const (
+	TimersAsHistogram = "histogram" // Histogram of timer values
+	TimersAsSummary   = "summary"   // Gauges of timer statistics of flush interval: `name.count`, `name.mean`, `name.p90`, ...
+)
+
+// Quantiles of timers written as summary gauges
+var statsDQuantiles = []float64{0.5, 0.9, 0.99}
+
+// StatsD sample: `name:value|type[|@rate][|#tag:value,...]`
+type StatsDSample struct {
+	Name     string
+	Value    float64
+	Type     string // c, g, ms, h, d or s
+	Relative bool   // Signed gauge value changes previous one
+	Rate     float64
+	Labels   map[string]string // DogStatsD tags (tags without value are skipped, see storagecommons.SanitizeLabelName)
+	Set      string            // Raw value of set sample
+}
+
+// Parses StatsD line (DogStatsD tags supported)
+func ParseStatsD(line string) (StatsDSample, error) {
+	s := StatsDSample{Rate: 1}
+
+	name, rest, found := strings.Cut(line, ":")
+	if !found || name == "" {
+		return s, errors.New("invalid StatsD line: " + line)
+	}
+	s.Name = name
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return s, errors.New("metric type is missing: " + line)
+	}
+	s.Type = parts[1]
+
+	value := parts[0]
+	switch s.Type {
+	case "s":
+		s.Set = value
+	case "c", "g", "ms", "h", "d":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return s, errors.New("invalid value: " + line)
+		}
+		s.Value = v
+		s.Relative = s.Type == "g" && (value[0] == '+' || value[0] == '-')
+	default:
+		return s, errors.New("unknown metric type: " + line)
+	}
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return s, errors.New("invalid sample rate: " + line)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(part, "#"):
+			for _, tag := range strings.Split(part[1:], ",") {
+				k, v, found := strings.Cut(tag, ":")
+				if !found || k == "" {
+					continue
+				}
+				if s.Labels == nil {
+					s.Labels = make(map[string]string)
+				}
+				s.Labels[storagecommons.SanitizeLabelName(k)] = v
+			}
+		}
+		// Other DogStatsD fields (container ID, timestamp) are ignored
+	}
+
+	return s, nil
+}
+
+// StatsD series state of flush interval
+type statsDSeries struct {
+	name    string
+	labels  map[string]string
+	typ     string
+	counter float64
+	gauge   float64
+	updated bool
+	values  []float64 // Timer values
+	weights []float64 // Timer value weights (reciprocal of sample rate)
+	set     map[string]struct{}
+}
+
+// Aggregates StatsD samples by flush intervals
+type StatsDAggregator struct {
+	mu      sync.Mutex
+	series  map[string]*statsDSeries
+	timers  string
+	buckets []float64
+}
+
+// Returns aggregator writing timers as `timers` (see TimersAsHistogram), histograms get `buckets` bounds
+func NewStatsDAggregator(timers string, buckets []float64) *StatsDAggregator {
+	return &StatsDAggregator{series: make(map[string]*statsDSeries), timers: timers, buckets: slices.Clone(buckets)}
+}
+
+// Adds sample to current flush interval
+func (a *StatsDAggregator) Add(s StatsDSample) {
+	typ := s.Type
+	if typ == "h" || typ == "d" {
+		typ = "ms"
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := typ + "/" + storagecommons.SeriesKey(s.Name, s.Labels)
+	ser, ok := a.series[key]
+	if !ok {
+		ser = &statsDSeries{name: s.Name, labels: s.Labels, typ: typ}
+		a.series[key] = ser
+	}
+
+	switch typ {
+	case "c":
+		ser.counter += s.Value / s.Rate
+	case "g":
+		if s.Relative {
+			ser.gauge += s.Value
+		} else {
+			ser.gauge = s.Value
+		}
+	case "ms":
+		ser.values = append(ser.values, s.Value)
+		ser.weights = append(ser.weights, 1/s.Rate)
+	case "s":
+		if ser.set == nil {
+			ser.set = make(map[string]struct{})
+		}
+		ser.set[s.Set] = struct{}{}
+	}
+	ser.updated = true
+}
+
+// Returns metrics of flush interval and starts next one.
+// Only series updated within interval are written. Counters are written as increments (rounded, remainders are carried to next interval),
+// gauges keep values between intervals for relative changes, sets are written as gauges of unique values number
+func (a *StatsDAggregator) Flush() storagecommons.MetricsDB {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keys := make([]string, 0, len(a.series))
+	for k, ser := range a.series {
+		if ser.updated {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	res := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0, len(keys))}
+	for _, k := range keys {
+		ser := a.series[k]
+		switch ser.typ {
+		case "c":
+			delta := int64(math.Round(ser.counter))
+			ser.counter -= float64(delta)
+			if delta != 0 {
+				res.MetricsDB = append(res.MetricsDB, storagecommons.Metrics{ID: ser.name, MType: "counter", Delta: &delta, Labels: ser.labels})
+			}
+		case "g":
+			v := ser.gauge
+			res.MetricsDB = append(res.MetricsDB, storagecommons.Metrics{ID: ser.name, MType: "gauge", Value: &v, Labels: ser.labels})
+		case "ms":
+			res.MetricsDB = append(res.MetricsDB, a.timerMetrics(ser)...)
+			ser.values, ser.weights = nil, nil
+		case "s":
+			v := float64(len(ser.set))
+			res.MetricsDB = append(res.MetricsDB, storagecommons.Metrics{ID: ser.name, MType: "gauge", Value: &v, Labels: ser.labels})
+			ser.set = nil
+		}
+		ser.updated = false
+	}
+
+	// Only gauges and counter remainders are kept between intervals
+	for k, ser := range a.series {
+		if ser.typ != "g" && (ser.typ != "c" || ser.counter == 0) {
+			delete(a.series, k)
+		}
+	}
+	return res
+}
+
+// Returns metrics of timer values of flush interval
+func (a *StatsDAggregator) timerMetrics(ser *statsDSeries) []storagecommons.Metrics {
+	if a.timers == TimersAsSummary {
+		return timerSummary(ser)
+	}
+
+	h := storagecommons.NewHistogram(a.buckets)
+	for i, v := range ser.values {
+		n := int64(math.Round(ser.weights[i]))
+		h.Counts[sort.SearchFloat64s(h.Bounds, v)] += n
+		h.Sum += v * float64(n)
+		h.Count += n
+	}
+	return []storagecommons.Metrics{{ID: ser.name, MType: "histogram", Histogram: &h, Labels: ser.labels}}
+}
+
+// Returns gauges of timer statistics: count (sample rates applied), sum, mean, min, max and quantiles
+func timerSummary(ser *statsDSeries) []storagecommons.Metrics {
+	values := slices.Clone(ser.values)
+	sort.Float64s(values)
+
+	var count, sum float64
+	for i, v := range ser.values {
+		count += ser.weights[i]
+		sum += v * ser.weights[i]
+	}
+	type stat struct {
+		suffix string
+		value  float64
+	}
+	stats := []stat{
+		{"count", count},
+		{"sum", sum},
+		{"mean", sum / count},
+		{"min", values[0]},
+		{"max", values[len(values)-1]},
+	}
+	for _, q := range statsDQuantiles {
+		idx := int(math.Ceil(q*float64(len(values)))) - 1
+		stats = append(stats, stat{"p" + strconv.FormatFloat(q*100, 'f', -1, 64), values[max(idx, 0)]})
+	}
+
+	res := make([]storagecommons.Metrics, 0, len(stats))
+	for _, s := range stats {
+		v := s.value
+		res = append(res, storagecommons.Metrics{ID: ser.name + "." + s.suffix, MType: "gauge", Value: &v, Labels: ser.labels})
+	}
+	return res
+}
@@ -0,0 +1,156 @@
+package ingest
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func TestParseStatsD(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    StatsDSample
+		wantErr bool
+	}{
+		{name: "Counter", line: "hits:3|c", want: StatsDSample{Name: "hits", Value: 3, Type: "c", Rate: 1}},
+		{name: "Sampled Counter", line: "hits:1|c|@0.1", want: StatsDSample{Name: "hits", Value: 1, Type: "c", Rate: 0.1}},
+		{name: "Gauge Change", line: "queue:-2|g", want: StatsDSample{Name: "queue", Value: -2, Type: "g", Relative: true, Rate: 1}},
+		{
+			name: "DogStatsD Tags",
+			line: "latency:12.5|ms|@0.5|#host:a,env:prod,canary",
+			want: StatsDSample{Name: "latency", Value: 12.5, Type: "ms", Rate: 0.5, Labels: map[string]string{"host": "a", "env": "prod"}},
+		},
+		{
+			name: "Tag Names Sanitized",
+			line: "latency:1|ms|#host.name:a,1dc:x",
+			want: StatsDSample{Name: "latency", Value: 1, Type: "ms", Rate: 1, Labels: map[string]string{"host_name": "a", "_1dc": "x"}},
+		},
+		{name: "Set", line: "users:alice|s", want: StatsDSample{Name: "users", Type: "s", Rate: 1, Set: "alice"}},
+		{name: "No Value", line: "hits|c", wantErr: true},
+		{name: "No Type", line: "hits:1", wantErr: true},
+		{name: "Unknown Type", line: "hits:1|x", wantErr: true},
+		{name: "Invalid Value", line: "hits:one|c", wantErr: true},
+		{name: "Invalid Rate", line: "hits:1|c|@2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStatsD(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+// Returns metrics of flush result by their IDs
+func flushed(a *StatsDAggregator) map[string]storagecommons.Metrics {
+	res := make(map[string]storagecommons.Metrics)
+	for _, m := range a.Flush().MetricsDB {
+		res[m.ID] = m
+	}
+	return res
+}
+
+func TestStatsDAggregator(t *testing.T) {
+	add := func(a *StatsDAggregator, lines ...string) {
+		for _, line := range lines {
+			s, err := ParseStatsD(line)
+			if assert.NoError(t, err) {
+				a.Add(s)
+			}
+		}
+	}
+
+	t.Run("Counters And Gauges", func(t *testing.T) {
+		a := NewStatsDAggregator(TimersAsHistogram, nil)
+		add(a, "hits:1|c", "hits:2|c", "hits:1|c|@0.3", "queue:5|g", "queue:+2|g", "users:a|s", "users:b|s", "users:a|s")
+		res := flushed(a)
+		assert.Equal(t, int64(6), *res["hits"].Delta)
+		assert.Equal(t, 7.0, *res["queue"].Value)
+		assert.Equal(t, 2.0, *res["users"].Value)
+
+		// Counter remainder is carried, gauge keeps value, set is reset
+		add(a, "hits:1|c|@0.3", "queue:-1|g")
+		res = flushed(a)
+		assert.Equal(t, int64(4), *res["hits"].Delta)
+		assert.Equal(t, 6.0, *res["queue"].Value)
+		assert.NotContains(t, res, "users")
+
+		// Not updated series are not written
+		assert.Empty(t, flushed(a))
+	})
+
+	t.Run("Timers As Histogram", func(t *testing.T) {
+		a := NewStatsDAggregator(TimersAsHistogram, []float64{10, 100})
+		add(a, "req:5|ms", "req:50|ms|@0.5", "req:500|h")
+		res := flushed(a)
+		h := res["req"].Histogram
+		if assert.NotNil(t, h) {
+			assert.Equal(t, []int64{1, 2, 1}, h.Counts)
+			assert.Equal(t, int64(4), h.Count)
+			assert.Equal(t, 605.0, h.Sum)
+		}
+		assert.Nil(t, flushed(a)["req"].Histogram)
+	})
+
+	t.Run("Timers As Summary", func(t *testing.T) {
+		a := NewStatsDAggregator(TimersAsSummary, nil)
+		add(a, "req:10|ms", "req:20|ms", "req:30|ms", "req:40|ms")
+		res := flushed(a)
+		want := map[string]float64{"req.count": 4, "req.sum": 100, "req.mean": 25, "req.min": 10, "req.max": 40, "req.p50": 20, "req.p90": 40, "req.p99": 40}
+		for id, v := range want {
+			if assert.Contains(t, res, id) {
+				assert.Equal(t, v, *res[id].Value, id)
+			}
+		}
+	})
+}
+
+func TestStatsDServer(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	db, err := filestore.New(ctx, config.ServerConfig{}, logger)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	gauge := 1.0
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "taken", MType: "gauge", Value: &gauge})
+	assert.NoError(t, err)
+
+	srv := NewStatsDServer(db, config.ServerConfig{StatsDAddress: "127.0.0.1:0", StatsDFlushInterval: time.Hour}, logger)
+	srv.ListenAndServeAsync()
+	if !assert.NotNil(t, srv.Addr()) {
+		return
+	}
+
+	conn, err := net.Dial("udp", srv.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("hits:2|c\nhits:3|c|#host:a\ngarbage\ntaken:1|c\nqueue:4|g\n"))
+	assert.NoError(t, err)
+
+	// Aggregates are written on shutdown, conflicting metric doesn't block others
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, srv.Shutdown(ctx))
+
+	counters, _ := db.GetCounters().ReadData(ctx)
+	assert.Equal(t, int64(2), counters["hits"])
+	assert.Equal(t, int64(3), counters[storagecommons.SeriesKey("hits", map[string]string{"host": "a"})])
+	assert.NotContains(t, counters, "taken")
+	gauges, _ := db.GetGauges().ReadData(ctx)
+	assert.Equal(t, 4.0, gauges["queue"])
+}
@@ -0,0 +1,136 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Max size of UDP datagram
+const maxStatsDPacket = 65535
+
+// UDP server receiving StatsD samples and writing their aggregates to storage by flush intervals
+type StatsDServer struct {
+	addr          string
+	flushInterval time.Duration
+	aggregator    *StatsDAggregator
+	dataStorage   storagecommons.Storager
+	logger        *zap.Logger
+	conn          net.PacketConn
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// Returns StatsD server configured by cfg (nil if StatsD address is not set)
+func NewStatsDServer(dataStorage storagecommons.Storager, cfg config.ServerConfig, logger *zap.Logger) *StatsDServer {
+	if cfg.StatsDAddress == "" {
+		return nil
+	}
+	flushInterval := cfg.StatsDFlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Second
+	}
+	return &StatsDServer{
+		addr:          cfg.StatsDAddress,
+		flushInterval: flushInterval,
+		aggregator:    NewStatsDAggregator(cfg.StatsDTimers, cfg.StatsDTimerBuckets),
+		dataStorage:   dataStorage,
+		logger:        logger,
+		done:          make(chan struct{}),
+	}
+}
+
+func (s *StatsDServer) ListenAndServeAsync() {
+	var err error
+	s.conn, err = net.ListenPacket("udp", s.addr)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return
+	}
+	s.logger.Info("StatsD server running at " + s.conn.LocalAddr().String())
+
+	s.wg.Add(2)
+	go s.serve()
+	go s.flushLoop()
+}
+
+// Returns address server listens on (nil if it is not started)
+func (s *StatsDServer) Addr() net.Addr {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr()
+}
+
+// Stops receiving samples and writes aggregates of current flush interval
+func (s *StatsDServer) Shutdown(ctx context.Context) error {
+	if s == nil || s.conn == nil {
+		return nil
+	}
+	close(s.done)
+	err := s.conn.Close()
+	s.wg.Wait()
+	s.flush(ctx)
+	return err
+}
+
+// Reads packets of newline separated samples, malformed samples are skipped
+func (s *StatsDServer) serve() {
+	defer s.wg.Done()
+	buf := make([]byte, maxStatsDPacket)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error(err.Error())
+			continue
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			sample, err := ParseStatsD(line)
+			if err != nil {
+				s.logger.Debug(err.Error())
+				continue
+			}
+			s.aggregator.Add(sample)
+		}
+	}
+}
+
+func (s *StatsDServer) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.flush(context.Background())
+		}
+	}
+}
+
+func (s *StatsDServer) flush(ctx context.Context) {
+	writeMetrics(ctx, s.dataStorage, s.aggregator.Flush(), s.logger)
+}
+
+// Writes metrics one by one, so metric rejected by storage (e.g. of conflicting type) doesn't prevent writing others
+func writeMetrics(ctx context.Context, dataStorage storagecommons.Storager, metrics storagecommons.MetricsDB, logger *zap.Logger) {
+	for _, m := range metrics.MetricsDB {
+		if _, err := dataStorage.WriteData(ctx, m); err != nil {
+			logger.Info("metric " + m.ID + " is not written: " + err.Error())
+		}
+	}
+}
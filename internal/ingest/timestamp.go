@@ -0,0 +1,22 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+)
+
+// Max difference of point timestamp from time it is received.
+// Storages record samples at write time, so points stamped further in the past or future are rejected
+// instead of being recorded at wrong time
+const MaxTimestampSkew = time.Minute
+
+// Returns error if point timestamp `ts` (zero if not given) can't be recorded as write time `now`
+func checkTimestamp(ts time.Time, now time.Time) error {
+	if ts.IsZero() {
+		return nil
+	}
+	if d := ts.Sub(now); d > MaxTimestampSkew || d < -MaxTimestampSkew {
+		return fmt.Errorf("timestamp %s differs from receive time by more than %s", ts.UTC().Format(time.RFC3339), MaxTimestampSkew)
+	}
+	return nil
+}
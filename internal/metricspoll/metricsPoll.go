@@ -178,6 +178,7 @@ func (ths *MetricsHandler) prepareData() storagecommons.MetricsDB {
 		var dta_ storagecommons.Metrics
 		dta_.MType = v.typ
 		dta_.ID = k
+		dta_.Labels = ths.cfg.Labels
 		switch dta_.MType {
 		case "gauge":
 			dta_.Value = &v.value
@@ -215,6 +216,9 @@ func (ths *MetricsHandler) SendDataHTTP(ctx context.Context, data storagecommons
 	if ths.cfg.RealIP != nil {
 		req.Header.Set("X-Real-IP", ths.cfg.RealIP.String())
 	}
+	if ths.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", ths.cfg.APIKey)
+	}
 
 	addHmacSha256(req, jm, ths.cfg.Key)
 
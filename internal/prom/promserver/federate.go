@@ -0,0 +1,177 @@
+package promserver
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Quantiles of stored summaries exposed to Prometheus
+var federateQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Exposes stored metrics in Prometheus exposition format (format is negotiated by Accept header)
+//
+// Optional `match[]` URL query parameters (series selectors) limit result to series matching any of them
+func federateHandler(dataStorage storagecommons.Storager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		selectors := make([]seriesSelector, 0)
+		for _, s := range req.URL.Query()["match[]"] {
+			sel, err := parseSelector(s)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			selectors = append(selectors, sel)
+		}
+
+		families, err := storedFamilies(req.Context(), dataStorage, selectors)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := expfmt.Negotiate(req.Header)
+		res.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(res, format)
+		for _, f := range families {
+			if err = enc.Encode(f); err != nil {
+				return
+			}
+		}
+		if closer, ok := enc.(expfmt.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// Collects metric families of stored series matching any of `selectors` (all series if none given).
+// Stored names and label names are sanitized to be valid in Prometheus
+type familyBuilder struct {
+	selectors []seriesSelector
+	help      map[string]string
+	families  map[string]*dto.MetricFamily
+}
+
+// Adds metric of series with key `key` (see SeriesKey) to family of its type (if series is selected)
+func (fb *familyBuilder) add(key string, mtype dto.MetricType, metric *dto.Metric) {
+	id, labels, err := storagecommons.ParseSeriesKey(key)
+	if err != nil {
+		return
+	}
+	name := sanitizeName(id, true)
+
+	all := map[string]string{"__name__": name}
+	for k, v := range labels {
+		k = sanitizeName(k, false)
+		all[k] = v
+		metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(k), Value: proto.String(v)})
+	}
+	if len(fb.selectors) > 0 {
+		selected := false
+		for _, sel := range fb.selectors {
+			if sel.matches(all) {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return
+		}
+	}
+	sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+
+	f, ok := fb.families[name]
+	if !ok {
+		f = &dto.MetricFamily{Name: proto.String(name), Type: mtype.Enum()}
+		if help := fb.help[id]; help != "" {
+			f.Help = proto.String(help)
+		}
+		fb.families[name] = f
+	}
+	// Names of different types may become equal after sanitizing, such series are skipped
+	if f.GetType() != mtype {
+		return
+	}
+	f.Metric = append(f.Metric, metric)
+}
+
+// Returns stored metrics as Prometheus metric families ordered by name
+func storedFamilies(ctx context.Context, dataStorage storagecommons.Storager, selectors []seriesSelector) ([]*dto.MetricFamily, error) {
+	fb := familyBuilder{selectors: selectors, help: make(map[string]string), families: make(map[string]*dto.MetricFamily)}
+
+	mds, err := dataStorage.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range mds {
+		fb.help[md.Name] = md.Help
+	}
+
+	gauges, err := dataStorage.GetGauges().ReadData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range gauges {
+		fb.add(k, dto.MetricType_GAUGE, &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(v)}})
+	}
+
+	counters, err := dataStorage.GetCounters().ReadData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range counters {
+		fb.add(k, dto.MetricType_COUNTER, &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(float64(v))}})
+	}
+
+	histograms, err := dataStorage.GetHistograms().ReadData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range histograms {
+		h := &dto.Histogram{SampleCount: proto.Uint64(uint64(v.Count)), SampleSum: proto.Float64(v.Sum)}
+		var cumulative int64
+		for i, bound := range v.Bounds {
+			cumulative += v.Counts[i]
+			h.Bucket = append(h.Bucket, &dto.Bucket{UpperBound: proto.Float64(bound), CumulativeCount: proto.Uint64(uint64(cumulative))})
+		}
+		fb.add(k, dto.MetricType_HISTOGRAM, &dto.Metric{Histogram: h})
+	}
+
+	summaries, err := dataStorage.GetSummaries().ReadData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range summaries {
+		s := &dto.Summary{SampleCount: proto.Uint64(uint64(v.Count)), SampleSum: proto.Float64(v.Sum)}
+		for _, q := range federateQuantiles {
+			value, err := v.Quantile(q)
+			if err != nil {
+				continue
+			}
+			s.Quantile = append(s.Quantile, &dto.Quantile{Quantile: proto.Float64(q), Value: proto.Float64(value)})
+		}
+		fb.add(k, dto.MetricType_SUMMARY, &dto.Metric{Summary: s})
+	}
+
+	res := make([]*dto.MetricFamily, 0, len(fb.families))
+	for _, f := range fb.families {
+		sort.Slice(f.Metric, func(i, j int) bool { return labelsString(f.Metric[i]) < labelsString(f.Metric[j]) })
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].GetName() < res[j].GetName() })
+	return res, nil
+}
+
+// Returns labels of metric as string used for ordering
+func labelsString(m *dto.Metric) string {
+	res := ""
+	for _, l := range m.Label {
+		res += l.GetName() + "\x00" + l.GetValue() + "\x00"
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+package promserver
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		labels   map[string]string
+		want     bool
+		wantErr  bool
+	}{
+		{selector: "up", labels: map[string]string{"__name__": "up"}, want: true},
+		{selector: "up", labels: map[string]string{"__name__": "down"}, want: false},
+		{selector: `up{host="a"}`, labels: map[string]string{"__name__": "up", "host": "a"}, want: true},
+		{selector: `up{host!="a"}`, labels: map[string]string{"__name__": "up", "host": "a"}, want: false},
+		{selector: `{__name__=~"Heap.*", host!~"b|c"}`, labels: map[string]string{"__name__": "HeapAlloc"}, want: true},
+		{selector: `{__name__=~"Heap"}`, labels: map[string]string{"__name__": "HeapAlloc"}, want: false},
+		{selector: `{host="a\"b"}`, labels: map[string]string{"host": `a"b`}, want: true},
+		{selector: `{}`, wantErr: true},
+		{selector: `up{host=a}`, wantErr: true},
+		{selector: `up{host="a"`, wantErr: true},
+		{selector: `up{host~"a"}`, wantErr: true},
+		{selector: `{host=~"("}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := parseSelector(tt.selector)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, sel.matches(tt.labels))
+			}
+		})
+	}
+}
+
+func TestFederate(t *testing.T) {
+	ctx := context.Background()
+	db, err := filestore.New(ctx, config.ServerConfig{}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	var (
+		d    int64 = 5
+		v1         = 1.5
+		v2         = 2.5
+		hist       = storagecommons.Histogram{Bounds: []float64{1, 10}, Counts: []int64{1, 2, 0}, Sum: 12, Count: 3}
+	)
+	err = db.WriteDataMulti(ctx, storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &d, Help: "Number of polls"},
+		{ID: "Heap.Alloc", MType: "gauge", Value: &v1, Labels: map[string]string{"host": "a"}},
+		{ID: "Heap.Alloc", MType: "gauge", Value: &v2, Labels: map[string]string{"host": "b"}},
+		{ID: "Latency", MType: "histogram", Histogram: &hist},
+	}})
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(federateHandler(db))
+	defer srv.Close()
+
+	get := func(t *testing.T, matches ...string) (int, string) {
+		query := url.Values{"match[]": matches}
+		resp, err := http.Get(srv.URL + "?" + query.Encode())
+		if !assert.NoError(t, err) {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("All Metrics", func(t *testing.T) {
+		status, body := get(t)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, "# HELP PollCount Number of polls\n# TYPE PollCount counter\nPollCount 5\n")
+		assert.Contains(t, body, "# TYPE Heap_Alloc gauge\nHeap_Alloc{host=\"a\"} 1.5\nHeap_Alloc{host=\"b\"} 2.5\n")
+		assert.Contains(t, body, `Latency_bucket{le="10"} 3`)
+		assert.Contains(t, body, `Latency_bucket{le="+Inf"} 3`)
+		assert.Contains(t, body, "Latency_count 3")
+	})
+
+	t.Run("Matched Metrics", func(t *testing.T) {
+		status, body := get(t, `Heap_Alloc{host="b"}`, "PollCount")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `Heap_Alloc{host="b"} 2.5`)
+		assert.Contains(t, body, "PollCount 5")
+		assert.NotContains(t, body, `host="a"`)
+		assert.False(t, strings.Contains(body, "Latency"))
+	})
+
+	t.Run("Invalid Selector", func(t *testing.T) {
+		status, _ := get(t, `PollCount{`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
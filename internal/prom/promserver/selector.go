@@ -0,0 +1,164 @@
+package promserver
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Label matcher of series selector
+type labelMatcher struct {
+	name  string
+	op    string // one of =, !=, =~, !~
+	value string
+	re    *regexp.Regexp
+}
+
+// Prometheus series selector: `name{label="value", ...}`, name is matched as `__name__` label
+type seriesSelector []labelMatcher
+
+// Checks if label value satisfies matcher (absent label has empty value)
+func (m labelMatcher) matches(value string) bool {
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// Checks if series labels (including `__name__`) satisfy all matchers of selector
+func (s seriesSelector) matches(labels map[string]string) bool {
+	for _, m := range s {
+		if !m.matches(labels[m.name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parses series selector like `up`, `http_requests{code=~"5..", method!="GET"}` or `{__name__="up"}`
+func parseSelector(s string) (seriesSelector, error) {
+	s = strings.TrimSpace(s)
+	res := make(seriesSelector, 0)
+
+	name := s
+	if pos := strings.IndexByte(s, '{'); pos >= 0 {
+		name = strings.TrimSpace(s[:pos])
+		if !strings.HasSuffix(s, "}") {
+			return nil, errors.New("selector is not closed: " + s)
+		}
+		matchers, err := parseMatchers(s[pos+1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, matchers...)
+	}
+	if name != "" {
+		if !isValidName(name, true) {
+			return nil, errors.New("invalid metric name in selector: " + name)
+		}
+		res = append(res, labelMatcher{name: "__name__", op: "=", value: name})
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New("selector must have metric name or label matchers")
+	}
+	return res, nil
+}
+
+// Parses comma separated label matchers
+func parseMatchers(s string) ([]labelMatcher, error) {
+	res := make([]labelMatcher, 0)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return res, nil
+		}
+
+		end := strings.IndexAny(s, "=!")
+		if end <= 0 {
+			return nil, errors.New("invalid label matcher: " + s)
+		}
+		var m labelMatcher
+		m.name = strings.TrimSpace(s[:end])
+		if !isValidName(m.name, false) {
+			return nil, errors.New("invalid label name: " + m.name)
+		}
+		s = s[end:]
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, op) {
+				m.op = op
+				break
+			}
+		}
+		if m.op == "" {
+			return nil, errors.New("invalid matcher operator: " + s)
+		}
+		s = strings.TrimLeft(s[len(m.op):], " \t")
+
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil || quoted[0] == '\'' {
+			return nil, errors.New("label value must be double quoted: " + s)
+		}
+		m.value, _ = strconv.Unquote(quoted)
+		s = strings.TrimLeft(s[len(quoted):], " \t")
+
+		if m.op == "=~" || m.op == "!~" {
+			// Regular expressions are fully anchored, as in Prometheus
+			m.re, err = regexp.Compile("^(?:" + m.value + ")$")
+			if err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, m)
+
+		if s == "" {
+			return res, nil
+		}
+		if s[0] != ',' {
+			return nil, errors.New("label matchers must be separated by comma: " + s)
+		}
+		s = s[1:]
+	}
+}
+
+// Checks if string is valid Prometheus metric name (colons allowed) or label name
+func isValidName(s string, metric bool) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		ok := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') || (metric && r == ':')
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns valid Prometheus metric or label name made of `s` by replacing invalid characters with underscores
+func sanitizeName(s string, metric bool) string {
+	if isValidName(s, metric) {
+		return s
+	}
+	var sb strings.Builder
+	for i, r := range s {
+		if isValidName(string(r), metric) || (i > 0 && r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			continue
+		}
+		if i == 0 && r >= '0' && r <= '9' {
+			sb.WriteByte('_')
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteByte('_')
+	}
+	return sb.String()
+}
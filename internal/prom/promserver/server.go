@@ -4,6 +4,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"net/http"
+	"yaprakticum-go-track2/internal/handlers/middleware"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
 type PromServer struct {
@@ -11,11 +13,15 @@ type PromServer struct {
 	logger *zap.Logger
 }
 
-func NewServer(addr string, logger *zap.Logger) *PromServer {
+// Returns server exposing server telemetry and stored metrics (at /federate, scoped to tenant of API key)
+func NewServer(addr string, dataStorage storagecommons.Storager, tenantKeys map[string]string, logger *zap.Logger) *PromServer {
 	if addr == "" {
 		return nil
 	}
-	return &PromServer{Server: http.Server{Addr: addr, Handler: promhttp.Handler()}, logger: logger}
+	mux := http.NewServeMux()
+	mux.Handle("/federate", middleware.WithTenant(tenantKeys)(federateHandler(dataStorage)))
+	mux.Handle("/", promhttp.Handler())
+	return &PromServer{Server: http.Server{Addr: addr, Handler: mux}, logger: logger}
 }
 
 func (ps *PromServer) ListenAndServeAsync() {
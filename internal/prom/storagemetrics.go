@@ -0,0 +1,143 @@
+package prom
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Storage layer instrumentation, exposed by promserver along with HTTP metrics
+type StorageMetrics struct {
+	OpDuration    *prometheus.HistogramVec
+	BatchSize     *prometheus.HistogramVec
+	FlushDuration *prometheus.HistogramVec
+	FlushErrors   *prometheus.CounterVec
+	DumpDuration  *prometheus.HistogramVec
+	DumpSize      *prometheus.GaugeVec
+	register      prometheus.Registerer
+	series        *seriesCollector
+}
+
+var (
+	storageMetrics     *StorageMetrics
+	storageMetricsOnce sync.Once
+)
+
+// Returns storage metrics registered in default registry
+func Storage() *StorageMetrics {
+	storageMetricsOnce.Do(func() {
+		storageMetrics = newStorageMetrics(prometheus.DefaultRegisterer)
+	})
+	return storageMetrics
+}
+
+func newStorageMetrics(reg prometheus.Registerer) *StorageMetrics {
+	latencyBuckets := []float64{0.01 * 0.001, 0.1 * 0.001, 1 * 0.001, 10 * 0.001, 100 * 0.001, 1000 * 0.001, 10000 * 0.001}
+	m := &StorageMetrics{
+		OpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "operation_duration_seconds",
+			Help:    "Storage operations latency",
+			Buckets: latencyBuckets,
+		}, []string{"backend", "operation"}),
+		BatchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "batch_size",
+			Help:    "Number of metrics in written batches",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}, []string{"backend"}),
+		FlushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "flush_duration_seconds",
+			Help:    "Delayed writes flush duration",
+			Buckets: latencyBuckets,
+		}, []string{"backend"}),
+		FlushErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flush_errors_total",
+			Help: "Failed delayed writes flushes",
+		}, []string{"backend"}),
+		DumpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dump_duration_seconds",
+			Help:    "Snapshot dump duration",
+			Buckets: latencyBuckets,
+		}, []string{"backend"}),
+		DumpSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dump_size_bytes",
+			Help: "Size of last dumped snapshot",
+		}, []string{"backend"}),
+		series: &seriesCollector{
+			desc: prometheus.NewDesc("series", "Number of stored series", []string{"tenant", "type"}, nil),
+		},
+	}
+
+	m.register = prometheus.WrapRegistererWithPrefix("ypmetricssrv_storage_", reg)
+
+	m.register.MustRegister(
+		m.OpDuration,
+		m.BatchSize,
+		m.FlushDuration,
+		m.FlushErrors,
+		m.DumpDuration,
+		m.DumpSize,
+		m.series,
+	)
+
+	return m
+}
+
+func (m *StorageMetrics) ObserveOp(backend, operation string, start time.Time) {
+	m.OpDuration.With(prometheus.Labels{"backend": backend, "operation": operation}).Observe(time.Since(start).Seconds())
+}
+
+func (m *StorageMetrics) ObserveBatch(backend string, size int) {
+	m.BatchSize.With(prometheus.Labels{"backend": backend}).Observe(float64(size))
+}
+
+func (m *StorageMetrics) ObserveFlush(backend string, start time.Time, err error) {
+	m.FlushDuration.With(prometheus.Labels{"backend": backend}).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.FlushErrors.With(prometheus.Labels{"backend": backend}).Inc()
+	}
+}
+
+func (m *StorageMetrics) ObserveDump(backend string, start time.Time, size int) {
+	m.DumpDuration.With(prometheus.Labels{"backend": backend}).Observe(time.Since(start).Seconds())
+	m.DumpSize.With(prometheus.Labels{"backend": backend}).Set(float64(size))
+}
+
+// Exposes connection pool stats of DB. Pools registered under the same name are counted once
+func (m *StorageMetrics) RegisterDB(name string, db *sql.DB) {
+	m.register.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Sets function returning number of stored series by tenant and metric type, called on each scrape.
+// Key of source result is {tenant, type}
+func (m *StorageMetrics) SetSeriesSource(f func() map[[2]string]int) {
+	m.series.mutex.Lock()
+	defer m.series.mutex.Unlock()
+	m.series.source = f
+}
+
+// Collector of stored series number, which is requested from storage on scrape
+type seriesCollector struct {
+	desc   *prometheus.Desc
+	mutex  sync.RWMutex
+	source func() map[[2]string]int
+}
+
+func (c *seriesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *seriesCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	f := c.source
+	c.mutex.RUnlock()
+	if f == nil {
+		return
+	}
+
+	for k, n := range f() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), k[0], k[1])
+	}
+}
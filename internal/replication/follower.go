@@ -0,0 +1,83 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"sync"
+	"yaprakticum-go-track2/internal/grpcimp"
+	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Replication state of follower: epoch of primary it was restored from and number of last applied batch
+type Follower struct {
+	storage storagecommons.Storager
+	logger  *zap.Logger
+	mu      sync.Mutex
+	epoch   string
+	applied uint64
+}
+
+func NewFollower(storage storagecommons.Storager, logger *zap.Logger) *Follower {
+	return &Follower{storage: storage, logger: logger}
+}
+
+// Applies batch if it is the next one of primary epoch. Acknowledges number of last applied batch,
+// batch of unknown epoch is acknowledged with 0 (follower is to be restored from snapshot)
+func (f *Follower) Replicate(ctx context.Context, req *grpcimp.ReplicateRequest) *grpcimp.ReplicateResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.Epoch != f.epoch || f.epoch == "" {
+		return &grpcimp.ReplicateResponse{Error: "unknown epoch"}
+	}
+	if req.Seq != f.applied+1 {
+		// Batch is already applied (retry of primary) or some batch is missed
+		return &grpcimp.ReplicateResponse{AckSeq: f.applied}
+	}
+
+	err := f.storage.WriteDataMulti(storagecommons.WithTenant(ctx, req.Tenant), grpccommon.DataToMetrics(req.Data))
+	if (err != nil) != (req.Error != "") {
+		// Result differs from primary one, so state may differ too
+		res := &grpcimp.ReplicateResponse{AckSeq: f.applied, Error: "batch applied not the same way as on primary"}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		f.logger.Sugar().Infof("Replicated batch %d: %s", req.Seq, res.Error)
+		f.epoch = ""
+		return res
+	}
+
+	f.applied = req.Seq
+	return &grpcimp.ReplicateResponse{AckSeq: f.applied}
+}
+
+// Replaces data of tenants with snapshot ones and starts accepting batches made after snapshot
+func (f *Follower) RestoreSnapshot(ctx context.Context, req *grpcimp.RestoreSnapshotRequest) *grpcimp.RestoreSnapshotResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ss, ok := f.storage.(storagecommons.Snapshotter)
+	if !ok {
+		return &grpcimp.RestoreSnapshotResponse{Error: "storage does not support snapshots"}
+	}
+
+	f.epoch, f.applied = "", 0
+	for _, ts := range req.Tenants {
+		var mdb storagecommons.MetricsDB
+		err := json.Unmarshal(ts.Data, &mdb)
+		if err == nil {
+			err = ss.Restore(storagecommons.WithTenant(ctx, ts.Tenant), mdb)
+		}
+		if err != nil {
+			err = errors.Join(errors.New("tenant "+ts.Tenant), err)
+			return &grpcimp.RestoreSnapshotResponse{Error: err.Error()}
+		}
+	}
+
+	f.epoch, f.applied = req.Epoch, req.Seq
+	f.logger.Sugar().Infof("Restored from snapshot of batch %d, epoch %s", req.Seq, req.Epoch)
+	return &grpcimp.RestoreSnapshotResponse{AckSeq: f.applied}
+}
@@ -0,0 +1,365 @@
+// Package implements write replication from primary server to followers over gRPC Metrics service.
+//
+// Primary numbers every accepted write batch within its epoch (random id of primary run) and sends batches
+// to each follower in order. Follower applies only the next batch of the epoch it was restored to and
+// acknowledges last applied number. Follower which restarted, missed a batch or was lagging so far that
+// its queue overflowed is restored from snapshot of all tenants data, then receives batches made after it.
+// Deletes are not replicated: deleted series stay on followers until next snapshot restore
+
+package replication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"slices"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/grpcimp"
+	"yaprakticum-go-track2/internal/grpcimp/client/middlware"
+	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Max number of batches queued for follower, follower lagging more is restored from snapshot
+const queueSize = 10000
+
+// Delay of retry after failed call to follower
+const retryInterval = time.Second
+
+// Number of locks ordering writes of metric names (power of two)
+const nameStripes = 64
+
+// Storage replicated by primary
+type Source interface {
+	storagecommons.Storager
+	storagecommons.Snapshotter
+	// Returns all tenants having data
+	Tenants() []string
+}
+
+// Storager forwarding write batches to followers
+type Primary struct {
+	Source
+	snapMu   sync.RWMutex            // Held for reading by writes, snapshot excludes them while data is copied
+	names    [nameStripes]sync.Mutex // Order local writes of the same metric names the same way as their numbers
+	mu       sync.Mutex              // Guards seq and order of queued batches
+	epoch    string
+	seq      uint64
+	replicas []*replica
+	logger   *zap.Logger
+}
+
+// Returns Storager replicating writes of `src` to followers listed in configuration
+func NewPrimary(ctx context.Context, src Source, args config.ServerConfig, logger *zap.Logger) *Primary {
+	p := &Primary{Source: src, epoch: newEpoch(), logger: logger}
+
+	for _, endp := range args.Replicas {
+		mw := middlware.GRPCClientMiddleware{Cfg: args.ReplicaClientConfig(endp)}
+		conn, err := grpc.DialContext(ctx, endp, grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithChainUnaryInterceptor(mw.AddAgentIP, mw.AddHMAC256),
+			grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(grpccommon.MaxSnapshotSize)))
+		if err != nil {
+			logger.Sugar().Infof("Unable to connect to follower %s: %s", endp, err.Error())
+			continue
+		}
+		r := newReplica(p, endp, grpcimp.NewMetricsClient(conn))
+		r.conn = conn
+		p.replicas = append(p.replicas, r)
+	}
+
+	logger.Sugar().Infof("Replicating writes to %d followers, epoch %s", len(p.replicas), p.epoch)
+	for _, r := range p.replicas {
+		go r.run(ctx)
+	}
+
+	return p
+}
+
+// Returns random id of primary run
+func newEpoch() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Writes batch locally and queues it to followers.
+// Batch is forwarded even if it was rejected, so follower applies the same part of it
+func (p *Primary) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	defer p.lockNames(ctx, metrics.MetricsDB)()
+
+	err := p.Source.WriteDataMulti(ctx, metrics)
+	p.forward(ctx, metrics, err)
+	return err
+}
+
+// Writes metric locally and queues it to followers as single record batch
+func (p *Primary) WriteData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	defer p.lockNames(ctx, []storagecommons.Metrics{metrics})()
+
+	res, err := p.Source.WriteData(ctx, metrics)
+	p.forward(ctx, storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{metrics}}, err)
+	return res, err
+}
+
+// Locks names of written metrics (in stripe order, so writes of intersecting batches can't deadlock)
+// and excludes snapshot, returns unlock function.
+// Writes of different names run concurrently, as their order doesn't change the result
+func (p *Primary) lockNames(ctx context.Context, metrics []storagecommons.Metrics) func() {
+	tenant := storagecommons.TenantFromContext(ctx)
+	stripes := make([]int, 0, len(metrics))
+	for _, m := range metrics {
+		stripes = append(stripes, nameStripe(tenant, m.ID))
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	p.snapMu.RLock()
+	for _, i := range stripes {
+		p.names[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			p.names[i].Unlock()
+		}
+		p.snapMu.RUnlock()
+	}
+}
+
+// Returns lock stripe of tenant metric name (FNV-1a hash)
+func nameStripe(tenant string, name string) int {
+	h := uint32(2166136261)
+	for _, s := range []string{tenant, "\x00", name} {
+		for i := 0; i < len(s); i++ {
+			h ^= uint32(s[i])
+			h *= 16777619
+		}
+	}
+	return int(h & (nameStripes - 1))
+}
+
+// Numbers batch and queues it to followers, names of batch metrics must be locked by caller
+func (p *Primary) forward(ctx context.Context, metrics storagecommons.MetricsDB, err error) {
+	if len(p.replicas) == 0 {
+		return
+	}
+
+	req := &grpcimp.ReplicateRequest{
+		Epoch:  p.epoch,
+		Tenant: storagecommons.TenantFromContext(ctx),
+		Data:   grpccommon.MetricsToData(metrics),
+	}
+	if err != nil {
+		req.Error = err.Error()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	req.Seq = p.seq
+	for _, r := range p.replicas {
+		r.enqueue(req)
+	}
+}
+
+// Returns snapshot of all tenants data with number of last batch included into it.
+// Queues of followers are dropped, as batches made before snapshot are not needed anymore
+func (p *Primary) snapshot(ctx context.Context, r *replica) (*grpcimp.RestoreSnapshotRequest, error) {
+	tenants, mdbs, seq, err := p.copyData(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copies are encoded while writes go on, batches made meanwhile are queued to follower
+	req := &grpcimp.RestoreSnapshotRequest{Epoch: p.epoch, Seq: seq}
+	for i, tenant := range tenants {
+		data, err := json.Marshal(mdbs[i])
+		if err != nil {
+			return nil, err
+		}
+		req.Tenants = append(req.Tenants, &grpcimp.TenantSnapshot{Tenant: tenant, Data: data})
+	}
+
+	return req, nil
+}
+
+// Returns copies of all tenants data and number of last batch included into them.
+// Writes are excluded only while data is copied
+func (p *Primary) copyData(ctx context.Context, r *replica) ([]string, []storagecommons.MetricsDB, uint64, error) {
+	p.snapMu.Lock()
+	defer p.snapMu.Unlock()
+
+	p.mu.Lock()
+	seq := p.seq
+	r.reset()
+	p.mu.Unlock()
+
+	tenants := p.Tenants()
+	mdbs := make([]storagecommons.MetricsDB, 0, len(tenants))
+	for _, tenant := range tenants {
+		mdb, err := p.Source.Snapshot(storagecommons.WithTenant(ctx, tenant))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		mdbs = append(mdbs, mdb)
+	}
+
+	return tenants, mdbs, seq, nil
+}
+
+func (p *Primary) Close(ctx context.Context) error {
+	errs := []error{p.Source.Close(ctx)}
+	for _, r := range p.replicas {
+		if r.conn != nil {
+			errs = append(errs, r.conn.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Follower connection with queue of batches not acknowledged yet
+type replica struct {
+	primary *Primary
+	endp    string
+	conn    *grpc.ClientConn
+	client  grpcimp.MetricsClient
+	logger  *zap.Logger
+	mu      sync.Mutex
+	queue   []*grpcimp.ReplicateRequest
+	behind  bool // Follower is to be restored from snapshot
+	notify  chan struct{}
+}
+
+// New follower is always restored from snapshot first, as its data state is unknown
+func newReplica(p *Primary, endp string, client grpcimp.MetricsClient) *replica {
+	return &replica{primary: p, endp: endp, client: client, logger: p.logger, behind: true, notify: make(chan struct{}, 1)}
+}
+
+func (r *replica) enqueue(req *grpcimp.ReplicateRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.behind {
+		return
+	}
+	if len(r.queue) >= queueSize {
+		r.logger.Sugar().Infof("Follower %s is lagging, it will be restored from snapshot", r.endp)
+		r.queue, r.behind = nil, true
+		return
+	}
+	r.queue = append(r.queue, req)
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Drops queue and snapshot request
+func (r *replica) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queue, r.behind = nil, false
+}
+
+func (r *replica) setBehind() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queue, r.behind = nil, true
+}
+
+// Returns first queued batch, nil if snapshot restore is needed
+func (r *replica) next(ctx context.Context) (*grpcimp.ReplicateRequest, bool) {
+	for {
+		r.mu.Lock()
+		behind := r.behind
+		var req *grpcimp.ReplicateRequest
+		if len(r.queue) > 0 {
+			req = r.queue[0]
+		}
+		r.mu.Unlock()
+
+		if behind {
+			return nil, true
+		}
+		if req != nil {
+			return req, true
+		}
+
+		select {
+		case <-r.notify:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// Drops acknowledged batch from queue (unless queue was reset meanwhile)
+func (r *replica) ack(req *grpcimp.ReplicateRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queue) > 0 && r.queue[0] == req {
+		r.queue = r.queue[1:]
+	}
+}
+
+// Routine sending queued batches to follower
+func (r *replica) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		req, ok := r.next(ctx)
+		if !ok {
+			return
+		}
+
+		var err error
+		if req == nil {
+			err = r.restore(ctx)
+		} else {
+			err = r.send(ctx, req)
+		}
+		if err != nil {
+			r.logger.Sugar().Infof("Replication to follower %s failed: %s", r.endp, err.Error())
+			time.Sleep(retryInterval)
+		}
+	}
+}
+
+// Sends batch, follower acknowledging older batch is restored from snapshot
+func (r *replica) send(ctx context.Context, req *grpcimp.ReplicateRequest) error {
+	resp, err := r.client.Replicate(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.AckSeq < req.Seq {
+		r.logger.Sugar().Infof("Follower %s acknowledged batch %d instead of %d, it will be restored from snapshot", r.endp, resp.AckSeq, req.Seq)
+		r.setBehind()
+		return nil
+	}
+	r.ack(req)
+	return nil
+}
+
+// Restores follower from snapshot
+func (r *replica) restore(ctx context.Context) error {
+	req, err := r.primary.snapshot(ctx, r)
+	if err == nil {
+		var resp *grpcimp.RestoreSnapshotResponse
+		resp, err = r.client.RestoreSnapshot(ctx, req)
+		if err == nil && (resp.Error != "" || resp.AckSeq != req.Seq) {
+			err = errors.New("snapshot not applied: " + resp.Error)
+		}
+	}
+	if err != nil {
+		r.setBehind()
+		return err
+	}
+
+	r.logger.Sugar().Infof("Follower %s restored from snapshot of batch %d", r.endp, req.Seq)
+	return nil
+}
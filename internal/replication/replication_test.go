@@ -0,0 +1,164 @@
+package replication
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"sync"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/grpcimp"
+	"yaprakticum-go-track2/internal/grpcimp/grpccommon"
+	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+// In-memory storage of default tenant only
+type singleTenant struct {
+	*filestore.FileStore
+}
+
+func (s singleTenant) Tenants() []string {
+	return []string{storagecommons.DefaultTenant}
+}
+
+func newStore(t *testing.T) singleTenant {
+	fs, err := filestore.New(context.Background(), config.ServerConfig{}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	assert.NoError(t, err)
+	return singleTenant{fs}
+}
+
+// Client calling follower directly
+type followerClient struct {
+	grpcimp.MetricsClient
+	follower *Follower
+}
+
+func (c followerClient) Replicate(ctx context.Context, in *grpcimp.ReplicateRequest, opts ...grpc.CallOption) (*grpcimp.ReplicateResponse, error) {
+	return c.follower.Replicate(ctx, in), nil
+}
+
+func (c followerClient) RestoreSnapshot(ctx context.Context, in *grpcimp.RestoreSnapshotRequest, opts ...grpc.CallOption) (*grpcimp.RestoreSnapshotResponse, error) {
+	return c.follower.RestoreSnapshot(ctx, in), nil
+}
+
+func counterBatch(delta int64) storagecommons.MetricsDB {
+	return storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{{ID: "c", MType: "counter", Delta: &delta}}}
+}
+
+func readCounter(t *testing.T, s storagecommons.Storager) int64 {
+	data, _ := s.GetCounters().ReadData(context.Background())
+	return data["c"]
+}
+
+func TestFollower(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	f := NewFollower(store, testhelpers.GetCustomZap(zap.ErrorLevel))
+
+	batch := func(seq uint64) *grpcimp.ReplicateRequest {
+		return &grpcimp.ReplicateRequest{Epoch: "e1", Seq: seq, Data: grpccommon.MetricsToData(counterBatch(1))}
+	}
+
+	t.Run("Unknown Epoch", func(t *testing.T) {
+		res := f.Replicate(ctx, batch(1))
+		assert.Equal(t, uint64(0), res.AckSeq)
+		assert.Equal(t, int64(0), readCounter(t, store))
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		res := f.RestoreSnapshot(ctx, &grpcimp.RestoreSnapshotRequest{Epoch: "e1", Seq: 0})
+		assert.Empty(t, res.Error)
+		assert.Equal(t, uint64(0), res.AckSeq)
+	})
+
+	t.Run("Sequence", func(t *testing.T) {
+		assert.Equal(t, uint64(1), f.Replicate(ctx, batch(1)).AckSeq)
+		assert.Equal(t, uint64(2), f.Replicate(ctx, batch(2)).AckSeq)
+		assert.Equal(t, int64(2), readCounter(t, store))
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		assert.Equal(t, uint64(2), f.Replicate(ctx, batch(1)).AckSeq)
+		assert.Equal(t, uint64(2), f.Replicate(ctx, batch(2)).AckSeq)
+		assert.Equal(t, int64(2), readCounter(t, store))
+	})
+
+	t.Run("Gap", func(t *testing.T) {
+		assert.Equal(t, uint64(2), f.Replicate(ctx, batch(4)).AckSeq)
+		assert.Equal(t, int64(2), readCounter(t, store))
+	})
+
+	t.Run("Result Differs", func(t *testing.T) {
+		req := batch(3)
+		req.Error = "rejected on primary"
+		res := f.Replicate(ctx, req)
+		assert.Equal(t, uint64(2), res.AckSeq)
+		assert.NotEmpty(t, res.Error)
+		// Follower is to be restored from snapshot
+		assert.Equal(t, uint64(0), f.Replicate(ctx, batch(3)).AckSeq)
+	})
+}
+
+func TestPrimary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+
+	primaryStore := newStore(t)
+	followerStore := newStore(t)
+	follower := NewFollower(followerStore, logger)
+
+	p := &Primary{Source: primaryStore, epoch: newEpoch(), logger: logger}
+	p.replicas = append(p.replicas, newReplica(p, "follower", followerClient{follower: follower}))
+
+	// Written before replica is started, follower gets it with initial snapshot
+	assert.NoError(t, p.WriteDataMulti(ctx, counterBatch(5)))
+	go p.replicas[0].run(ctx)
+
+	synced := func(want int64) func() bool {
+		return func() bool {
+			return readCounter(t, primaryStore) == want && readCounter(t, followerStore) == want
+		}
+	}
+
+	t.Run("Catch Up From Snapshot", func(t *testing.T) {
+		assert.Eventually(t, synced(5), 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Batches Forwarded", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, p.WriteDataMulti(ctx, counterBatch(1)))
+		}
+		assert.Eventually(t, synced(15), 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Concurrent Writes", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					assert.NoError(t, p.WriteDataMulti(ctx, counterBatch(1)))
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Eventually(t, synced(95), 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Follower Restarted", func(t *testing.T) {
+		// Restarted follower has no replication state and stale data
+		follower.mu.Lock()
+		follower.epoch, follower.applied = "", 0
+		follower.mu.Unlock()
+		followerStore.Restore(ctx, storagecommons.MetricsDB{})
+
+		assert.NoError(t, p.WriteDataMulti(ctx, counterBatch(1)))
+		assert.Eventually(t, synced(96), 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,74 @@
+package boltstore
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func Test(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	args := config.ServerConfig{ConnString: "bolt://" + filepath.Join(t.TempDir(), "test.db")}
+	db, err := New(ctx, args, logger)
+	assert.NoError(t, err)
+	storagecommons.PerformStoragerTest(t, db)
+
+	t.Run("Data Persisted After Reopen", func(t *testing.T) {
+		before, err := db.GetCounters().ReadData(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Close(ctx))
+
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		after, err := db.GetCounters().ReadData(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, before, after)
+	})
+
+	assert.NoError(t, db.Close(ctx))
+}
+
+func TestSeriesExpiry(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	db, err := New(ctx, config.ServerConfig{
+		ConnString: "bolt://" + filepath.Join(t.TempDir(), "test.db"),
+		MetricTTL:  time.Hour,
+	}, logger)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	var v = 1.0
+	var ttl int64 = 60
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g1", MType: "gauge", Value: &v})
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g2", MType: "gauge", Value: &v, TTL: &ttl})
+	assert.NoError(t, err)
+
+	t.Run("Fresh Series Kept", func(t *testing.T) {
+		assert.NoError(t, db.Expire(ctx))
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Len(t, data, 2)
+	})
+
+	t.Run("Own TTL Expired", func(t *testing.T) {
+		assert.NoError(t, db.expireAt(ctx, time.Now().Add(10*time.Minute)))
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Equal(t, map[string]float64{"g1": 1}, data)
+		smp, _ := db.ReadRange(ctx, "gauge", "g2", time.Now().Add(-time.Hour), time.Now())
+		assert.Empty(t, smp)
+	})
+
+	t.Run("Global TTL Expired", func(t *testing.T) {
+		assert.NoError(t, db.expireAt(ctx, time.Now().Add(2*time.Hour)))
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Empty(t, data)
+	})
+}
@@ -0,0 +1,453 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/prom"
+	"yaprakticum-go-track2/internal/shared"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DSN scheme selecting embedded storage
+const dsnScheme = "bolt://"
+
+// Embedded single-file transactional storage description (see Storager)
+type BoltStore struct {
+	Gauges             *Substorage[float64]
+	Counters           *Substorage[int64]
+	Histograms         *Substorage[storagecommons.Histogram]
+	Summaries          *Substorage[storagecommons.Summary]
+	db                 *bolt.DB
+	tiers              []storagecommons.RetentionTier
+	histogramBuckets   []float64
+	summaryAccuracy    float64
+	compactionInterval time.Duration
+	metricTTL          time.Duration
+	ttlCheckInterval   time.Duration
+}
+
+// Checks if DSN selects embedded storage (`bolt:///path/to/file.db`)
+func IsBoltDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, dsnScheme)
+}
+
+// Returns DSN of `tenant` database file placed next to database file of default tenant
+func TenantDSN(dsn string, tenant string) (string, error) {
+	path := storagecommons.TenantFileName(strings.TrimPrefix(dsn, dsnScheme), tenant)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+	return dsnScheme + path, nil
+}
+
+func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*BoltStore, error) {
+	var ms BoltStore
+
+	logger.Sugar().Infof("Creating embedded storage...")
+
+	path := strings.TrimPrefix(args.ConnString, dsnScheme)
+	if path == "" {
+		return nil, errors.New("no database file path provided")
+	}
+
+	var err error
+	ms.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	ms.tiers = storagecommons.NewRetentionTiers(args.RetentionRaw, args.RetentionMinute, args.RetentionHour)
+	ms.histogramBuckets = args.HistogramBuckets
+	ms.summaryAccuracy = args.SummaryAccuracy
+	ms.compactionInterval = args.CompactionInterval
+	ms.metricTTL = args.MetricTTL
+	ms.ttlCheckInterval = args.TTLCheckInterval
+
+	ms.Gauges = &Substorage[float64]{
+		db: ms.db, mtype: "gauge", tiers: ms.tiers,
+		parse:  func(value string) (float64, error) { return strconv.ParseFloat(value, 64) },
+		merge:  func(cur float64, exist bool, value float64) (float64, error) { return value, nil },
+		sample: func(value float64) float64 { return value },
+		check:  func(value float64) error { return nil },
+	}
+	ms.Counters = &Substorage[int64]{
+		db: ms.db, mtype: "counter", tiers: ms.tiers,
+		parse:  func(value string) (int64, error) { return strconv.ParseInt(value, 10, 64) },
+		merge:  func(cur int64, exist bool, value int64) (int64, error) { return cur + value, nil },
+		sample: func(value int64) float64 { return float64(value) },
+		check:  func(value int64) error { return nil },
+	}
+	ms.Histograms = &Substorage[storagecommons.Histogram]{
+		db: ms.db, mtype: "histogram", tiers: ms.tiers,
+		parse: func(value string) (storagecommons.Histogram, error) {
+			var h storagecommons.Histogram
+			err := json.Unmarshal([]byte(value), &h)
+			return h, err
+		},
+		merge: func(cur storagecommons.Histogram, exist bool, value storagecommons.Histogram) (storagecommons.Histogram, error) {
+			if !exist {
+				return value, nil
+			}
+			return cur, cur.Merge(value)
+		},
+		sample: func(value storagecommons.Histogram) float64 { return float64(value.Count) },
+		check:  storagecommons.Histogram.Validate,
+	}
+	ms.Summaries = &Substorage[storagecommons.Summary]{
+		db: ms.db, mtype: "summary", tiers: ms.tiers,
+		parse: func(value string) (storagecommons.Summary, error) {
+			var s storagecommons.Summary
+			err := json.Unmarshal([]byte(value), &s)
+			return s, err
+		},
+		merge: func(cur storagecommons.Summary, exist bool, value storagecommons.Summary) (storagecommons.Summary, error) {
+			if !exist {
+				return value, nil
+			}
+			return cur, cur.Merge(value)
+		},
+		sample: func(value storagecommons.Summary) float64 { return float64(value.Count) },
+		check:  storagecommons.Summary.Validate,
+	}
+
+	err = ms.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketMeta); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketSources); err != nil {
+			return err
+		}
+		for _, mtype := range []string{"gauge", "counter", "histogram", "summary"} {
+			tb, err := tx.CreateBucketIfNotExists([]byte(mtype))
+			if err != nil {
+				return err
+			}
+			for _, name := range [][]byte{bucketData, bucketHistory, bucketExpiry} {
+				if _, err = tb.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+		}
+		if tx.Bucket(bucketMetadata) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket(bucketMetadata); err != nil {
+			return err
+		}
+		return backfillMetadata(tx)
+	})
+	if err != nil {
+		ms.db.Close()
+		return nil, err
+	}
+
+	if ms.compactionInterval > 0 {
+		go ms.compactionWorker(ctx)
+	}
+
+	if ms.ttlCheckInterval > 0 {
+		go ms.expiryWorker(ctx)
+	}
+
+	return &ms, nil
+}
+
+// Validates metric and writes it within transaction, returns metric with stored value
+func (ms *BoltStore) writeMetric(tx *bolt.Tx, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	key := metrics.Key()
+
+	metrics, err := resolveCumulative(tx, metrics)
+	if err != nil {
+		return metrics, err
+	}
+
+	switch metrics.MType {
+	case "gauge":
+		if metrics.Value == nil {
+			return metrics, errors.New("no Value data provided")
+		}
+		if _, err := ms.Gauges.write(tx, key, *metrics.Value); err != nil {
+			return metrics, err
+		}
+	case "counter":
+		if metrics.Delta == nil {
+			return metrics, errors.New("no Delta data provided")
+		}
+		val, err := ms.Counters.write(tx, key, *metrics.Delta)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Delta = &val
+	case "histogram":
+		h, err := storagecommons.PrepareHistogram(metrics.Histogram, ms.histogramBuckets)
+		if err != nil {
+			return metrics, err
+		}
+		val, err := ms.Histograms.write(tx, key, h)
+		if err != nil {
+			return metrics, fmt.Errorf("histogram/%s: %w", key, err)
+		}
+		metrics.Histogram = &val
+	case "summary":
+		s, err := storagecommons.PrepareSummary(metrics.Summary, ms.summaryAccuracy)
+		if err != nil {
+			return metrics, err
+		}
+		val, err := ms.Summaries.write(tx, key, s)
+		if err != nil {
+			return metrics, fmt.Errorf("summary/%s: %w", key, err)
+		}
+		metrics.Summary = &val
+	default:
+		return metrics, errors.New("Unknown metric type: " + metrics.MType)
+	}
+
+	if metrics.TTL != nil {
+		if err := setSeriesTTL(tx.Bucket([]byte(metrics.MType)), key, *metrics.TTL); err != nil {
+			return metrics, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// Writes all metrics in single transaction
+func (ms *BoltStore) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	return ms.db.Update(func(tx *bolt.Tx) error {
+		if err := registerMetadata(tx, metrics.MetricsDB); err != nil {
+			return err
+		}
+		for _, val := range metrics.MetricsDB {
+			if _, err := ms.writeMetric(tx, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ms *BoltStore) WriteData(ctx context.Context, metrics storagecommons.Metrics) (rMetrics storagecommons.Metrics, rError error) {
+	rMetrics = metrics
+	rError = ms.db.Update(func(tx *bolt.Tx) error {
+		err := registerMetadata(tx, []storagecommons.Metrics{metrics})
+		if err != nil {
+			return err
+		}
+		rMetrics, err = ms.writeMetric(tx, metrics)
+		return err
+	})
+	if rError != nil {
+		return metrics, rError
+	}
+	return
+}
+
+func (ms *BoltStore) ReadData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	switch metrics.MType {
+	case "gauge":
+		data, err := ms.Gauges.ReadData(ctx, metrics.Key())
+		if err != nil {
+			return metrics, err
+		}
+		vl := data[metrics.Key()]
+		metrics.Value = &vl
+	case "counter":
+		data, err := ms.Counters.ReadData(ctx, metrics.Key())
+		if err != nil {
+			return metrics, err
+		}
+		vl := data[metrics.Key()]
+		metrics.Delta = &vl
+	case "histogram":
+		data, err := ms.Histograms.ReadData(ctx, metrics.Key())
+		if err != nil {
+			return metrics, err
+		}
+		vl := data[metrics.Key()]
+		metrics.Histogram = &vl
+	case "summary":
+		data, err := ms.Summaries.ReadData(ctx, metrics.Key())
+		if err != nil {
+			return metrics, err
+		}
+		vl := data[metrics.Key()]
+		metrics.Summary = &vl
+	default:
+		return metrics, errors.New("Unknown metric type: " + metrics.MType)
+	}
+	return metrics, nil
+}
+
+func (ms *BoltStore) ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	switch mtype {
+	case "gauge":
+		return ms.Gauges.ReadRange(ctx, id, from, to)
+	case "counter":
+		return ms.Counters.ReadRange(ctx, id, from, to)
+	case "histogram":
+		return ms.Histograms.ReadRange(ctx, id, from, to)
+	case "summary":
+		return ms.Summaries.ReadRange(ctx, id, from, to)
+	default:
+		return nil, errors.New("Unknown metric type: " + mtype)
+	}
+}
+
+func (ms *BoltStore) Delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	return ms.db.Update(func(tx *bolt.Tx) error {
+		if !storagecommons.IsKnownType(metrics.MType) {
+			return errors.New("Unknown metric type: " + metrics.MType)
+		}
+		tb := tx.Bucket([]byte(metrics.MType))
+		exist, err := deleteSeries(tb, metrics.Key())
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return storagecommons.NotExistsError(metrics.MType, metrics.Key())
+		}
+		if metrics.MType == "counter" {
+			return dropSources(tx, metrics.Key())
+		}
+		return nil
+	})
+}
+
+// Builds rollups of completed buckets and drops expired samples of all substorages
+func (ms *BoltStore) Compact(ctx context.Context) error {
+	now := time.Now()
+	mtypes := []string{"gauge", "counter", "histogram", "summary"}
+
+	return ms.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+
+		for i := 1; i < len(ms.tiers); i++ {
+			rolledKey := []byte("rolled/" + strconv.Itoa(i))
+			end := now.Truncate(ms.tiers[i].Step)
+
+			var from time.Time
+			if v := meta.Get(rolledKey); v != nil {
+				from = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			} else if ms.tiers[i-1].Keep > 0 {
+				// First bucket not affected by source tier expiration
+				from = now.Add(-ms.tiers[i-1].Keep).Truncate(ms.tiers[i].Step).Add(ms.tiers[i].Step)
+			}
+			if !end.After(from) {
+				continue
+			}
+
+			for _, mtype := range mtypes {
+				if err := rollup(tx.Bucket([]byte(mtype)), ms.tiers, i, from, end); err != nil {
+					return err
+				}
+			}
+			if err := meta.Put(rolledKey, timeKey(end)); err != nil {
+				return err
+			}
+		}
+
+		for i, tier := range ms.tiers {
+			if tier.Keep == 0 {
+				continue
+			}
+			for _, mtype := range mtypes {
+				if err := expireSamples(tx.Bucket([]byte(mtype)), i, now.Add(-tier.Keep)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Drops series not updated within their TTL of all substorages
+func (ms *BoltStore) Expire(ctx context.Context) error {
+	return ms.expireAt(ctx, time.Now())
+}
+
+func (ms *BoltStore) expireAt(ctx context.Context, now time.Time) error {
+	return ms.db.Update(func(tx *bolt.Tx) error {
+		for _, mtype := range []string{"gauge", "counter", "histogram", "summary"} {
+			if err := expireSeries(tx.Bucket([]byte(mtype)), now, ms.metricTTL); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Routine for periodic history compaction
+func (ms *BoltStore) compactionWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(ms.compactionInterval)
+		if err := ms.Compact(ctx); err != nil && shared.Logger != nil {
+			shared.Logger.Sugar().Infof("History compaction failed: %s", err.Error())
+		}
+	}
+}
+
+// Routine for periodic expired series removal
+func (ms *BoltStore) expiryWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(ms.ttlCheckInterval)
+		if err := ms.Expire(ctx); err != nil && shared.Logger != nil {
+			shared.Logger.Sugar().Infof("Series expiry failed: %s", err.Error())
+		}
+	}
+}
+
+func (ms *BoltStore) Close(ctx context.Context) error {
+	return ms.db.Close()
+}
+
+func (ms *BoltStore) GetGauges() storagecommons.StoragerFloat64 {
+	return ms.Gauges
+}
+
+func (ms *BoltStore) GetCounters() storagecommons.StoragerInt64Sum {
+	return ms.Counters
+}
+
+func (ms *BoltStore) GetHistograms() storagecommons.StoragerHistogram {
+	return ms.Histograms
+}
+
+func (ms *BoltStore) GetSummaries() storagecommons.StoragerSummary {
+	return ms.Summaries
+}
+
+func (ms *BoltStore) Ping(ctx context.Context) error {
+	return ms.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// DumpLoad
+
+// Data is written to disc on every transaction commit, Dump only forces file sync
+func (ms *BoltStore) Dump(ctx context.Context) error {
+	start := time.Now()
+	err := ms.db.Sync()
+	if err != nil {
+		return err
+	}
+	return ms.db.View(func(tx *bolt.Tx) error {
+		prom.Storage().ObserveDump("bolt", start, int(tx.Size()))
+		return nil
+	})
+}
+
+func (ms *BoltStore) Load(ctx context.Context) error {
+	return nil
+}
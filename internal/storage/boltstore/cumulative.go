@@ -0,0 +1,51 @@
+package boltstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket of last values of cumulative counters:
+//
+//	sources/<series key>/<source>   big endian value
+var bucketSources = []byte("sources")
+
+// Converts cumulative counter write to increment one within transaction, recording written value as last one of its source
+func resolveCumulative(tx *bolt.Tx, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	if !metrics.Cumulative {
+		return metrics, nil
+	}
+	if err := storagecommons.CheckCumulative(metrics); err != nil {
+		return metrics, err
+	}
+
+	sb, err := tx.Bucket(bucketSources).CreateBucketIfNotExists([]byte(metrics.Key()))
+	if err != nil {
+		return metrics, err
+	}
+	var last int64
+	v := sb.Get([]byte(metrics.Source))
+	if v != nil {
+		last = int64(binary.BigEndian.Uint64(v))
+	}
+	if err := sb.Put([]byte(metrics.Source), binary.BigEndian.AppendUint64(nil, uint64(*metrics.Delta))); err != nil {
+		return metrics, err
+	}
+
+	delta := storagecommons.CumulativeDelta(last, v != nil, *metrics.Delta)
+	metrics.Delta = &delta
+	metrics.Cumulative = false
+	return metrics, nil
+}
+
+// Drops states of all sources of counter series
+func dropSources(tx *bolt.Tx, key string) error {
+	err := tx.Bucket(bucketSources).DeleteBucket([]byte(key))
+	if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package boltstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketData    = []byte("data")
+	bucketHistory = []byte("history")
+	bucketExpiry  = []byte("expiry")
+	bucketMeta    = []byte("meta")
+)
+
+// Bucket layout of metric type bucket:
+//
+//	data/<series key>                              JSON encoded value
+//	history/<series key>/<tier>/<unix nano time>   JSON encoded sample
+//	expiry/<series key>                            JSON encoded seriesState
+
+// Last update time and own TTL (seconds, 0 - global TTL) of series
+type seriesState struct {
+	Updated time.Time `json:"updated"`
+	TTL     int64     `json:"ttl,omitempty"`
+}
+
+func tierName(tier int) []byte {
+	return []byte{byte(tier)}
+}
+
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+// Records raw sample of series
+func addSample(tb *bolt.Bucket, key string, smp storagecommons.Sample) error {
+	series, err := tb.Bucket(bucketHistory).CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return err
+	}
+	raw, err := series.CreateBucketIfNotExists(tierName(0))
+	if err != nil {
+		return err
+	}
+
+	// Samples written within same nanosecond are shifted to keep all of them
+	for raw.Get(timeKey(smp.Timestamp)) != nil {
+		smp.Timestamp = smp.Timestamp.Add(time.Nanosecond)
+	}
+	jsn, err := json.Marshal(smp)
+	if err != nil {
+		return err
+	}
+	return raw.Put(timeKey(smp.Timestamp), jsn)
+}
+
+// Returns samples of tier bucket within [from, to] time range
+func readSamples(tier *bolt.Bucket, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	res := make([]storagecommons.Sample, 0)
+	if tier == nil {
+		return res, nil
+	}
+
+	c := tier.Cursor()
+	end := timeKey(to)
+	for k, v := c.Seek(timeKey(from)); k != nil && string(k) <= string(end); k, v = c.Next() {
+		var smp storagecommons.Sample
+		if err := json.Unmarshal(v, &smp); err != nil {
+			return nil, err
+		}
+		res = append(res, smp)
+	}
+	return res, nil
+}
+
+// Returns keys of series having history
+func historyKeys(tb *bolt.Bucket) [][]byte {
+	keys := make([][]byte, 0)
+	tb.Bucket(bucketHistory).ForEach(func(k, v []byte) error {
+		if v == nil {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	return keys
+}
+
+// Builds rollups of tier `tier` for buckets within [from, to) time range of all series of metric type bucket
+func rollup(tb *bolt.Bucket, tiers []storagecommons.RetentionTier, tier int, from time.Time, to time.Time) error {
+	for _, key := range historyKeys(tb) {
+		series := tb.Bucket(bucketHistory).Bucket(key)
+		src, err := readSamples(series.Bucket(tierName(tier-1)), from, to.Add(-time.Nanosecond))
+		if err != nil {
+			return err
+		}
+		if len(src) == 0 {
+			continue
+		}
+
+		dst, err := series.CreateBucketIfNotExists(tierName(tier))
+		if err != nil {
+			return err
+		}
+		for _, smp := range storagecommons.Downsample(src, tiers[tier].Step) {
+			jsn, err := json.Marshal(smp)
+			if err != nil {
+				return err
+			}
+			if err = dst.Put(timeKey(smp.Timestamp), jsn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Drops samples of tier `tier` older than `cutoff` of all series of metric type bucket
+func expireSamples(tb *bolt.Bucket, tier int, cutoff time.Time) error {
+	for _, key := range historyKeys(tb) {
+		bucket := tb.Bucket(bucketHistory).Bucket(key).Bucket(tierName(tier))
+		if bucket == nil {
+			continue
+		}
+
+		old := make([][]byte, 0)
+		c := bucket.Cursor()
+		end := timeKey(cutoff)
+		for k, _ := c.First(); k != nil && string(k) < string(end); k, _ = c.Next() {
+			old = append(old, append([]byte{}, k...))
+		}
+		for _, k := range old {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getSeriesState(tb *bolt.Bucket, key string) (seriesState, error) {
+	var st seriesState
+	v := tb.Bucket(bucketExpiry).Get([]byte(key))
+	if v == nil {
+		return st, nil
+	}
+	err := json.Unmarshal(v, &st)
+	return st, err
+}
+
+func putSeriesState(tb *bolt.Bucket, key string, st seriesState) error {
+	jsn, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return tb.Bucket(bucketExpiry).Put([]byte(key), jsn)
+}
+
+// Records series update time
+func touchSeries(tb *bolt.Bucket, key string, now time.Time) error {
+	st, err := getSeriesState(tb, key)
+	if err != nil {
+		return err
+	}
+	st.Updated = now
+	return putSeriesState(tb, key, st)
+}
+
+// Sets series own TTL in seconds (0 - use global TTL)
+func setSeriesTTL(tb *bolt.Bucket, key string, ttl int64) error {
+	st, err := getSeriesState(tb, key)
+	if err != nil {
+		return err
+	}
+	st.TTL = max(ttl, 0)
+	return putSeriesState(tb, key, st)
+}
+
+// Drops series value, history and expiry state, returns false if series not exists
+func deleteSeries(tb *bolt.Bucket, key string) (bool, error) {
+	if tb.Bucket(bucketData).Get([]byte(key)) == nil {
+		return false, nil
+	}
+	if err := tb.Bucket(bucketData).Delete([]byte(key)); err != nil {
+		return false, err
+	}
+	err := tb.Bucket(bucketHistory).DeleteBucket([]byte(key))
+	if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return false, err
+	}
+	return true, tb.Bucket(bucketExpiry).Delete([]byte(key))
+}
+
+// Drops series not updated within their TTL (own TTL if set, `global` otherwise, 0 - never expire)
+func expireSeries(tb *bolt.Bucket, now time.Time, global time.Duration) error {
+	expired := make([]string, 0)
+	err := tb.Bucket(bucketExpiry).ForEach(func(k, v []byte) error {
+		var st seriesState
+		if err := json.Unmarshal(v, &st); err != nil {
+			return err
+		}
+		ttl := global
+		if st.TTL > 0 {
+			ttl = time.Duration(st.TTL) * time.Second
+		}
+		if ttl > 0 && now.Sub(st.Updated) > ttl {
+			expired = append(expired, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		if _, err = deleteSeries(tb, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
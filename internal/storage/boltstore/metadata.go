@@ -0,0 +1,100 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket of JSON encoded metadata by metric name
+var bucketMetadata = []byte("metadata")
+
+// Registers metric names written by `metrics` within transaction, fails if some name is registered with other type
+func registerMetadata(tx *bolt.Tx, metrics []storagecommons.Metrics) error {
+	mds, err := storagecommons.BatchMetadata(metrics, time.Now())
+	if err != nil {
+		return err
+	}
+
+	b := tx.Bucket(bucketMetadata)
+	for _, md := range mds {
+		if v := b.Get([]byte(md.Name)); v != nil {
+			var stored storagecommons.MetricMetadata
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+			if stored.Type != md.Type {
+				return &storagecommons.TypeConflictError{Name: md.Name, Type: md.Type, Registered: stored.Type}
+			}
+			if md.Unit == "" {
+				md.Unit = stored.Unit
+			}
+			if md.Help == "" {
+				md.Help = stored.Help
+			}
+			md.FirstSeen = stored.FirstSeen
+		}
+		if err := putMetadata(b, md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putMetadata(b *bolt.Bucket, md storagecommons.MetricMetadata) error {
+	jsn, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(md.Name), jsn)
+}
+
+// Registers names of series stored before metadata was introduced (first found type is kept)
+func backfillMetadata(tx *bolt.Tx) error {
+	b := tx.Bucket(bucketMetadata)
+	now := time.Now()
+	for _, mtype := range []string{"gauge", "counter", "histogram", "summary"} {
+		err := tx.Bucket([]byte(mtype)).Bucket(bucketData).ForEach(func(k, v []byte) error {
+			id, _, _ := storagecommons.ParseSeriesKey(string(k))
+			if b.Get([]byte(id)) != nil {
+				return nil
+			}
+			return putMetadata(b, storagecommons.MetricMetadata{Name: id, Type: mtype, FirstSeen: now, LastSeen: now})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns number of stored series by metric type (taken from bucket statistics, values are not decoded)
+func (ms *BoltStore) SeriesCount(ctx context.Context) (map[string]int, error) {
+	res := make(map[string]int)
+	err := ms.db.View(func(tx *bolt.Tx) error {
+		for _, mtype := range []string{"gauge", "counter", "histogram", "summary"} {
+			res[mtype] = tx.Bucket([]byte(mtype)).Bucket(bucketData).Stats().KeyN
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Returns metadata of all written metric names (metadata outlives deleted and expired series)
+func (ms *BoltStore) GetMetadata(ctx context.Context) ([]storagecommons.MetricMetadata, error) {
+	res := make([]storagecommons.MetricMetadata, 0)
+	err := ms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMetadata).ForEach(func(k, v []byte) error {
+			var md storagecommons.MetricMetadata
+			if err := json.Unmarshal(v, &md); err != nil {
+				return err
+			}
+			res = append(res, md)
+			return nil
+		})
+	})
+	return res, err
+}
@@ -0,0 +1,127 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Substorage of metrics of single type (see Substorager).
+// Values are stored JSON encoded in `data` bucket nested into bucket named by metric type
+type Substorage[T any] struct {
+	db     *bolt.DB
+	mtype  string
+	tiers  []storagecommons.RetentionTier
+	parse  func(value string) (T, error)               // parses text value
+	merge  func(cur T, exist bool, value T) (T, error) // combines stored value (if exists) with written one
+	sample func(value T) float64                       // returns value recorded to history
+	check  func(value T) error                         // validates written value
+}
+
+func (s *Substorage[T]) ReadData(ctx context.Context, keys ...string) (map[string]T, error) {
+	res := make(map[string]T)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(s.mtype)).Bucket(bucketData)
+
+		if len(keys) == 0 {
+			return data.ForEach(func(k, v []byte) error {
+				var val T
+				if err := json.Unmarshal(v, &val); err != nil {
+					return err
+				}
+				res[string(k)] = val
+				return nil
+			})
+		}
+
+		for _, key := range keys {
+			v := data.Get([]byte(key))
+			if v == nil {
+				return storagecommons.NotExistsError(s.mtype, key)
+			}
+			var val T
+			if err := json.Unmarshal(v, &val); err != nil {
+				return err
+			}
+			res[key] = val
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Substorage[T]) WriteData(ctx context.Context, key string, value string) error {
+	val, err := s.parse(value)
+	if err != nil {
+		return err
+	}
+	return s.WriteDataPP(ctx, key, val)
+}
+
+func (s *Substorage[T]) WriteDataPP(ctx context.Context, key string, value T) error {
+	if err := s.check(value); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		_, err := s.write(tx, key, value)
+		return err
+	})
+}
+
+func (s *Substorage[T]) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	res := make([]storagecommons.Sample, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		series := tx.Bucket([]byte(s.mtype)).Bucket(bucketHistory).Bucket([]byte(key))
+		if series == nil {
+			return nil
+		}
+		tier := storagecommons.SelectTier(s.tiers, from, time.Now())
+		var err error
+		res, err = readSamples(series.Bucket(tierName(tier)), from, to)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Merges value into stored one within transaction, records history sample and update time.
+// Returns stored value
+func (s *Substorage[T]) write(tx *bolt.Tx, key string, value T) (T, error) {
+	tb := tx.Bucket([]byte(s.mtype))
+	data := tb.Bucket(bucketData)
+
+	var cur T
+	stored := data.Get([]byte(key))
+	if stored != nil {
+		if err := json.Unmarshal(stored, &cur); err != nil {
+			return cur, err
+		}
+	}
+
+	res, err := s.merge(cur, stored != nil, value)
+	if err != nil {
+		return cur, err
+	}
+
+	jsn, err := json.Marshal(res)
+	if err != nil {
+		return cur, err
+	}
+	if err = data.Put([]byte(key), jsn); err != nil {
+		return cur, err
+	}
+
+	now := time.Now()
+	if err = addSample(tb, key, storagecommons.Sample{Timestamp: now, Value: s.sample(res)}); err != nil {
+		return cur, err
+	}
+	return res, touchSeries(tb, key, now)
+}
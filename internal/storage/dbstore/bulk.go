@@ -0,0 +1,161 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"slices"
+	"sort"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Runs `f` within transaction on native pgx connection taken from pool
+func withPgxTx(ctx context.Context, db *sql.DB, f func(tx pgx.Tx) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("database driver is not pgx")
+		}
+		return pgx.BeginFunc(ctx, sc.Conn(), f)
+	})
+}
+
+// Copies rows (key, labels JSON, value) into session staging table and merges them into `table`
+// in single statement, which records history samples as well (except `recorded` keys, see writeHistory).
+// `update` is expression of new value for existing rows
+func copyMerge(ctx context.Context, tx pgx.Tx, table string, valueType string, update string, rows [][]any, recorded []string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	staging := table + "_staging"
+	_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TEMP TABLE IF NOT EXISTS "%s"
+(
+    "Key" text NOT NULL,
+    "Labels" text NOT NULL,
+    "Value" %s NOT NULL
+) ON COMMIT DELETE ROWS`, staging, valueType))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{staging}, []string{"Key", "Labels", "Value"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return err
+	}
+
+	// Nil slice is NULL array, which would exclude all rows
+	if recorded == nil {
+		recorded = []string{}
+	}
+	// Fixed order of row locks prevents deadlocks of concurrent writers
+	_, err = tx.Exec(ctx, fmt.Sprintf(`WITH "upd" AS (
+	INSERT INTO "%[1]s" ("Key", "Labels", "Value") SELECT "Key", "Labels"::jsonb, "Value" FROM "%[2]s" ORDER BY "Key"
+	ON CONFLICT ("Key") DO UPDATE SET "Value" = %[3]s, "Updated" = now()
+	RETURNING "Key", "Value"
+) INSERT INTO "%[1]s_history" ("Key", "Timestamp", "Value") SELECT "Key", now(), "Value" FROM "upd" WHERE NOT ("Key" = ANY($1))`, table, staging, update), recorded)
+	return err
+}
+
+// Records raw samples of batch history, so series written several times before batch write keep sample of every write.
+// Series with recorded samples get no sample of batch write time
+func writeHistory(ctx context.Context, tx pgx.Tx, history []storagecommons.MetricHistory) error {
+	rows := make(map[string][][]any)
+	for _, h := range history {
+		key := storagecommons.SeriesKey(h.ID, h.Labels)
+		table := seriesTables[h.MType] + "_history"
+		for _, smp := range h.Samples {
+			rows[table] = append(rows[table], []any{key, smp.Timestamp, smp.Value})
+		}
+	}
+
+	for table, r := range rows {
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{table}, []string{"Key", "Timestamp", "Value"}, pgx.CopyFromRows(r))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merges values stored as JSON with written ones in two round trips:
+// missing rows are created and all rows are locked by first batch, merged values are written by second one.
+// `empty` returns value new row starts with, `count` returns value recorded to history (except `recorded` keys, see writeHistory)
+func mergeJSONBatch[T any](ctx context.Context, tx pgx.Tx, table string, mtype string, data map[string]T, recorded []string,
+	empty func(value T) T, merge func(cur *T, value T) error, count func(value T) float64) error {
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	// Fixed order of row locks prevents deadlocks of concurrent writers
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lock := &pgx.Batch{}
+	for _, key := range keys {
+		jsn, err := json.Marshal(empty(data[key]))
+		if err != nil {
+			return err
+		}
+		lock.Queue(fmt.Sprintf(`INSERT INTO "%s" ("Key", "Labels", "Value") VALUES ($1, $2, $3) ON CONFLICT ("Key") DO NOTHING`, table),
+			key, labelsJSON(key), string(jsn))
+		lock.Queue(fmt.Sprintf(`SELECT "Value" FROM "%s" WHERE "Key" = $1 FOR UPDATE`, table), key)
+	}
+
+	stored := make([]string, len(keys))
+	br := tx.SendBatch(ctx, lock)
+	for i := range keys {
+		_, err := br.Exec()
+		if err == nil {
+			err = br.QueryRow().Scan(&stored[i])
+		}
+		if err != nil {
+			br.Close()
+			return err
+		}
+	}
+	err := br.Close()
+	if err != nil {
+		return err
+	}
+
+	upd := &pgx.Batch{}
+	for i, key := range keys {
+		var cur T
+		err = json.Unmarshal([]byte(stored[i]), &cur)
+		if err != nil {
+			return err
+		}
+		err = merge(&cur, data[key])
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", mtype, key, err)
+		}
+		jsn, err := json.Marshal(cur)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(recorded, key) {
+			upd.Queue(fmt.Sprintf(`UPDATE "%s" SET "Value" = $2, "Updated" = now() WHERE "Key" = $1`, table), key, string(jsn))
+			continue
+		}
+		upd.Queue(fmt.Sprintf(`WITH "upd" AS (UPDATE "%[1]s" SET "Value" = $2, "Updated" = now() WHERE "Key" = $1 RETURNING "Key")
+INSERT INTO "%[1]s_history" ("Key", "Timestamp", "Value") SELECT "Key", now(), $3::double precision FROM "upd"`, table),
+			key, string(jsn), count(cur))
+	}
+
+	return tx.SendBatch(ctx, upd).Close()
+}
@@ -0,0 +1,155 @@
+package dbstore
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"strconv"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func TestBulkWrite(t *testing.T) {
+	ctx := context.Background()
+	connectionString := testhelpers.StartPostgres(t)
+
+	db, err := New(ctx, config.ServerConfig{ConnString: connectionString}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close(ctx)
+
+	// Three values per row, so multi-row insert of batch would exceed 65535 parameters of single statement
+	const series = 30000
+	labels := func(i int) map[string]string { return map[string]string{"host": "h" + strconv.Itoa(i)} }
+	batch := func(v float64, d int64) storagecommons.MetricsDB {
+		res := storagecommons.MetricsDB{}
+		for i := 0; i < series; i++ {
+			v, d := v+float64(i), d
+			res.MetricsDB = append(res.MetricsDB,
+				storagecommons.Metrics{ID: "bg", MType: "gauge", Labels: labels(i), Value: &v},
+				storagecommons.Metrics{ID: "bc", MType: "counter", Labels: labels(i), Delta: &d})
+		}
+		return res
+	}
+	read := func(m storagecommons.Metrics) storagecommons.Metrics {
+		res, err := db.ReadData(ctx, m)
+		assert.NoError(t, err)
+		return res
+	}
+
+	t.Run("Large Batch", func(t *testing.T) {
+		if !assert.NoError(t, db.WriteDataMulti(ctx, batch(1, 2))) {
+			return
+		}
+		assert.NoError(t, db.WriteDataMulti(ctx, batch(5, 3)))
+
+		counts, err := db.SeriesCount(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, series, counts["gauge"])
+			assert.Equal(t, series, counts["counter"])
+		}
+		for _, i := range []int{0, series / 2, series - 1} {
+			g := read(storagecommons.Metrics{ID: "bg", MType: "gauge", Labels: labels(i)})
+			if assert.NotNil(t, g.Value) {
+				assert.Equal(t, float64(5+i), *g.Value)
+			}
+			c := read(storagecommons.Metrics{ID: "bc", MType: "counter", Labels: labels(i)})
+			if assert.NotNil(t, c.Delta) {
+				assert.Equal(t, int64(5), *c.Delta)
+			}
+		}
+
+		// Every write of series is recorded
+		samples, err := db.ReadRange(ctx, "counter", storagecommons.SeriesKey("bc", labels(1)), time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		if assert.NoError(t, err) && assert.Len(t, samples, 2) {
+			assert.Equal(t, float64(2), samples[0].Value)
+			assert.Equal(t, float64(5), samples[1].Value)
+		}
+	})
+
+	t.Run("Batch History", func(t *testing.T) {
+		t0 := time.Now().Add(-time.Minute).Truncate(time.Second)
+		v := 3.0
+		d := int64(1)
+		assert.NoError(t, db.WriteDataMulti(ctx, storagecommons.MetricsDB{
+			MetricsDB: []storagecommons.Metrics{
+				{ID: "hg", MType: "gauge", Value: &v},
+				{ID: "hc", MType: "counter", Delta: &d},
+			},
+			History: []storagecommons.MetricHistory{{ID: "hg", MType: "gauge", Samples: []storagecommons.Sample{
+				{Timestamp: t0, Value: 1},
+				{Timestamp: t0.Add(10 * time.Second), Value: 2},
+				{Timestamp: t0.Add(20 * time.Second), Value: 3},
+			}}},
+		}))
+
+		// Series with batch history gets no sample of write time
+		samples, err := db.ReadRange(ctx, "gauge", "hg", t0.Add(-time.Hour), time.Now().Add(time.Hour))
+		if assert.NoError(t, err) && assert.Len(t, samples, 3) {
+			for i, smp := range samples {
+				assert.WithinDuration(t, t0.Add(time.Duration(i)*10*time.Second), smp.Timestamp, 0)
+				assert.Equal(t, float64(i+1), smp.Value)
+			}
+		}
+		samples, err = db.ReadRange(ctx, "counter", "hc", t0.Add(-time.Hour), time.Now().Add(time.Hour))
+		if assert.NoError(t, err) {
+			assert.Len(t, samples, 1)
+		}
+	})
+
+	t.Run("Merged Values", func(t *testing.T) {
+		bounds := []float64{1, 10}
+		h := storagecommons.NewHistogram(bounds)
+		h.Observe(0.5)
+		h.Observe(5)
+		s := storagecommons.NewSummary(0.01)
+		s.Observe(2)
+
+		batch := storagecommons.MetricsDB{}
+		for i := 0; i < 100; i++ {
+			h, s := h, s
+			batch.MetricsDB = append(batch.MetricsDB,
+				storagecommons.Metrics{ID: "bh", MType: "histogram", Labels: labels(i), Histogram: &h},
+				storagecommons.Metrics{ID: "bs", MType: "summary", Labels: labels(i), Summary: &s})
+		}
+		assert.NoError(t, db.WriteDataMulti(ctx, batch))
+		assert.NoError(t, db.WriteDataMulti(ctx, batch))
+
+		hr := read(storagecommons.Metrics{ID: "bh", MType: "histogram", Labels: labels(42)})
+		if assert.NotNil(t, hr.Histogram) {
+			assert.Equal(t, bounds, hr.Histogram.Bounds)
+			assert.Equal(t, []int64{2, 2, 0}, hr.Histogram.Counts)
+			assert.Equal(t, int64(4), hr.Histogram.Count)
+		}
+		sr := read(storagecommons.Metrics{ID: "bs", MType: "summary", Labels: labels(42)})
+		if assert.NotNil(t, sr.Summary) {
+			assert.Equal(t, int64(2), sr.Summary.Count)
+		}
+
+		// History records count of observations
+		samples, err := db.ReadRange(ctx, "histogram", storagecommons.SeriesKey("bh", labels(42)), time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		if assert.NoError(t, err) && assert.Len(t, samples, 2) {
+			assert.Equal(t, float64(2), samples[0].Value)
+			assert.Equal(t, float64(4), samples[1].Value)
+		}
+	})
+
+	t.Run("Rejected Merge Rolls Back Batch", func(t *testing.T) {
+		h := storagecommons.NewHistogram([]float64{2})
+		h.Observe(1)
+		v := 100.0
+		assert.Error(t, db.WriteDataMulti(ctx, storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{
+			{ID: "bg", MType: "gauge", Labels: labels(0), Value: &v},
+			{ID: "bh", MType: "histogram", Labels: labels(0), Histogram: &h},
+		}}))
+
+		g := read(storagecommons.Metrics{ID: "bg", MType: "gauge", Labels: labels(0)})
+		if assert.NotNil(t, g.Value) {
+			assert.Equal(t, float64(5), *g.Value)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"yaprakticum-go-track2/internal/shared"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Builds rollups of tier `tier` for buckets within [from, to) time range of substorage with `prefix` name
+func rollupDB(ctx context.Context, db *sql.DB, prefix string, tiers []storagecommons.RetentionTier, tier int, from time.Time, to time.Time) error {
+	step := int64(tiers[tier].Step.Seconds())
+	bucket := fmt.Sprintf(`to_timestamp(floor(extract(epoch FROM "Timestamp") / %d) * %d)`, step, step)
+
+	var src string
+	if tiers[tier-1].Step == 0 {
+		src = fmt.Sprintf(`SELECT "Key", %s AS "Bucket", "Timestamp", "Value" AS "Min", "Value" AS "Max", "Value" AS "Avg", "Value" AS "Last", 1 AS "Count"
+	FROM "%s_history" WHERE "Timestamp" >= $1 AND "Timestamp" < $2`, bucket, prefix)
+	} else {
+		src = fmt.Sprintf(`SELECT "Key", %s AS "Bucket", "Timestamp", "Min", "Max", "Avg", "Last", "Count"
+	FROM "%s_rollup" WHERE "Step" = %d AND "Timestamp" >= $1 AND "Timestamp" < $2`, bucket, prefix, int64(tiers[tier-1].Step.Seconds()))
+	}
+
+	query := fmt.Sprintf(`INSERT INTO "%s_rollup" ("Key", "Step", "Timestamp", "Min", "Max", "Avg", "Last", "Count")
+SELECT "Key", %d, "Bucket", min("Min"), max("Max"), sum("Avg" * "Count") / sum("Count"), (array_agg("Last" ORDER BY "Timestamp" DESC))[1], sum("Count")
+FROM (%s) AS "src" GROUP BY "Key", "Bucket"
+ON CONFLICT ("Key", "Step", "Timestamp") DO UPDATE SET "Min" = EXCLUDED."Min", "Max" = EXCLUDED."Max", "Avg" = EXCLUDED."Avg", "Last" = EXCLUDED."Last", "Count" = EXCLUDED."Count"`,
+		prefix, step, src)
+
+	_, err := db.ExecContext(ctx, query, from, to)
+	return err
+}
+
+// Drops samples of tier `tier` older than `cutoff` of substorage with `prefix` name
+func expireDB(ctx context.Context, db *sql.DB, prefix string, tiers []storagecommons.RetentionTier, tier int, cutoff time.Time) error {
+	var err error
+	if tiers[tier].Step == 0 {
+		_, err = db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s_history" WHERE "Timestamp" < $1`, prefix), cutoff)
+	} else {
+		_, err = db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s_rollup" WHERE "Step" = %d AND "Timestamp" < $1`, prefix, int64(tiers[tier].Step.Seconds())), cutoff)
+	}
+	return err
+}
+
+// Reads samples of `key` within [from, to] time range from the finest tier covering `from`
+func readRangeDB(ctx context.Context, db *sql.DB, prefix string, tiers []storagecommons.RetentionTier, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	tier := storagecommons.SelectTier(tiers, from, time.Now())
+	if tiers[tier].Step == 0 {
+		return getHistoryDB(ctx, db, prefix+"_history", key, from, to)
+	}
+
+	query := fmt.Sprintf(`SELECT "Timestamp", "Last", "Min", "Max", "Avg", "Count" FROM "%s_rollup"
+WHERE "Key" = $1 AND "Step" = %d AND "Timestamp" BETWEEN $2 AND $3 ORDER BY "Timestamp"`, prefix, int64(tiers[tier].Step.Seconds()))
+
+	rows, err := db.QueryContext(ctx, query, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]storagecommons.Sample, 0)
+	for rows.Next() {
+		var smp storagecommons.Sample
+		err = rows.Scan(&smp.Timestamp, &smp.Value, &smp.Min, &smp.Max, &smp.Avg, &smp.Count)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, smp)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return res, nil
+}
+
+// Builds rollups of completed buckets and drops expired samples of all substorages
+func (ms *DBStore) Compact(ctx context.Context) error {
+	now := time.Now()
+
+	for _, prefix := range seriesTables {
+		for i := 1; i < len(ms.tiers); i++ {
+			end := now.Truncate(ms.tiers[i].Step)
+			from := ms.rolled[prefix][i]
+			if from.IsZero() && ms.tiers[i-1].Keep > 0 {
+				// First bucket not affected by source tier expiration
+				from = now.Add(-ms.tiers[i-1].Keep).Truncate(ms.tiers[i].Step).Add(ms.tiers[i].Step)
+			}
+			if !end.After(from) {
+				continue
+			}
+			err := rollupDB(ctx, ms.db, prefix, ms.tiers, i, from, end)
+			if err != nil {
+				return err
+			}
+			ms.rolled[prefix][i] = end
+		}
+
+		for i, tier := range ms.tiers {
+			if tier.Keep == 0 {
+				continue
+			}
+			err := expireDB(ctx, ms.db, prefix, ms.tiers, i, now.Add(-tier.Keep))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Routine for periodic history compaction
+func (ms *DBStore) compactionWorker(ctx context.Context) {
+	shared.Logger.Info("History compaction routine started")
+	for ctx.Err() == nil {
+		time.Sleep(ms.compactionInterval)
+		err := ms.Compact(ctx)
+		if err != nil {
+			shared.Logger.Sugar().Infof("History compaction failed: %s", err.Error())
+		}
+	}
+	shared.Logger.Info("History compaction routine terminated")
+}
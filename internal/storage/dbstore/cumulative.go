@@ -0,0 +1,118 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"sort"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Converts cumulative counter writes of batch to increment ones in transaction of batch write,
+// recording written values as last ones of their sources. Source states carried by batch are stored as well.
+// Batch is expected to be checked (see storagecommons.CheckCumulative), so sources move only with their increments.
+// Concurrent first writes of new source both see no previous value, so source should not write in parallel.
+// Returns converted copy of batch
+func resolveCumulative(ctx context.Context, tx pgx.Tx, metrics storagecommons.MetricsDB) (storagecommons.MetricsDB, error) {
+	idx := make([]int, 0)
+	for i, val := range metrics.MetricsDB {
+		if val.Cumulative {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) == 0 && len(metrics.Sources) == 0 {
+		return metrics, nil
+	}
+
+	// Fixed order of row locks prevents deadlocks of concurrent writers, writes of the same source keep batch order
+	sort.SliceStable(idx, func(a, b int) bool {
+		ma, mb := metrics.MetricsDB[idx[a]], metrics.MetricsDB[idx[b]]
+		if ma.Key() != mb.Key() {
+			return ma.Key() < mb.Key()
+		}
+		return ma.Source < mb.Source
+	})
+
+	res := storagecommons.MetricsDB{MetricsDB: slices.Clone(metrics.MetricsDB)}
+	b := &pgx.Batch{}
+	for _, i := range idx {
+		val := metrics.MetricsDB[i]
+		// Row is created by first write of source, otherwise previous value is read under row lock and replaced.
+		// Locking read within the same statement as update would skip the row updated by it
+		b.Queue(`INSERT INTO "counter_sources" ("Key", "Source", "Value") VALUES ($1, $2, $3) ON CONFLICT ("Key", "Source") DO NOTHING`,
+			val.Key(), val.Source, *val.Delta)
+		b.Queue(`SELECT "Value" FROM "counter_sources" WHERE "Key" = $1 AND "Source" = $2 FOR UPDATE`, val.Key(), val.Source)
+		b.Queue(`UPDATE "counter_sources" SET "Value" = $3 WHERE "Key" = $1 AND "Source" = $2`, val.Key(), val.Source, *val.Delta)
+	}
+	for _, src := range metrics.Sources {
+		b.Queue(`INSERT INTO "counter_sources" ("Key", "Source", "Value") VALUES ($1, $2, $3)
+ON CONFLICT ("Key", "Source") DO UPDATE SET "Value" = EXCLUDED."Value"`, src.Key(), src.Source, src.Value)
+	}
+
+	br := tx.SendBatch(ctx, b)
+	for _, i := range idx {
+		var last int64
+		tag, err := br.Exec()
+		if err == nil {
+			err = br.QueryRow().Scan(&last)
+		}
+		if err == nil {
+			_, err = br.Exec()
+		}
+		if err != nil {
+			br.Close()
+			return metrics, err
+		}
+		// Inserted row holds written value, so there was no previous one
+		exist := tag.RowsAffected() == 0
+		val := res.MetricsDB[i]
+		delta := storagecommons.CumulativeDelta(last, exist, *val.Delta)
+		val.Delta = &delta
+		val.Cumulative = false
+		res.MetricsDB[i] = val
+	}
+	for range metrics.Sources {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return metrics, err
+		}
+	}
+	if err := br.Close(); err != nil {
+		return metrics, err
+	}
+	return res, nil
+}
+
+// Returns last values of cumulative counters reported by sources
+func (ms *DBStore) GetCounterSources(ctx context.Context) ([]storagecommons.CounterSource, error) {
+	if ms.db == nil {
+		return nil, errors.New("database connection was not established")
+	}
+
+	rows, err := ms.db.QueryContext(ctx, `SELECT "Key", "Source", "Value" FROM "counter_sources" ORDER BY "Key", "Source"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]storagecommons.CounterSource, 0)
+	for rows.Next() {
+		var (
+			key string
+			src storagecommons.CounterSource
+		)
+		err = rows.Scan(&key, &src.Source, &src.Value)
+		if err != nil {
+			return nil, err
+		}
+		src.ID, src.Labels, _ = storagecommons.ParseSeriesKey(key)
+		res = append(res, src)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package dbstore
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func TestCumulativeCounters(t *testing.T) {
+	ctx := context.Background()
+	connectionString := testhelpers.StartPostgres(t)
+
+	db, err := New(ctx, config.ServerConfig{ConnString: connectionString}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close(ctx)
+
+	cumulative := func(source string, values ...int64) storagecommons.MetricsDB {
+		batch := storagecommons.MetricsDB{}
+		for _, v := range values {
+			v := v
+			batch.MetricsDB = append(batch.MetricsDB, storagecommons.Metrics{ID: "cc", MType: "counter", Delta: &v, Cumulative: true, Source: source})
+		}
+		return batch
+	}
+
+	for _, tc := range []struct {
+		name  string
+		batch storagecommons.MetricsDB
+		want  int64
+	}{
+		{"First Value", cumulative("a", 5), 5},
+		{"Same Value", cumulative("a", 5), 5},
+		{"Grown Value", cumulative("a", 8), 8},
+		{"Value After Reset", cumulative("a", 2), 10},
+		{"Other Source", cumulative("b", 4), 14},
+		{"Batch Of Values", cumulative("a", 3, 6), 18},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.NoError(t, db.WriteDataMulti(ctx, tc.batch))
+			data, err := db.ReadData(ctx, storagecommons.Metrics{ID: "cc", MType: "counter"})
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.want, *data.Delta)
+			}
+		})
+	}
+
+	t.Run("Rejected Batch Keeps Source", func(t *testing.T) {
+		batch := cumulative("a", 9)
+		batch.MetricsDB = append(batch.MetricsDB, storagecommons.Metrics{ID: "rg", MType: "gauge"})
+		assert.Error(t, db.WriteDataMulti(ctx, batch))
+
+		// Name of rejected metric is not registered, retry of source gets its increment
+		var d int64 = 1
+		_, err := db.WriteData(ctx, storagecommons.Metrics{ID: "rg", MType: "counter", Delta: &d})
+		assert.NoError(t, err)
+		assert.NoError(t, db.WriteDataMulti(ctx, cumulative("a", 9)))
+		data, err := db.ReadData(ctx, storagecommons.Metrics{ID: "cc", MType: "counter"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(21), *data.Delta)
+		}
+	})
+
+	t.Run("Sources Stored", func(t *testing.T) {
+		sources, err := db.GetCounterSources(ctx)
+		if assert.NoError(t, err) {
+			assert.ElementsMatch(t, []storagecommons.CounterSource{
+				{ID: "cc", Source: "a", Value: 9},
+				{ID: "cc", Source: "b", Value: 4},
+			}, sources)
+		}
+	})
+}
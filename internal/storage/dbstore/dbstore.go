@@ -3,15 +3,17 @@ package dbstore
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/prom"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
@@ -19,9 +21,15 @@ import (
 type DBStore struct {
 	Gauges              *MetricFloat64
 	Counters            *MetricInt64Sum
+	Histograms          *MetricHistogram
+	histogramBuckets    []float64
+	Summaries           *MetricSummary
+	summaryAccuracy     float64
 	syncWrite           bool
 	cachedCounters      ThreadSafeMap[int64]
 	cachedGauges        ThreadSafeMap[float64]
+	cachedHistograms    ThreadSafeMergeMap[storagecommons.Histogram]
+	cachedSummaries     ThreadSafeMergeMap[storagecommons.Summary]
 	useCache            bool
 	cachedWriteInterval time.Duration
 	db                  *sql.DB
@@ -30,6 +38,11 @@ type DBStore struct {
 	wgServer            *sync.WaitGroup
 	wgWorker            *sync.WaitGroup
 	delayedWriteResult  error
+	tiers               []storagecommons.RetentionTier
+	rolled              map[string][]time.Time // End of last rolled up bucket of each tier
+	compactionInterval  time.Duration
+	metricTTL           time.Duration
+	ttlCheckInterval    time.Duration
 }
 
 func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*DBStore, error) {
@@ -43,15 +56,48 @@ func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*DB
 	if err != nil {
 
 		logger.Info(fmt.Sprintf("Unable to connection to database: %v\n", err))
+	} else {
+		prom.Storage().RegisterDB(poolName(args.ConnString), ms.db)
+		n, err := MigrateUp(ctx, ms.db)
+		if err != nil {
+			logger.Sugar().Infof("Unable to migrate database schema: %s", err.Error())
+		} else if n > 0 {
+			logger.Sugar().Infof("Applied %d database schema migrations", n)
+		}
 	}
 
 	ms.syncWrite = args.StoreInterval == 0
 
+	ms.tiers = storagecommons.NewRetentionTiers(args.RetentionRaw, args.RetentionMinute, args.RetentionHour)
+	ms.rolled = map[string][]time.Time{
+		"gauges":     make([]time.Time, len(ms.tiers)),
+		"counters":   make([]time.Time, len(ms.tiers)),
+		"histograms": make([]time.Time, len(ms.tiers)),
+		"summaries":  make([]time.Time, len(ms.tiers)),
+	}
+	ms.compactionInterval = args.CompactionInterval
+	ms.metricTTL = args.MetricTTL
+	ms.ttlCheckInterval = args.TTLCheckInterval
+
 	ms.Gauges = NewMetricFloat64()
 	ms.Counters = NewMetricInt64Sum()
+	ms.Histograms = NewMetricHistogram()
+	ms.histogramBuckets = args.HistogramBuckets
+	ms.Summaries = NewMetricSummary()
+	ms.summaryAccuracy = args.SummaryAccuracy
 
 	ms.Gauges.db = ms.db
 	ms.Counters.db = ms.db
+	ms.Histograms.db = ms.db
+	ms.Summaries.db = ms.db
+	ms.Gauges.tiers = ms.tiers
+	ms.Counters.tiers = ms.tiers
+	ms.Histograms.tiers = ms.tiers
+	ms.Summaries.tiers = ms.tiers
+	ms.Gauges.cache = newReadCache[float64](args.ReadCacheSize)
+	ms.Counters.cache = newReadCache[int64](args.ReadCacheSize)
+	ms.Histograms.cache = newReadCache[storagecommons.Histogram](args.ReadCacheSize)
+	ms.Summaries.cache = newReadCache[storagecommons.Summary](args.ReadCacheSize)
 
 	ms.useCache = args.BandwidthPriority
 	ms.cachedWriteInterval = args.CachedWriteInterval
@@ -68,9 +114,27 @@ func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*DB
 			mutex: sync.RWMutex{},
 			data:  make(map[string]float64),
 		}
+		ms.cachedHistograms = ThreadSafeMergeMap[storagecommons.Histogram]{
+			mutex: sync.RWMutex{},
+			data:  make(map[string]storagecommons.Histogram),
+			merge: mergeHistograms,
+		}
+		ms.cachedSummaries = ThreadSafeMergeMap[storagecommons.Summary]{
+			mutex: sync.RWMutex{},
+			data:  make(map[string]storagecommons.Summary),
+			merge: mergeSummaries,
+		}
 		go ms.delayedWriteWorker(ctx)
 	}
 
+	if ms.compactionInterval > 0 {
+		go ms.compactionWorker(ctx)
+	}
+
+	if ms.ttlCheckInterval > 0 {
+		go ms.expiryWorker(ctx)
+	}
+
 	if args.Restore {
 		err := ms.Load(ctx)
 		if err != nil {
@@ -84,33 +148,25 @@ func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*DB
 // Float64
 
 type MetricFloat64 struct {
-	db *sql.DB
+	db    *sql.DB
+	tiers []storagecommons.RetentionTier
+	cache *readCache[float64]
 }
 
 func NewMetricFloat64() *MetricFloat64 {
 	return &MetricFloat64{}
 }
 
-func (ths *MetricFloat64) createTable(ctx context.Context, tx *sql.Tx) error {
-	crTableCommand := `CREATE TABLE IF NOT EXISTS public."gauges" 
-(
-    "Key" text NOT NULL,
-    "Value" double precision NOT NULL,
-    PRIMARY KEY ("Key")
-)`
-
-	db := NewTxManager(ths.db, tx)
-	_, err := db.ExecContext(ctx, crTableCommand)
-
-	return err
-}
-
 func (ths *MetricFloat64) applyValueDB(ctx context.Context, key string, value float64) error {
 
 	// Fails when executed in transaction if duplicate keys exists
-	query := `INSERT INTO "gauges" ("Key", "Value") VALUES ($1, $2) ON CONFLICT ("Key") DO UPDATE SET "Value" = EXCLUDED."Value"`
+	query := `WITH "upd" AS (
+	INSERT INTO "gauges" ("Key", "Labels", "Value") VALUES ($1, $2, $3) ON CONFLICT ("Key") DO UPDATE SET "Value" = EXCLUDED."Value", "Updated" = now()
+	RETURNING "Key", "Value"
+) INSERT INTO "gauges_history" ("Key", "Timestamp", "Value") SELECT "Key", now(), "Value" FROM "upd"`
 
-	_, err := ths.db.ExecContext(ctx, query, key, value)
+	_, err := ths.db.ExecContext(ctx, query, key, labelsJSON(key), value)
+	ths.cache.invalidate(key)
 
 	if err != nil {
 		return err
@@ -118,105 +174,34 @@ func (ths *MetricFloat64) applyValueDB(ctx context.Context, key string, value fl
 	return nil
 }
 
-func (ths *MetricFloat64) applyValueDBBatch(ctx context.Context, tx *sql.Tx, data map[string]float64) error {
-
-	if data == nil {
-		return nil
-	}
-
-	ctr := 0
-	paramsStr := make([]string, len(data))
-	paramsVals := make([]any, len(data)*2)
-
+// Writes gauges via COPY into staging table (no limit of query parameters number)
+func (ths *MetricFloat64) applyValueDBBatch(ctx context.Context, tx pgx.Tx, data map[string]float64, recorded []string) error {
+	rows := make([][]any, 0, len(data))
 	for key, val := range data {
-		key, val := key, val
-		paramsStr[ctr] = fmt.Sprintf("($%d,$%d)", ctr*2+1, ctr*2+2)
-		paramsVals[ctr*2] = key
-		paramsVals[ctr*2+1] = val
-		ctr++
-	}
-
-	if ctr == 0 {
-		return nil
-	}
-
-	err := ths.createTable(ctx, tx)
-	if err != nil {
-		return err
+		rows = append(rows, []any{key, labelsJSON(key), val})
 	}
-
-	query := `INSERT INTO "gauges" ("Key", "Value") VALUES ` + strings.Join(paramsStr, ",") + " "
-	query += `ON CONFLICT ("Key") DO UPDATE SET "Value" = EXCLUDED."Value"`
-
-	db := NewTxManager(ths.db, tx)
-	_, err = db.ExecContext(ctx, query, paramsVals...)
-	if err != nil {
-		println(err.Error())
-		return err
-	}
-
-	return nil
-
+	return copyMerge(ctx, tx, "gauges", "double precision", `EXCLUDED."Value"`, rows, recorded)
 }
 
 func (ths *MetricFloat64) getValueDB(ctx context.Context, keys ...string) (map[string]float64, error) {
-
-	ks := make([]any, 0)
-	for _, v := range keys {
-		ks = append(ks, v)
-	}
-
-	syms := map[bool]rune{true: ',', false: ')'}
-	var query string
-	if len(keys) == 0 {
-		query = `SELECT * FROM "gauges"`
-	} else {
-		query = `SELECT * FROM "gauges" WHERE "Key" IN (`
-		for i := range keys {
-			query += fmt.Sprintf("$%d%c", i+1, syms[i < len(keys)-1])
-		}
-	}
-
-	res := make(map[string]float64)
-
-	var err error
-	rows, err := ths.db.QueryContext(ctx, query, ks...)
-
-	if err != nil {
-		return nil, err
-	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
-	}
-
-	var (
-		key string
-		val float64
-	)
-	for rows.Next() {
-		err = rows.Scan(&key, &val)
-		if err != nil {
-			return nil, err
-		}
-		res[key] = val
-	}
-	err = rows.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	return res, nil
+	return readValuesDB(ctx, ths.db, "gauges", keys, func(rows *sql.Rows) (string, float64, error) {
+		var (
+			key string
+			val float64
+		)
+		err := rows.Scan(&key, &val)
+		return key, val, err
+	})
 }
 
 func (ths *MetricFloat64) ReadData(ctx context.Context, keys ...string) (map[string]float64, error) {
+	return ths.cache.read(keys, func(keys []string) (map[string]float64, error) {
+		return ths.getValueDB(ctx, keys...)
+	})
+}
 
-	db, err := ths.getValueDB(ctx, keys...)
-	if err != nil {
-		return nil, err
-	}
-
-	return db, nil
-
+func (ths *MetricFloat64) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return readRangeDB(ctx, ths.db, "gauges", ths.tiers, key, from, to)
 }
 
 func (ths *MetricFloat64) WriteData(ctx context.Context, key string, value string) error {
@@ -224,11 +209,6 @@ func (ths *MetricFloat64) WriteData(ctx context.Context, key string, value strin
 
 	if err == nil {
 
-		err := ths.createTable(ctx, nil)
-		if err != nil {
-			return err
-		}
-
 		err = ths.applyValueDB(ctx, key, v)
 		if err != nil {
 			return err
@@ -241,12 +221,7 @@ func (ths *MetricFloat64) WriteData(ctx context.Context, key string, value strin
 
 func (ths *MetricFloat64) WriteDataPP(ctx context.Context, key string, value float64) error {
 
-	err := ths.createTable(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	err = ths.applyValueDB(ctx, key, value)
+	err := ths.applyValueDB(ctx, key, value)
 	if err != nil {
 		return err
 	}
@@ -256,32 +231,24 @@ func (ths *MetricFloat64) WriteDataPP(ctx context.Context, key string, value flo
 // Int64 Cumulative
 
 type MetricInt64Sum struct {
-	db *sql.DB
+	db    *sql.DB
+	tiers []storagecommons.RetentionTier
+	cache *readCache[int64]
 }
 
 func NewMetricInt64Sum() *MetricInt64Sum {
 	return &MetricInt64Sum{}
 }
 
-func (ths *MetricInt64Sum) createTable(ctx context.Context, tx *sql.Tx) error {
-	crTableCommand := `CREATE TABLE IF NOT EXISTS public."counters"
-( 
-    "Key" text NOT NULL,
-	"Value" bigint NOT NULL,
-	PRIMARY KEY ("Key")
-)`
-
-	db := NewTxManager(ths.db, tx)
-	_, err := db.ExecContext(ctx, crTableCommand)
-
-	return err
-}
-
 func (ths *MetricInt64Sum) applyValueDB(ctx context.Context, key string, value int64) error {
 
-	query := `INSERT INTO "counters" ("Key", "Value") VALUES ($1, $2) ON CONFLICT ("Key") DO UPDATE SET "Value" = "counters"."Value" + EXCLUDED."Value"`
+	query := `WITH "upd" AS (
+	INSERT INTO "counters" ("Key", "Labels", "Value") VALUES ($1, $2, $3) ON CONFLICT ("Key") DO UPDATE SET "Value" = "counters"."Value" + EXCLUDED."Value", "Updated" = now()
+	RETURNING "Key", "Value"
+) INSERT INTO "counters_history" ("Key", "Timestamp", "Value") SELECT "Key", now(), "Value" FROM "upd"`
 
-	_, err := ths.db.ExecContext(ctx, query, key, value)
+	_, err := ths.db.ExecContext(ctx, query, key, labelsJSON(key), value)
+	ths.cache.invalidate(key)
 
 	if err != nil {
 		return err
@@ -290,185 +257,300 @@ func (ths *MetricInt64Sum) applyValueDB(ctx context.Context, key string, value i
 	return nil
 }
 
-func (ths *MetricInt64Sum) applyValueDBBatch(ctx context.Context, tx *sql.Tx, data map[string]int64) error {
-
-	if data == nil {
-		return nil
+// Adds counter deltas via COPY into staging table (no limit of query parameters number)
+func (ths *MetricInt64Sum) applyValueDBBatch(ctx context.Context, tx pgx.Tx, data map[string]int64, recorded []string) error {
+	rows := make([][]any, 0, len(data))
+	for key, val := range data {
+		rows = append(rows, []any{key, labelsJSON(key), val})
 	}
+	return copyMerge(ctx, tx, "counters", "bigint", `"counters"."Value" + EXCLUDED."Value"`, rows, recorded)
+}
 
-	ctr := 0
-	paramsStr := make([]string, len(data))
-	paramsVals := make([]any, len(data)*2)
+func (ths *MetricInt64Sum) getValueDB(ctx context.Context, keys ...string) (map[string]int64, error) {
+	return readValuesDB(ctx, ths.db, "counters", keys, func(rows *sql.Rows) (string, int64, error) {
+		var (
+			key string
+			val int64
+		)
+		err := rows.Scan(&key, &val)
+		return key, val, err
+	})
+}
 
-	for key, val := range data {
-		key, val := key, val
-		paramsStr[ctr] = fmt.Sprintf("($%d,$%d)", ctr*2+1, ctr*2+2)
-		paramsVals[ctr*2] = key
-		paramsVals[ctr*2+1] = val
-		ctr++
-	}
+func (ths *MetricInt64Sum) ReadData(ctx context.Context, keys ...string) (map[string]int64, error) {
+	return ths.cache.read(keys, func(keys []string) (map[string]int64, error) {
+		return ths.getValueDB(ctx, keys...)
+	})
+}
+
+func (ths *MetricInt64Sum) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return readRangeDB(ctx, ths.db, "counters", ths.tiers, key, from, to)
+}
+
+func (ths *MetricInt64Sum) WriteData(ctx context.Context, key string, value string) error {
 
-	if ctr == 0 {
-		return nil
+	val, err := strconv.Atoi(value)
+	if err != nil {
+		return err
 	}
 
-	err := ths.createTable(ctx, tx)
+	//ths.data[key] += v
+	err = ths.applyValueDB(ctx, key, int64(val))
 	if err != nil {
 		return err
 	}
 
-	query := `INSERT INTO "counters" ("Key", "Value") VALUES ` + strings.Join(paramsStr, ",") + " "
-	query += `ON CONFLICT ("Key") DO UPDATE SET "Value" = "counters"."Value" + EXCLUDED."Value"`
+	return nil
+}
 
-	db := NewTxManager(ths.db, tx)
-	_, err = db.ExecContext(ctx, query, paramsVals...)
+func (ths *MetricInt64Sum) WriteDataPP(ctx context.Context, key string, value int64) error {
+	//ths.data[key] += v
+	err := ths.applyValueDB(ctx, key, value)
 	if err != nil {
 		return err
 	}
 
 	return nil
-
 }
 
-func (ths *MetricInt64Sum) getValueDB(ctx context.Context, keys ...string) (map[string]int64, error) {
-
-	ks := make([]any, 0)
-	for _, v := range keys {
-		ks = append(ks, v)
+// Returns JSON representation of labels encoded in series key
+func labelsJSON(key string) string {
+	_, labels, _ := storagecommons.ParseSeriesKey(key)
+	if labels == nil {
+		return "{}"
 	}
-
-	syms := map[bool]rune{true: ',', false: ')'}
-	var query string
-	if len(keys) == 0 {
-		query = `SELECT * FROM "counters"`
-	} else {
-		query = `SELECT * FROM "counters" WHERE "Key" IN (`
-		for i := range keys {
-			query += fmt.Sprintf("$%d%c", i+1, syms[i < len(keys)-1])
-		}
+	jsn, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
 	}
+	return string(jsn)
+}
 
-	res := make(map[string]int64)
-
-	rows, err := ths.db.QueryContext(ctx, query, ks...)
-
+// Reads values of series `keys` from `table` (all series if no keys given).
+// Requested keys are looked up by primary key index, so reads do not depend on table size
+func readValuesDB[T any](ctx context.Context, db *sql.DB, table string, keys []string, scan func(rows *sql.Rows) (string, T, error)) (map[string]T, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	switch len(keys) {
+	case 0:
+		rows, err = db.QueryContext(ctx, fmt.Sprintf(`SELECT "Key", "Value" FROM "%s"`, table))
+	case 1:
+		rows, err = db.QueryContext(ctx, fmt.Sprintf(`SELECT "Key", "Value" FROM "%s" WHERE "Key" = $1`, table), keys[0])
+	default:
+		rows, err = db.QueryContext(ctx, fmt.Sprintf(`SELECT "Key", "Value" FROM "%s" WHERE "Key" = ANY($1)`, table), keys)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
-	}
+	defer rows.Close()
 
-	var (
-		key string
-		val int64
-	)
+	res := make(map[string]T, len(keys))
 	for rows.Next() {
-		err = rows.Scan(&key, &val)
+		key, val, err := scan(rows)
 		if err != nil {
 			return nil, err
 		}
 		res[key] = val
 	}
-	err = rows.Close()
-	if err != nil {
-		return nil, err
+	if rows.Err() != nil {
+		return nil, rows.Err()
 	}
 
 	return res, nil
 }
 
-func (ths *MetricInt64Sum) ReadData(ctx context.Context, keys ...string) (map[string]int64, error) {
+// Scans key and JSON encoded value
+func scanJSON[T any](rows *sql.Rows) (string, T, error) {
+	var (
+		key string
+		jsn string
+		val T
+	)
+	err := rows.Scan(&key, &jsn)
+	if err != nil {
+		return key, val, err
+	}
+	err = json.Unmarshal([]byte(jsn), &val)
+	return key, val, err
+}
+
+// History
 
-	db, err := ths.getValueDB(ctx, keys...)
+// Reads samples of `key` within [from, to] time range from history table
+func getHistoryDB(ctx context.Context, db *sql.DB, table string, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	query := `SELECT "Timestamp", "Value" FROM "` + table + `" WHERE "Key" = $1 AND "Timestamp" BETWEEN $2 AND $3 ORDER BY "Timestamp"`
+
+	rows, err := db.QueryContext(ctx, query, key, from, to)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return db, nil
-}
+	res := make([]storagecommons.Sample, 0)
+	for rows.Next() {
+		var smp storagecommons.Sample
+		err = rows.Scan(&smp.Timestamp, &smp.Value)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, smp)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 
-func (ths *MetricInt64Sum) WriteData(ctx context.Context, key string, value string) error {
+	return res, nil
+}
 
-	val, err := strconv.Atoi(value)
+// Common point for writing data.
+// Whole batch is checked first, then metadata, sources of cumulative counters and values are written
+// in single transaction, so rejected batch doesn't move sources (their retries would lose increments)
+// or register types. Raw samples of batch history replace samples of write time of their series.
+// In bandwidth priority mode values are written later by worker, which records their samples (batch history is skipped)
+func (ms *DBStore) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	mds, err := storagecommons.BatchMetadata(metrics.MetricsDB, time.Now())
 	if err != nil {
 		return err
 	}
-
-	err = ths.createTable(ctx, nil)
-	if err != nil {
+	for _, val := range metrics.MetricsDB {
+		if err := storagecommons.CheckCumulative(val); err != nil {
+			return err
+		}
+	}
+	if _, err := ms.mergeBatch(metrics); err != nil {
 		return err
 	}
+	if ms.db == nil {
+		return errors.New("database connection was not established")
+	}
 
-	//ths.data[key] += v
-	err = ths.applyValueDB(ctx, key, int64(val))
+	if ms.useCache {
+		err = ms.writeCached(ctx, mds, metrics)
+		if err != nil {
+			return err
+		}
+		return ms.setTTLs(ctx, metrics)
+	}
+
+	var vals batchValues
+	// Cached values are dropped after transaction end, so values read before commit are not cached
+	defer func() { ms.invalidateCached(vals) }()
+	err = withPgxTx(ctx, ms.db, func(tx pgx.Tx) error {
+		err := registerMetadata(ctx, tx, mds)
+		if err != nil {
+			return err
+		}
+		resolved, err := resolveCumulative(ctx, tx, metrics)
+		if err != nil {
+			return err
+		}
+		vals, err = ms.mergeBatch(resolved)
+		if err != nil {
+			return err
+		}
+		return ms.applyBatch(ctx, tx, vals)
+	})
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return ms.setTTLs(ctx, metrics)
 }
 
-func (ths *MetricInt64Sum) WriteDataPP(ctx context.Context, key string, value int64) error {
-	err := ths.createTable(ctx, nil)
-	if err != nil {
-		return err
+// Adds checked batch to values written by worker and waits for their write
+func (ms *DBStore) writeCached(ctx context.Context, mds []storagecommons.MetricMetadata, metrics storagecommons.MetricsDB) error {
+	// Histograms and summaries are prepared by series, so they are merged into cached values in batch order
+	histograms := make(map[string][]storagecommons.Histogram)
+	summaries := make(map[string][]storagecommons.Summary)
+	for _, val := range metrics.MetricsDB {
+		switch val.MType {
+		case "histogram":
+			h, err := storagecommons.PrepareHistogram(val.Histogram, ms.histogramBuckets)
+			if err != nil {
+				return err
+			}
+			histograms[val.Key()] = append(histograms[val.Key()], h)
+		case "summary":
+			s, err := storagecommons.PrepareSummary(val.Summary, ms.summaryAccuracy)
+			if err != nil {
+				return err
+			}
+			summaries[val.Key()] = append(summaries[val.Key()], s)
+		}
 	}
 
-	//ths.data[key] += v
-	err = ths.applyValueDB(ctx, key, value)
+	// Wait for worker
+	ms.wgWorker.Wait()
+
+	ms.wgServer.Add(1)
+	// Cached values are changed by one writer at a time, so they can't conflict with batch after it is checked
+	ms.delayedWriteMutex.Lock()
+	err := ms.fillCached(ctx, mds, metrics, histograms, summaries)
+	ms.delayedWriteMutex.Unlock()
 	if err != nil {
+		ms.wgServer.Done()
 		return err
 	}
 
-	return nil
+	ms.delayedWriteCond.L.Lock()
+	ms.wgServer.Done()
+
+	// Waiting for release
+	ms.delayedWriteCond.Wait()
+	ms.delayedWriteCond.L.Unlock()
+	return ms.delayedWriteResult
 }
 
-// Common point for writing data
-func (ms *DBStore) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
-	if !ms.useCache {
-		return ms.WriteDataMultiBatch(ctx, metrics)
-	} else {
-		// Wait for worker
-		ms.wgWorker.Wait()
-
-		ms.wgServer.Add(1)
-		// Fill maps
-		// Check for errors
-		for _, val := range metrics.MetricsDB {
-			switch val.MType {
-			case "counter":
-				if val.Delta == nil {
-					return errors.New("no Delta data provided")
-				}
-			case "gauge":
-				if val.Value == nil {
-					return errors.New("no Value data provided")
-				}
-			default:
-				return errors.New("Unknown metric type: " + val.MType)
-			}
+// Checks batch against cached values, then writes metadata and sources of cumulative counters in transaction
+// and fills cache with resolved values. Rejected batch changes neither DB nor cache
+func (ms *DBStore) fillCached(ctx context.Context, mds []storagecommons.MetricMetadata, metrics storagecommons.MetricsDB,
+	histograms map[string][]storagecommons.Histogram, summaries map[string][]storagecommons.Summary) error {
+
+	for key, values := range histograms {
+		if err := ms.cachedHistograms.CheckMerge(key, values...); err != nil {
+			return fmt.Errorf("histogram/%s: %w", key, err)
 		}
-		// Filling data
-		for _, val := range metrics.MetricsDB {
-			val := val
-			switch val.MType {
-			case "counter":
-				ms.cachedCounters.Inc(val.ID, *val.Delta)
-			case "gauge":
-				ms.cachedGauges.Set(val.ID, *val.Value)
-			}
+	}
+	for key, values := range summaries {
+		if err := ms.cachedSummaries.CheckMerge(key, values...); err != nil {
+			return fmt.Errorf("summary/%s: %w", key, err)
 		}
-		// End Fill maps
+	}
 
-		ms.delayedWriteCond.L.Lock()
-		ms.wgServer.Done()
+	var resolved storagecommons.MetricsDB
+	err := withPgxTx(ctx, ms.db, func(tx pgx.Tx) error {
+		err := registerMetadata(ctx, tx, mds)
+		if err != nil {
+			return err
+		}
+		resolved, err = resolveCumulative(ctx, tx, metrics)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-		// Waiting for release
-		ms.delayedWriteCond.Wait()
-		ms.delayedWriteCond.L.Unlock()
-		return ms.delayedWriteResult
+	// Fill maps, merges are checked above
+	for _, val := range resolved.MetricsDB {
+		switch val.MType {
+		case "counter":
+			ms.cachedCounters.Inc(val.Key(), *val.Delta)
+		case "gauge":
+			ms.cachedGauges.Set(val.Key(), *val.Value)
+		}
+	}
+	for key, values := range histograms {
+		for _, h := range values {
+			ms.cachedHistograms.Merge(key, h)
+		}
 	}
+	for key, values := range summaries {
+		for _, s := range values {
+			ms.cachedSummaries.Merge(key, s)
+		}
+	}
+	return nil
 }
 
 func (ms *DBStore) WriteData(ctx context.Context, metrics storagecommons.Metrics) (rMetrics storagecommons.Metrics, rError error) {
@@ -484,90 +566,202 @@ func (ms *DBStore) WriteData(ctx context.Context, metrics storagecommons.Metrics
 	return
 }
 
-// Batch write Raw
-func (ms *DBStore) WriteDataMultiBatchRaw(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
-
-	tx, _ := ms.db.BeginTx(ctx, nil)
-	if tx == nil {
-		return errors.New("cannot begin transaction")
-	}
+// Values of batch merged by series keys
+type batchValues struct {
+	gauges     map[string]float64
+	counters   map[string]int64
+	histograms map[string]storagecommons.Histogram
+	summaries  map[string]storagecommons.Summary
+	history    []storagecommons.MetricHistory // Raw samples of series written before batch (see writeHistory)
+	recorded   map[string][]string            // Keys of series with samples in history by metric type
+}
 
-	ms.Gauges.applyValueDBBatch(ctx, tx, gauges)
-	ms.Counters.applyValueDBBatch(ctx, tx, counters)
+// Drops cached reads of batch series
+func (ms *DBStore) invalidateCached(vals batchValues) {
+	ms.Gauges.cache.invalidate(mapKeys(vals.gauges)...)
+	ms.Counters.cache.invalidate(mapKeys(vals.counters)...)
+	ms.Histograms.cache.invalidate(mapKeys(vals.histograms)...)
+	ms.Summaries.cache.invalidate(mapKeys(vals.summaries)...)
+}
 
-	err := tx.Commit()
+// Writes batch values in transaction
+func (ms *DBStore) applyBatch(ctx context.Context, tx pgx.Tx, vals batchValues) error {
+	err := ms.Gauges.applyValueDBBatch(ctx, tx, vals.gauges, vals.recorded["gauge"])
 	if err != nil {
 		return err
 	}
+	err = ms.Counters.applyValueDBBatch(ctx, tx, vals.counters, vals.recorded["counter"])
+	if err != nil {
+		return err
+	}
+	err = ms.Histograms.applyValueDBBatch(ctx, tx, vals.histograms, vals.recorded["histogram"])
+	if err != nil {
+		return err
+	}
+	err = ms.Summaries.applyValueDBBatch(ctx, tx, vals.summaries, vals.recorded["summary"])
+	if err != nil {
+		return err
+	}
+	return writeHistory(ctx, tx, vals.history)
+}
 
-	return nil
+// Batch write Raw
+func (ms *DBStore) WriteDataMultiBatchRaw(ctx context.Context, gauges map[string]float64, counters map[string]int64, histograms map[string]storagecommons.Histogram, summaries map[string]storagecommons.Summary) error {
+	vals := batchValues{gauges: gauges, counters: counters, histograms: histograms, summaries: summaries}
+	// Cached values are dropped after transaction end, so values read before commit are not cached
+	defer ms.invalidateCached(vals)
+
+	return withPgxTx(ctx, ms.db, func(tx pgx.Tx) error {
+		return ms.applyBatch(ctx, tx, vals)
+	})
 }
 
 // Batch write
 func (ms *DBStore) WriteDataMultiBatch(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	vals, err := ms.mergeBatch(metrics)
+	if err != nil {
+		return err
+	}
+
+	return ms.WriteDataMultiBatchRaw(ctx, vals.gauges, vals.counters, vals.histograms, vals.summaries)
+}
 
+// Checks batch values and merges them by series keys (cumulative counter values are merged as increments)
+func (ms *DBStore) mergeBatch(metrics storagecommons.MetricsDB) (batchValues, error) {
 	gauges := map[string]float64{}
 	counters := map[string]int64{}
+	histograms := map[string]storagecommons.Histogram{}
+	summaries := map[string]storagecommons.Summary{}
 
 	for _, val := range metrics.MetricsDB {
 		val := val
 		switch val.MType {
 		case "counter":
 			if val.Delta == nil {
-				return errors.New("no Delta data provided")
+				return batchValues{}, errors.New("no Delta data provided")
 			}
-			counters[val.ID] += *val.Delta
+			counters[val.Key()] += *val.Delta
 		case "gauge":
 			if val.Value == nil {
-				return errors.New("no Value data provided")
+				return batchValues{}, errors.New("no Value data provided")
+			}
+			gauges[val.Key()] = *val.Value
+		case "histogram":
+			h, err := storagecommons.PrepareHistogram(val.Histogram, ms.histogramBuckets)
+			if err != nil {
+				return batchValues{}, err
 			}
-			gauges[val.ID] = *val.Value
+			cur, ok := histograms[val.Key()]
+			h, err = mergeHistograms(cur, ok, h)
+			if err != nil {
+				return batchValues{}, fmt.Errorf("histogram/%s: %w", val.Key(), err)
+			}
+			histograms[val.Key()] = h
+		case "summary":
+			s, err := storagecommons.PrepareSummary(val.Summary, ms.summaryAccuracy)
+			if err != nil {
+				return batchValues{}, err
+			}
+			cur, ok := summaries[val.Key()]
+			s, err = mergeSummaries(cur, ok, s)
+			if err != nil {
+				return batchValues{}, fmt.Errorf("summary/%s: %w", val.Key(), err)
+			}
+			summaries[val.Key()] = s
 		default:
-			return errors.New("Unknown metric type: " + val.MType)
+			return batchValues{}, errors.New("Unknown metric type: " + val.MType)
 		}
 	}
 
-	err := ms.WriteDataMultiBatchRaw(ctx, gauges, counters)
-	if err != nil {
-		return err
+	recorded := make(map[string][]string)
+	for _, h := range metrics.History {
+		if !storagecommons.IsKnownType(h.MType) {
+			return batchValues{}, errors.New("Unknown metric type: " + h.MType)
+		}
+		if h.Step != 0 {
+			return batchValues{}, errors.New("only raw samples can be written with batch")
+		}
+		recorded[h.MType] = append(recorded[h.MType], storagecommons.SeriesKey(h.ID, h.Labels))
 	}
 
-	return nil
+	return batchValues{gauges: gauges, counters: counters, histograms: histograms, summaries: summaries,
+		history: metrics.History, recorded: recorded}, nil
 }
 
 func (ms *DBStore) ReadData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
 	switch metrics.MType {
 	case "gauge":
-		data, err := ms.Gauges.ReadData(ctx)
+		data, err := ms.Gauges.ReadData(ctx, metrics.Key())
 
 		if err != nil {
 			return metrics, err
 		}
 
-		vl, exist := data[metrics.ID]
+		vl, exist := data[metrics.Key()]
 		if exist {
 			metrics.Value = &vl
 			return metrics, nil
 		}
-		return metrics, errors.New("Key gauge/" + metrics.ID + " not exists")
+		return metrics, storagecommons.NotExistsError("gauge", metrics.Key())
 	case "counter":
-		data, err := ms.Counters.ReadData(ctx)
+		data, err := ms.Counters.ReadData(ctx, metrics.Key())
 
 		if err != nil {
 			return metrics, err
 		}
 
-		vl, exist := data[metrics.ID]
+		vl, exist := data[metrics.Key()]
 		if exist {
 			metrics.Delta = &vl
 			return metrics, nil
 		}
-		return metrics, errors.New("Key counter/" + metrics.ID + " not exists")
+		return metrics, storagecommons.NotExistsError("counter", metrics.Key())
+	case "histogram":
+		data, err := ms.Histograms.ReadData(ctx, metrics.Key())
+
+		if err != nil {
+			return metrics, err
+		}
+
+		vl, exist := data[metrics.Key()]
+		if exist {
+			metrics.Histogram = &vl
+			return metrics, nil
+		}
+		return metrics, storagecommons.NotExistsError("histogram", metrics.Key())
+	case "summary":
+		data, err := ms.Summaries.ReadData(ctx, metrics.Key())
+
+		if err != nil {
+			return metrics, err
+		}
+
+		vl, exist := data[metrics.Key()]
+		if exist {
+			metrics.Summary = &vl
+			return metrics, nil
+		}
+		return metrics, storagecommons.NotExistsError("summary", metrics.Key())
 	default:
 		return metrics, errors.New("Unknown metric type: " + metrics.MType)
 	}
 }
 
+func (ms *DBStore) ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	switch mtype {
+	case "gauge":
+		return ms.Gauges.ReadRange(ctx, id, from, to)
+	case "counter":
+		return ms.Counters.ReadRange(ctx, id, from, to)
+	case "histogram":
+		return ms.Histograms.ReadRange(ctx, id, from, to)
+	case "summary":
+		return ms.Summaries.ReadRange(ctx, id, from, to)
+	default:
+		return nil, errors.New("Unknown metric type: " + mtype)
+	}
+}
+
 func (ms *DBStore) Close(ctx context.Context) error {
 	if ms.db != nil {
 		return ms.db.Close()
@@ -583,6 +777,28 @@ func (ms *DBStore) GetCounters() storagecommons.StoragerInt64Sum {
 	return ms.Counters
 }
 
+func (ms *DBStore) GetHistograms() storagecommons.StoragerHistogram {
+	return ms.Histograms
+}
+
+func (ms *DBStore) GetSummaries() storagecommons.StoragerSummary {
+	return ms.Summaries
+}
+
+// Returns number of stored series by metric type (counted by DB in single query)
+func (ms *DBStore) SeriesCount(ctx context.Context) (map[string]int, error) {
+	var gauges, counters, histograms, summaries int
+	err := ms.db.QueryRowContext(ctx, `SELECT
+    (SELECT COUNT(*) FROM "gauges"),
+    (SELECT COUNT(*) FROM "counters"),
+    (SELECT COUNT(*) FROM "histograms"),
+    (SELECT COUNT(*) FROM "summaries")`).Scan(&gauges, &counters, &histograms, &summaries)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"gauge": gauges, "counter": counters, "histogram": histograms, "summary": summaries}, nil
+}
+
 func (ms *DBStore) Ping(ctx context.Context) error {
 	if ms.db == nil {
 		return errors.New("database connection was not established")
@@ -2,8 +2,11 @@ package dbstore
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"go.uber.org/zap"
 	"strconv"
+	"strings"
 	"testing"
 	"yaprakticum-go-track2/internal/config"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
@@ -78,3 +81,72 @@ func BenchmarkDBStore_WriteDataMulti(b *testing.B) {
 func BenchmarkDBStore_WriteDataMultiBatch(b *testing.B) {
 	performTest(b, 1)
 }
+
+// Former gauges batch write building single INSERT ... VALUES query with 3 parameters per row, kept for comparison.
+// Query is planned anew on every call and fails on batches over 21845 rows (65535 parameters limit)
+func writeGaugesValues(ctx context.Context, db *sql.DB, data map[string]float64) error {
+	paramsStr := make([]string, 0, len(data))
+	paramsVals := make([]any, 0, len(data)*3)
+	for key, val := range data {
+		n := len(paramsVals)
+		paramsStr = append(paramsStr, fmt.Sprintf("($%d,$%d,$%d)", n+1, n+2, n+3))
+		paramsVals = append(paramsVals, key, labelsJSON(key), val)
+	}
+
+	query := `WITH "upd" AS (INSERT INTO "gauges" ("Key", "Labels", "Value") VALUES ` + strings.Join(paramsStr, ",") + " "
+	query += `ON CONFLICT ("Key") DO UPDATE SET "Value" = EXCLUDED."Value", "Updated" = now() RETURNING "Key", "Value") `
+	query += `INSERT INTO "gauges_history" ("Key", "Timestamp", "Value") SELECT "Key", now(), "Value" FROM "upd"`
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, query, paramsVals...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func BenchmarkDBStore_WriteGauges(b *testing.B) {
+	ctx := context.Background()
+	pg, err := testhelpers.NewPostgresContainer()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pg.Close()
+	connstr, err := pg.ConnectionString()
+	if err != nil {
+		b.Fatal(err)
+	}
+	store, err := New(ctx, config.ServerConfig{ConnString: connstr}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{500, 5000, 20000, 100000} {
+		data := make(map[string]float64, size)
+		for i := 0; i < size; i++ {
+			data["gauge"+strconv.Itoa(i)] = float64(i)
+		}
+
+		if size*3 <= 65535 {
+			b.Run(fmt.Sprintf("Values_%d", size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := writeGaugesValues(ctx, store.db, data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+
+		b.Run(fmt.Sprintf("Copy_%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := store.WriteDataMultiBatchRaw(ctx, data, nil, nil, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package dbstore
 import (
 	"context"
 	"time"
+	"yaprakticum-go-track2/internal/prom"
 	"yaprakticum-go-track2/internal/shared"
 )
 
@@ -16,9 +17,13 @@ func (ms *DBStore) delayedWriteWorker(ctx context.Context) {
 		ms.wgServer.Wait()
 
 		// Write data
-		ms.delayedWriteResult = ms.WriteDataMultiBatchRaw(ctx, ms.cachedGauges.GetData(), ms.cachedCounters.GetData())
+		start := time.Now()
+		ms.delayedWriteResult = ms.WriteDataMultiBatchRaw(ctx, ms.cachedGauges.GetData(), ms.cachedCounters.GetData(), ms.cachedHistograms.GetData(), ms.cachedSummaries.GetData())
+		prom.Storage().ObserveFlush("postgres", start, ms.delayedWriteResult)
 		ms.cachedCounters.Clear()
 		ms.cachedGauges.Clear()
+		ms.cachedHistograms.Clear()
+		ms.cachedSummaries.Clear()
 
 		// Report operation finished
 		ms.delayedWriteCond.Broadcast()
@@ -0,0 +1,153 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"yaprakticum-go-track2/internal/shared"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Names of substorage tables by metric type
+var seriesTables = map[string]string{
+	"gauge":     "gauges",
+	"counter":   "counters",
+	"histogram": "histograms",
+	"summary":   "summaries",
+}
+
+// Sets series own TTL in seconds (0 - use global TTL)
+func setTTLDB(ctx context.Context, db DBQueryManager, mtype string, key string, ttl int64) error {
+	if ttl <= 0 {
+		_, err := db.ExecContext(ctx, `DELETE FROM "series_ttl" WHERE "Type" = $1 AND "Key" = $2`, mtype, key)
+		return err
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO "series_ttl" ("Type", "Key", "TTL") VALUES ($1, $2, $3)
+ON CONFLICT ("Type", "Key") DO UPDATE SET "TTL" = EXCLUDED."TTL"`, mtype, key, ttl)
+	return err
+}
+
+// Sets own TTLs of written series
+func (ms *DBStore) setTTLs(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	for _, val := range metrics.MetricsDB {
+		if val.TTL == nil {
+			continue
+		}
+		err := setTTLDB(ctx, NewTxManager(ms.db, nil), val.MType, val.Key(), *val.TTL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *DBStore) Delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	table, ok := seriesTables[metrics.MType]
+	if !ok {
+		return errors.New("Unknown metric type: " + metrics.MType)
+	}
+
+	tx, _ := ms.db.BeginTx(ctx, nil)
+	if tx == nil {
+		return errors.New("cannot begin transaction")
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s" WHERE "Key" = $1`, table), metrics.Key())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return storagecommons.NotExistsError(metrics.MType, metrics.Key())
+	}
+
+	for _, query := range []string{
+		fmt.Sprintf(`DELETE FROM "%s_history" WHERE "Key" = $1`, table),
+		fmt.Sprintf(`DELETE FROM "%s_rollup" WHERE "Key" = $1`, table),
+		fmt.Sprintf(`DELETE FROM "series_ttl" WHERE "Type" = '%s' AND "Key" = $1`, metrics.MType),
+	} {
+		_, err = tx.ExecContext(ctx, query, metrics.Key())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if metrics.MType == "counter" {
+		_, err = tx.ExecContext(ctx, `DELETE FROM "counter_sources" WHERE "Key" = $1`, metrics.Key())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	ms.invalidate(metrics.MType, metrics.Key())
+	return err
+}
+
+// Drops series not updated within their TTL (own TTL if set, global otherwise) of all substorages
+func (ms *DBStore) Expire(ctx context.Context) error {
+	for mtype, table := range seriesTables {
+		query := fmt.Sprintf(`WITH "del" AS (
+	DELETE FROM "%[1]s" AS "m" WHERE "m"."Updated" < now() - make_interval(secs => NULLIF(coalesce(
+		(SELECT "TTL" FROM "series_ttl" AS "t" WHERE "t"."Type" = '%[2]s' AND "t"."Key" = "m"."Key"), $1), 0))
+	RETURNING "Key"
+), "hst" AS (
+	DELETE FROM "%[1]s_history" WHERE "Key" IN (SELECT "Key" FROM "del")
+), "rlp" AS (
+	DELETE FROM "%[1]s_rollup" WHERE "Key" IN (SELECT "Key" FROM "del")
+) DELETE FROM "series_ttl" WHERE "Type" = '%[2]s' AND "Key" IN (SELECT "Key" FROM "del")`, table, mtype)
+
+		_, err := ms.db.ExecContext(ctx, query, int64(ms.metricTTL.Seconds()))
+		ms.invalidate(mtype)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Routine for periodic expired series removal
+func (ms *DBStore) expiryWorker(ctx context.Context) {
+	shared.Logger.Info("Series expiry routine started")
+	for ctx.Err() == nil {
+		time.Sleep(ms.ttlCheckInterval)
+		err := ms.Expire(ctx)
+		if err != nil {
+			shared.Logger.Sugar().Infof("Series expiry failed: %s", err.Error())
+		}
+	}
+	shared.Logger.Info("Series expiry routine terminated")
+}
+
+// Drops cached values of `mtype` series `keys` (all series if no keys given)
+func (ms *DBStore) invalidate(mtype string, keys ...string) {
+	type cache interface {
+		invalidate(keys ...string)
+		clear()
+	}
+
+	var c cache
+	switch mtype {
+	case "gauge":
+		c = ms.Gauges.cache
+	case "counter":
+		c = ms.Counters.cache
+	case "histogram":
+		c = ms.Histograms.cache
+	case "summary":
+		c = ms.Summaries.cache
+	default:
+		return
+	}
+
+	if len(keys) == 0 {
+		c.clear()
+	} else {
+		c.invalidate(keys...)
+	}
+}
@@ -0,0 +1,77 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Histogram
+
+type MetricHistogram struct {
+	db    *sql.DB
+	tiers []storagecommons.RetentionTier
+	cache *readCache[storagecommons.Histogram]
+}
+
+func NewMetricHistogram() *MetricHistogram {
+	return &MetricHistogram{}
+}
+
+// Merges written value into cached or batched one
+func mergeHistograms(cur storagecommons.Histogram, exist bool, value storagecommons.Histogram) (storagecommons.Histogram, error) {
+	if !exist {
+		return value, nil
+	}
+	err := cur.Merge(value)
+	return cur, err
+}
+
+// Merges histograms into stored ones (rows are locked, so transaction is required)
+func (ths *MetricHistogram) applyValueDBBatch(ctx context.Context, tx pgx.Tx, data map[string]storagecommons.Histogram, recorded []string) error {
+	return mergeJSONBatch(ctx, tx, "histograms", "histogram", data, recorded,
+		func(value storagecommons.Histogram) storagecommons.Histogram {
+			return storagecommons.NewHistogram(value.Bounds)
+		},
+		(*storagecommons.Histogram).Merge,
+		func(value storagecommons.Histogram) float64 { return float64(value.Count) })
+}
+
+func (ths *MetricHistogram) getValueDB(ctx context.Context, keys ...string) (map[string]storagecommons.Histogram, error) {
+	return readValuesDB(ctx, ths.db, "histograms", keys, scanJSON[storagecommons.Histogram])
+}
+
+func (ths *MetricHistogram) ReadData(ctx context.Context, keys ...string) (map[string]storagecommons.Histogram, error) {
+	return ths.cache.read(keys, func(keys []string) (map[string]storagecommons.Histogram, error) {
+		return ths.getValueDB(ctx, keys...)
+	})
+}
+
+func (ths *MetricHistogram) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return readRangeDB(ctx, ths.db, "histograms", ths.tiers, key, from, to)
+}
+
+// Writes JSON encoded histogram
+func (ths *MetricHistogram) WriteData(ctx context.Context, key string, value string) error {
+	var h storagecommons.Histogram
+	err := json.Unmarshal([]byte(value), &h)
+	if err != nil {
+		return err
+	}
+	err = h.Validate()
+	if err != nil {
+		return err
+	}
+
+	return ths.WriteDataPP(ctx, key, h)
+}
+
+func (ths *MetricHistogram) WriteDataPP(ctx context.Context, key string, value storagecommons.Histogram) error {
+	defer ths.cache.invalidate(key)
+	return withPgxTx(ctx, ths.db, func(tx pgx.Tx) error {
+		return ths.applyValueDBBatch(ctx, tx, map[string]storagecommons.Histogram{key: value}, nil)
+	})
+}
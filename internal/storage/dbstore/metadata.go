@@ -0,0 +1,70 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Registers metric names of batch (see storagecommons.BatchMetadata) in transaction of batch write.
+// Error is returned if some name is registered with other type, so transaction is rolled back
+func registerMetadata(ctx context.Context, tx pgx.Tx, mds []storagecommons.MetricMetadata) error {
+	if len(mds) == 0 {
+		return nil
+	}
+
+	// Names are ordered, so row locks of concurrent writers are taken in fixed order
+	b := &pgx.Batch{}
+	for _, md := range mds {
+		b.Queue(`INSERT INTO "metadata" ("Name", "Type", "Unit", "Help") VALUES ($1, $2, $3, $4)
+ON CONFLICT ("Name") DO UPDATE SET
+	"Unit" = coalesce(NULLIF(EXCLUDED."Unit", ''), "metadata"."Unit"),
+	"Help" = coalesce(NULLIF(EXCLUDED."Help", ''), "metadata"."Help"),
+	"LastSeen" = now()
+RETURNING "Type"`, md.Name, md.Type, md.Unit, md.Help)
+	}
+
+	br := tx.SendBatch(ctx, b)
+	for _, md := range mds {
+		var registered string
+		err := br.QueryRow().Scan(&registered)
+		if err == nil && registered != md.Type {
+			err = &storagecommons.TypeConflictError{Name: md.Name, Type: md.Type, Registered: registered}
+		}
+		if err != nil {
+			br.Close()
+			return err
+		}
+	}
+	return br.Close()
+}
+
+// Returns metadata of all written metric names (metadata outlives deleted and expired series)
+func (ms *DBStore) GetMetadata(ctx context.Context) ([]storagecommons.MetricMetadata, error) {
+	if ms.db == nil {
+		return nil, errors.New("database connection was not established")
+	}
+
+	rows, err := ms.db.QueryContext(ctx, `SELECT "Name", "Type", "Unit", "Help", "FirstSeen", "LastSeen" FROM "metadata" ORDER BY "Name"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]storagecommons.MetricMetadata, 0)
+	for rows.Next() {
+		var md storagecommons.MetricMetadata
+		err = rows.Scan(&md.Name, &md.Type, &md.Unit, &md.Help, &md.FirstSeen, &md.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, md)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return res, nil
+}
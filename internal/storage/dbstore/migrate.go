@@ -0,0 +1,254 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration files `<version>_<name>.up.sql` and `<version>_<name>.down.sql`
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Key of advisory lock preventing concurrent migrations of several server instances
+const migrationLockKey = 7_318_003_001
+
+// Schema change with its rollback
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State of migration in database
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Returns embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	return parseMigrations(migrationFiles, "migrations")
+}
+
+func parseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, errors.New("unexpected migration file name: " + e.Name())
+		}
+		ver, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(ver, 10, 64)
+		if err != nil {
+			return nil, errors.New("unexpected migration file name: " + e.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, dir+"/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, exist := byVersion[version]
+		if !exist {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+
+	return res, nil
+}
+
+// Runs `f` on single connection holding migration lock with migrations table created
+func withMigrationLock(ctx context.Context, db *sql.DB, f func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS "schema_migrations"
+(
+    "Version" bigint NOT NULL,
+    "Name" text NOT NULL,
+    "AppliedAt" timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY ("Version")
+)`)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// Returns applied migrations versions with their application time
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT "Version", "AppliedAt" FROM "schema_migrations"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		err = rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+		res[version] = at
+	}
+	return res, rows.Err()
+}
+
+// Applies migration script and records it within single transaction.
+// Scripts don't qualify objects with schema, so they are created in the first schema of connection search path
+// (tenant one within tenant schema, see TenantDSN)
+func runMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	script, record := m.Down, `DELETE FROM "schema_migrations" WHERE "Version" = $1`
+	if up {
+		script, record = m.Up, `INSERT INTO "schema_migrations" ("Version", "Name") VALUES ($1, $2)`
+	}
+
+	_, err = tx.ExecContext(ctx, script)
+	if err == nil {
+		if up {
+			_, err = tx.ExecContext(ctx, record, m.Version, m.Name)
+		} else {
+			_, err = tx.ExecContext(ctx, record, m.Version)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// Applies all pending migrations in version order, returns number of applied ones
+func MigrateUp(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err = runMigration(ctx, conn, m, true)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Rolls back `steps` last applied migrations, returns number of rolled back ones
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			if _, ok := applied[migrations[i].Version]; !ok {
+				continue
+			}
+			err = runMigration(ctx, conn, migrations[i], false)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Returns states of all known migrations in version order
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]MigrationState, 0, len(migrations))
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			at, ok := applied[m.Version]
+			res = append(res, MigrationState{Migration: m, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+
+	return res, err
+}
@@ -0,0 +1,46 @@
+package dbstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Run("Embedded Migrations Ordered", func(t *testing.T) {
+		ms, err := Migrations()
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ms)
+		for i, m := range ms {
+			assert.Equal(t, int64(i+1), m.Version)
+			assert.NotEmpty(t, m.Up)
+			assert.NotEmpty(t, m.Down)
+		}
+	})
+
+	t.Run("Missing Down File", func(t *testing.T) {
+		_, err := parseMigrations(fstest.MapFS{
+			"m/0001_a.up.sql":   {Data: []byte("SELECT 1")},
+			"m/0001_a.down.sql": {Data: []byte("SELECT 1")},
+			"m/0002_b.up.sql":   {Data: []byte("SELECT 1")},
+		}, "m")
+		assert.Error(t, err)
+	})
+
+	t.Run("Objects Not Qualified With Schema", func(t *testing.T) {
+		ms, err := Migrations()
+		assert.NoError(t, err)
+		for _, m := range ms {
+			// Tenant schema is selected by search path of connection
+			for _, script := range []string{m.Up, m.Down} {
+				assert.NotContains(t, strings.ToLower(script), "public.", m.Name)
+			}
+		}
+	})
+
+	t.Run("Bad File Name", func(t *testing.T) {
+		_, err := parseMigrations(fstest.MapFS{"m/init.sql": {Data: []byte("SELECT 1")}}, "m")
+		assert.Error(t, err)
+	})
+}
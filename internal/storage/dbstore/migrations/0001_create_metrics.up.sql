@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "gauges"
+(
+    "Key" text NOT NULL,
+    "Value" double precision NOT NULL,
+    PRIMARY KEY ("Key")
+);
+CREATE TABLE IF NOT EXISTS "counters"
+(
+    "Key" text NOT NULL,
+    "Value" bigint NOT NULL,
+    PRIMARY KEY ("Key")
+);
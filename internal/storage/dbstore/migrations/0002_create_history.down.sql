@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "counters_history";
+DROP TABLE IF EXISTS "gauges_history";
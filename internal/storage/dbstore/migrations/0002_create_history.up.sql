@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS "gauges_history"
+(
+    "Key" text NOT NULL,
+    "Timestamp" timestamp with time zone NOT NULL,
+    "Value" double precision NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "gauges_history_Key_Timestamp" ON "gauges_history" ("Key", "Timestamp");
+CREATE TABLE IF NOT EXISTS "counters_history"
+(
+    "Key" text NOT NULL,
+    "Timestamp" timestamp with time zone NOT NULL,
+    "Value" double precision NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "counters_history_Key_Timestamp" ON "counters_history" ("Key", "Timestamp");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "counters_rollup";
+DROP TABLE IF EXISTS "gauges_rollup";
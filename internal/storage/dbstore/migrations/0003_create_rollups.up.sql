@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS "gauges_rollup"
+(
+    "Key" text NOT NULL,
+    "Step" bigint NOT NULL,
+    "Timestamp" timestamp with time zone NOT NULL,
+    "Min" double precision NOT NULL,
+    "Max" double precision NOT NULL,
+    "Avg" double precision NOT NULL,
+    "Last" double precision NOT NULL,
+    "Count" bigint NOT NULL,
+    PRIMARY KEY ("Key", "Step", "Timestamp")
+);
+CREATE TABLE IF NOT EXISTS "counters_rollup"
+(
+    "Key" text NOT NULL,
+    "Step" bigint NOT NULL,
+    "Timestamp" timestamp with time zone NOT NULL,
+    "Min" double precision NOT NULL,
+    "Max" double precision NOT NULL,
+    "Avg" double precision NOT NULL,
+    "Last" double precision NOT NULL,
+    "Count" bigint NOT NULL,
+    PRIMARY KEY ("Key", "Step", "Timestamp")
+);
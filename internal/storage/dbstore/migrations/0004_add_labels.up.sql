@@ -0,0 +1,2 @@
+ALTER TABLE "gauges" ADD COLUMN IF NOT EXISTS "Labels" jsonb NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE "counters" ADD COLUMN IF NOT EXISTS "Labels" jsonb NOT NULL DEFAULT '{}'::jsonb;
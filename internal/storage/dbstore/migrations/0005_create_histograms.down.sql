@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "histograms_rollup";
+DROP TABLE IF EXISTS "histograms_history";
+DROP TABLE IF EXISTS "histograms";
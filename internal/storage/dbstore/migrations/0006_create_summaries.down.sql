@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "summaries_rollup";
+DROP TABLE IF EXISTS "summaries_history";
+DROP TABLE IF EXISTS "summaries";
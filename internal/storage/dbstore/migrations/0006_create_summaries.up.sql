@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS "summaries"
+(
+    "Key" text NOT NULL,
+    "Labels" jsonb NOT NULL DEFAULT '{}'::jsonb,
+    "Value" jsonb NOT NULL,
+    PRIMARY KEY ("Key")
+);
+CREATE TABLE IF NOT EXISTS "summaries_history"
+(
+    "Key" text NOT NULL,
+    "Timestamp" timestamp with time zone NOT NULL,
+    "Value" double precision NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "summaries_history_Key_Timestamp" ON "summaries_history" ("Key", "Timestamp");
+CREATE TABLE IF NOT EXISTS "summaries_rollup"
+(
+    "Key" text NOT NULL,
+    "Step" bigint NOT NULL,
+    "Timestamp" timestamp with time zone NOT NULL,
+    "Min" double precision NOT NULL,
+    "Max" double precision NOT NULL,
+    "Avg" double precision NOT NULL,
+    "Last" double precision NOT NULL,
+    "Count" bigint NOT NULL,
+    PRIMARY KEY ("Key", "Step", "Timestamp")
+);
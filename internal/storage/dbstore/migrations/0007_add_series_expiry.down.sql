@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "series_ttl";
+ALTER TABLE "summaries" DROP COLUMN IF EXISTS "Updated";
+ALTER TABLE "histograms" DROP COLUMN IF EXISTS "Updated";
+ALTER TABLE "counters" DROP COLUMN IF EXISTS "Updated";
+ALTER TABLE "gauges" DROP COLUMN IF EXISTS "Updated";
@@ -0,0 +1,11 @@
+ALTER TABLE "gauges" ADD COLUMN IF NOT EXISTS "Updated" timestamp with time zone NOT NULL DEFAULT now();
+ALTER TABLE "counters" ADD COLUMN IF NOT EXISTS "Updated" timestamp with time zone NOT NULL DEFAULT now();
+ALTER TABLE "histograms" ADD COLUMN IF NOT EXISTS "Updated" timestamp with time zone NOT NULL DEFAULT now();
+ALTER TABLE "summaries" ADD COLUMN IF NOT EXISTS "Updated" timestamp with time zone NOT NULL DEFAULT now();
+CREATE TABLE IF NOT EXISTS "series_ttl"
+(
+    "Type" text NOT NULL,
+    "Key" text NOT NULL,
+    "TTL" bigint NOT NULL,
+    PRIMARY KEY ("Type", "Key")
+);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS "metadata"
+(
+    "Name" text NOT NULL,
+    "Type" text NOT NULL,
+    "Unit" text NOT NULL DEFAULT '',
+    "Help" text NOT NULL DEFAULT '',
+    "FirstSeen" timestamp with time zone NOT NULL DEFAULT now(),
+    "LastSeen" timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY ("Name")
+);
+INSERT INTO "metadata" ("Name", "Type", "FirstSeen", "LastSeen")
+SELECT split_part("Key", '{', 1), 'gauge', min("Updated"), max("Updated") FROM "gauges" GROUP BY 1
+ON CONFLICT ("Name") DO NOTHING;
+INSERT INTO "metadata" ("Name", "Type", "FirstSeen", "LastSeen")
+SELECT split_part("Key", '{', 1), 'counter', min("Updated"), max("Updated") FROM "counters" GROUP BY 1
+ON CONFLICT ("Name") DO NOTHING;
+INSERT INTO "metadata" ("Name", "Type", "FirstSeen", "LastSeen")
+SELECT split_part("Key", '{', 1), 'histogram', min("Updated"), max("Updated") FROM "histograms" GROUP BY 1
+ON CONFLICT ("Name") DO NOTHING;
+INSERT INTO "metadata" ("Name", "Type", "FirstSeen", "LastSeen")
+SELECT split_part("Key", '{', 1), 'summary', min("Updated"), max("Updated") FROM "summaries" GROUP BY 1
+ON CONFLICT ("Name") DO NOTHING;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "counter_sources";
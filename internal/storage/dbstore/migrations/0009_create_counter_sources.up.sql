@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS "counter_sources"
+(
+    "Key" text NOT NULL,
+    "Source" text NOT NULL,
+    "Value" bigint NOT NULL,
+    PRIMARY KEY ("Key", "Source")
+);
@@ -0,0 +1,135 @@
+package dbstore
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cached value of series
+type readCacheEntry[T any] struct {
+	key   string
+	value T
+}
+
+// In-process LRU cache of stored values invalidated on write (nil cache is disabled one).
+// Values read before invalidation are not cached: each invalidation increments generation,
+// and read value is put only if generation is the same as before reading
+type readCache[T any] struct {
+	mu         sync.Mutex
+	size       int
+	entries    map[string]*list.Element
+	lru        *list.List
+	generation uint64
+}
+
+// Returns cache of `size` entries, nil if size is not positive
+func newReadCache[T any](size int) *readCache[T] {
+	if size <= 0 {
+		return nil
+	}
+	return &readCache[T]{size: size, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Returns cached values of `keys` with current generation, and keys not found in cache
+func (c *readCache[T]) get(keys []string) (map[string]T, []string, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make(map[string]T, len(keys))
+	missed := make([]string, 0)
+	for _, key := range keys {
+		el, ok := c.entries[key]
+		if !ok {
+			missed = append(missed, key)
+			continue
+		}
+		c.lru.MoveToFront(el)
+		res[key] = el.Value.(*readCacheEntry[T]).value
+	}
+	return res, missed, c.generation
+}
+
+// Caches values read at `generation` unless cache was invalidated since
+func (c *readCache[T]) put(generation uint64, data map[string]T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	for key, value := range data {
+		if el, ok := c.entries[key]; ok {
+			el.Value.(*readCacheEntry[T]).value = value
+			c.lru.MoveToFront(el)
+			continue
+		}
+		c.entries[key] = c.lru.PushFront(&readCacheEntry[T]{key: key, value: value})
+		if c.lru.Len() > c.size {
+			oldest := c.lru.Back()
+			c.lru.Remove(oldest)
+			delete(c.entries, oldest.Value.(*readCacheEntry[T]).key)
+		}
+	}
+}
+
+// Drops cached values of `keys`
+func (c *readCache[T]) invalidate(keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Drops all cached values
+func (c *readCache[T]) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Returns values of `keys` taking cached ones, others are read by `load` and cached.
+// Requests of all values (no keys) are not cached
+func (c *readCache[T]) read(keys []string, load func(keys []string) (map[string]T, error)) (map[string]T, error) {
+	if c == nil || len(keys) == 0 {
+		return load(keys)
+	}
+
+	res, missed, generation := c.get(keys)
+	if len(missed) == 0 {
+		return res, nil
+	}
+
+	data, err := load(missed)
+	if err != nil {
+		return nil, err
+	}
+	c.put(generation, data)
+	for key, value := range data {
+		res[key] = value
+	}
+	return res, nil
+}
+
+// Returns keys of map
+func mapKeys[T any](data map[string]T) []string {
+	res := make([]string, 0, len(data))
+	for key := range data {
+		res = append(res, key)
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+package dbstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReadCache(t *testing.T) {
+	loads := 0
+	stored := map[string]int64{"a": 1, "b": 2, "c": 3}
+	load := func(keys []string) (map[string]int64, error) {
+		loads++
+		res := make(map[string]int64)
+		for _, key := range keys {
+			if v, ok := stored[key]; ok {
+				res[key] = v
+			}
+		}
+		return res, nil
+	}
+
+	c := newReadCache[int64](2)
+
+	t.Run("Hit After Miss", func(t *testing.T) {
+		res, err := c.read([]string{"a"}, load)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int64{"a": 1}, res)
+		res, _ = c.read([]string{"a"}, load)
+		assert.Equal(t, map[string]int64{"a": 1}, res)
+		assert.Equal(t, 1, loads)
+	})
+
+	t.Run("Least Recently Used Evicted", func(t *testing.T) {
+		c.read([]string{"b", "c"}, load)
+		_, missed, _ := c.get([]string{"a", "b", "c"})
+		assert.Equal(t, []string{"a"}, missed)
+	})
+
+	t.Run("Invalidated On Write", func(t *testing.T) {
+		stored["b"] = 20
+		c.invalidate("b")
+		res, _ := c.read([]string{"b"}, load)
+		assert.Equal(t, map[string]int64{"b": 20}, res)
+	})
+
+	t.Run("Value Read Before Invalidation Not Cached", func(t *testing.T) {
+		_, _, generation := c.get(nil)
+		c.invalidate("x")
+		c.put(generation, map[string]int64{"a": 0})
+		res, _ := c.read([]string{"a"}, load)
+		assert.Equal(t, map[string]int64{"a": 1}, res)
+	})
+
+	t.Run("Disabled Cache", func(t *testing.T) {
+		var d *readCache[int64]
+		d.invalidate("a")
+		d.clear()
+		before := loads
+		d.read([]string{"a"}, load)
+		d.read([]string{"a"}, load)
+		assert.Equal(t, before+2, loads)
+	})
+}
@@ -0,0 +1,77 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Summary
+
+type MetricSummary struct {
+	db    *sql.DB
+	tiers []storagecommons.RetentionTier
+	cache *readCache[storagecommons.Summary]
+}
+
+func NewMetricSummary() *MetricSummary {
+	return &MetricSummary{}
+}
+
+// Merges written value into cached or batched one
+func mergeSummaries(cur storagecommons.Summary, exist bool, value storagecommons.Summary) (storagecommons.Summary, error) {
+	if !exist {
+		return value, nil
+	}
+	err := cur.Merge(value)
+	return cur, err
+}
+
+// Merges summary sketches into stored ones (rows are locked, so transaction is required)
+func (ths *MetricSummary) applyValueDBBatch(ctx context.Context, tx pgx.Tx, data map[string]storagecommons.Summary, recorded []string) error {
+	return mergeJSONBatch(ctx, tx, "summaries", "summary", data, recorded,
+		func(value storagecommons.Summary) storagecommons.Summary {
+			return storagecommons.NewSummary(value.Alpha)
+		},
+		(*storagecommons.Summary).Merge,
+		func(value storagecommons.Summary) float64 { return float64(value.Count) })
+}
+
+func (ths *MetricSummary) getValueDB(ctx context.Context, keys ...string) (map[string]storagecommons.Summary, error) {
+	return readValuesDB(ctx, ths.db, "summaries", keys, scanJSON[storagecommons.Summary])
+}
+
+func (ths *MetricSummary) ReadData(ctx context.Context, keys ...string) (map[string]storagecommons.Summary, error) {
+	return ths.cache.read(keys, func(keys []string) (map[string]storagecommons.Summary, error) {
+		return ths.getValueDB(ctx, keys...)
+	})
+}
+
+func (ths *MetricSummary) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return readRangeDB(ctx, ths.db, "summaries", ths.tiers, key, from, to)
+}
+
+// Writes JSON encoded summary sketch
+func (ths *MetricSummary) WriteData(ctx context.Context, key string, value string) error {
+	var h storagecommons.Summary
+	err := json.Unmarshal([]byte(value), &h)
+	if err != nil {
+		return err
+	}
+	err = h.Validate()
+	if err != nil {
+		return err
+	}
+
+	return ths.WriteDataPP(ctx, key, h)
+}
+
+func (ths *MetricSummary) WriteDataPP(ctx context.Context, key string, value storagecommons.Summary) error {
+	defer ths.cache.invalidate(key)
+	return withPgxTx(ctx, ths.db, func(tx pgx.Tx) error {
+		return ths.applyValueDBBatch(ctx, tx, map[string]storagecommons.Summary{key: value}, nil)
+	})
+}
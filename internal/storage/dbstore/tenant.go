@@ -0,0 +1,51 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jackc/pgx/v5"
+	"net/url"
+	"strings"
+)
+
+// Returns name of DB schema holding tenant data
+func tenantSchema(tenant string) string {
+	return "tenant_" + tenant
+}
+
+// Returns name of connection pool (schema it uses)
+func poolName(dsn string) string {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil || cfg.RuntimeParams["search_path"] == "" {
+		return "public"
+	}
+	return cfg.RuntimeParams["search_path"]
+}
+
+// Creates schema of tenant, returns connection string which sessions work within this schema.
+// Tenant name is to be validated by caller (see storagecommons.ValidateTenant)
+func TenantDSN(ctx context.Context, dsn string, tenant string) (string, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	schema := tenantSchema(tenant)
+	_, err = db.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS "`+schema+`"`)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return dsn + " search_path=" + schema, nil
+}
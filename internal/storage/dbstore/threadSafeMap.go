@@ -41,3 +41,50 @@ func (tsm *ThreadSafeMap[S]) Clear() {
 	defer tsm.mutex.Unlock()
 	tsm.data = make(map[string]S)
 }
+
+// Map of values merged on write, `merge` combines stored value (if exists) with written one
+type ThreadSafeMergeMap[T any] struct {
+	mutex sync.RWMutex
+	data  map[string]T
+	merge func(cur T, exist bool, value T) (T, error)
+}
+
+// Merges value into stored one, stored value is left unchanged on error
+func (tsm *ThreadSafeMergeMap[T]) Merge(key string, value T) error {
+	tsm.mutex.Lock()
+	defer tsm.mutex.Unlock()
+	cur, ok := tsm.data[key]
+	res, err := tsm.merge(cur, ok, value)
+	if err != nil {
+		return err
+	}
+	tsm.data[key] = res
+	return nil
+}
+
+// Returns error merges of values into stored one would return, stored value is left unchanged
+func (tsm *ThreadSafeMergeMap[T]) CheckMerge(key string, values ...T) error {
+	tsm.mutex.RLock()
+	defer tsm.mutex.RUnlock()
+	cur, ok := tsm.data[key]
+	for _, value := range values {
+		res, err := tsm.merge(cur, ok, value)
+		if err != nil {
+			return err
+		}
+		cur, ok = res, true
+	}
+	return nil
+}
+
+func (tsm *ThreadSafeMergeMap[T]) GetData() map[string]T {
+	tsm.mutex.RLock()
+	defer tsm.mutex.RUnlock()
+	return maps.Clone(tsm.data)
+}
+
+func (tsm *ThreadSafeMergeMap[T]) Clear() {
+	tsm.mutex.Lock()
+	defer tsm.mutex.Unlock()
+	tsm.data = make(map[string]T)
+}
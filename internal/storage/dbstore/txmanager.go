@@ -8,6 +8,7 @@ import (
 type DBQueryManager interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type TxManager struct {
@@ -35,3 +36,11 @@ func (t TxManager) QueryContext(ctx context.Context, query string, args ...inter
 		return t.tx.QueryContext(ctx, query, args...)
 	}
 }
+
+func (t TxManager) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if t.tx == nil {
+		return t.db.QueryRowContext(ctx, query, args...)
+	} else {
+		return t.tx.QueryRowContext(ctx, query, args...)
+	}
+}
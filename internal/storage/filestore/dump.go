@@ -0,0 +1,161 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Version of dump format written by server
+const dumpFormatVersion = 1
+
+// Dump data starts with header line describing payload following it
+const dumpHeaderPrefix = "# metrics dump "
+
+// Supported compressions of dump payload
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Magic numbers of compressed streams (used to detect dumps compressed without header)
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// JSON serializable header of dump
+type dumpHeader struct {
+	Version     int       `json:"version"`
+	Created     time.Time `json:"created"`
+	Server      string    `json:"server,omitempty"`
+	Compression string    `json:"compression"`
+}
+
+// Checks if dump compression is supported (empty one means no compression)
+func CheckCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return errors.New("unknown dump compression: " + compression)
+}
+
+// Returns dump of data: header line followed by JSON compressed with `compression`.
+// Uncompressed JSON is indented to stay readable
+func encodeDump(mdb storagecommons.MetricsDB, server string, compression string) ([]byte, error) {
+	if compression == "" {
+		compression = CompressionNone
+	}
+	hdr, err := json.Marshal(dumpHeader{Version: dumpFormatVersion, Created: time.Now().UTC(), Server: server, Compression: compression})
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	if compression == CompressionNone {
+		payload, err = json.MarshalIndent(mdb, "", "    ")
+	} else {
+		payload, err = json.Marshal(mdb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(dumpHeaderPrefix)+len(hdr)+1+len(payload)/4))
+	buf.WriteString(dumpHeaderPrefix)
+	buf.Write(hdr)
+	buf.WriteByte('\n')
+
+	switch compression {
+	case CompressionNone:
+		buf.Write(payload)
+	case CompressionGzip:
+		zw := gzip.NewWriter(buf)
+		if _, err = zw.Write(payload); err != nil {
+			return nil, err
+		}
+		if err = zw.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(zw.EncodeAll(payload, nil))
+		if err = zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, CheckCompression(compression)
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns data of dump and its header. Format is detected by data:
+// dumps with header, plain MetricsDB JSON (written before dump versioning) and compressed one are accepted
+func decodeDump(data []byte) (storagecommons.MetricsDB, dumpHeader, error) {
+	var (
+		mdb storagecommons.MetricsDB
+		hdr dumpHeader
+	)
+
+	if bytes.HasPrefix(data, []byte(dumpHeaderPrefix)) {
+		line, payload, found := bytes.Cut(data[len(dumpHeaderPrefix):], []byte{'\n'})
+		if !found {
+			return mdb, hdr, errors.New("dump header is not terminated")
+		}
+		if err := json.Unmarshal(line, &hdr); err != nil {
+			return mdb, hdr, fmt.Errorf("dump header is invalid: %w", err)
+		}
+		if hdr.Version > dumpFormatVersion {
+			return mdb, hdr, fmt.Errorf("dump format version %d is not supported", hdr.Version)
+		}
+		data = payload
+	} else {
+		switch {
+		case bytes.HasPrefix(data, gzipMagic):
+			hdr.Compression = CompressionGzip
+		case bytes.HasPrefix(data, zstdMagic):
+			hdr.Compression = CompressionZstd
+		}
+	}
+
+	data, err := decompress(data, hdr.Compression)
+	if err != nil {
+		return mdb, hdr, err
+	}
+	err = json.Unmarshal(data, &mdb)
+	return mdb, hdr, err
+}
+
+// Returns decompressed dump payload
+func decompress(data []byte, compression string) ([]byte, error) {
+	switch compression {
+	case "", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case CompressionZstd:
+		zr, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return zr.DecodeAll(data, nil)
+	}
+	return nil, CheckCompression(compression)
+}
@@ -0,0 +1,49 @@
+package filestore
+
+import (
+	"time"
+)
+
+// Last update time and TTL of series (not thread safe, guarded by owner)
+type seriesExpiry struct {
+	updated map[string]time.Time
+	ttl     map[string]time.Duration
+}
+
+func newSeriesExpiry() *seriesExpiry {
+	return &seriesExpiry{updated: make(map[string]time.Time), ttl: make(map[string]time.Duration)}
+}
+
+// Records series update
+func (e *seriesExpiry) touch(key string, now time.Time) {
+	e.updated[key] = now
+}
+
+// Sets series own TTL, non-positive `ttl` makes series use global TTL
+func (e *seriesExpiry) setTTL(key string, ttl time.Duration) {
+	if ttl <= 0 {
+		delete(e.ttl, key)
+		return
+	}
+	e.ttl[key] = ttl
+}
+
+func (e *seriesExpiry) drop(key string) {
+	delete(e.updated, key)
+	delete(e.ttl, key)
+}
+
+// Returns keys of series not updated within their TTL (`global` if own TTL not set, 0 - never expire)
+func (e *seriesExpiry) expired(now time.Time, global time.Duration) []string {
+	res := make([]string, 0)
+	for key, upd := range e.updated {
+		ttl, ok := e.ttl[key]
+		if !ok {
+			ttl = global
+		}
+		if ttl > 0 && now.Sub(upd) > ttl {
+			res = append(res, key)
+		}
+	}
+	return res
+}
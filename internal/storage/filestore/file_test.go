@@ -1,11 +1,17 @@
 package filestore
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 	"yaprakticum-go-track2/internal/config"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 	"yaprakticum-go-track2/internal/testhelpers"
@@ -46,10 +52,569 @@ func Test(t *testing.T) {
 	})
 
 	t.Run("ReCheck Counter Value Aft Load", func(t *testing.T) {
+		// Increment made after dump is replayed from write-ahead log
 		ctr, err := db.GetCounters().ReadData(ctx, "testCounter")
 		assert.NoError(t, err)
-		assert.Equal(t, int64(1), ctr["testCounter"])
+		assert.Equal(t, int64(2), ctr["testCounter"])
 	})
 
+	db.Close(ctx)
 	os.Remove("test.json")
+	os.Remove(walFileName("test.json"))
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), Restore: true}
+
+	var v = 1.5
+	var d int64 = 2
+	db, err := New(ctx, args, logger)
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g", MType: "gauge", Value: &v})
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+	assert.NoError(t, err)
+	db.Close(ctx)
+
+	t.Run("Writes Replayed Without Snapshot", func(t *testing.T) {
+		_, err := os.Stat(args.FileStoragePath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 4}, ctr)
+		gg, _ := db.GetGauges().ReadData(ctx)
+		assert.Equal(t, map[string]float64{"g": 1.5}, gg)
+	})
+
+	t.Run("Log Truncated By Dump", func(t *testing.T) {
+		assert.NoError(t, db.Dump(ctx))
+		st, err := os.Stat(walFileName(args.FileStoragePath))
+		assert.NoError(t, err)
+		assert.Zero(t, st.Size())
+	})
+
+	t.Run("Writes Replayed On Top Of Snapshot", func(t *testing.T) {
+		_, err := db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+		assert.NoError(t, err)
+		assert.NoError(t, db.Delete(ctx, storagecommons.Metrics{ID: "g", MType: "gauge"}))
+		db.Close(ctx)
+
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 6}, ctr)
+		gg, _ := db.GetGauges().ReadData(ctx)
+		assert.Empty(t, gg)
+	})
+
+	t.Run("Torn Last Record Ignored", func(t *testing.T) {
+		db.Close(ctx)
+		f, err := os.OpenFile(walFileName(args.FileStoragePath), os.O_WRONLY|os.O_APPEND, 0644)
+		assert.NoError(t, err)
+		f.WriteString(`{"seq":100,"op":"wri`)
+		f.Close()
+
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 6}, ctr)
+
+		// Records appended after torn one are not lost
+		_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g", MType: "gauge", Value: &v})
+		assert.NoError(t, err)
+		db.Close(ctx)
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		gg, _ := db.GetGauges().ReadData(ctx)
+		assert.Equal(t, map[string]float64{"g": 1.5}, gg)
+	})
+
+	t.Run("Records Already In Snapshot Skipped", func(t *testing.T) {
+		assert.NoError(t, db.Dump(ctx))
+		_, err := db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+		assert.NoError(t, err)
+		log, err := os.ReadFile(walFileName(args.FileStoragePath))
+		assert.NoError(t, err)
+		assert.NoError(t, db.Dump(ctx))
+		db.Close(ctx)
+
+		// Crash between snapshot write and log truncation
+		assert.NoError(t, os.WriteFile(walFileName(args.FileStoragePath), log, 0644))
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 8}, ctr)
+	})
+
+	t.Run("Rejected Write Rejected On Replay", func(t *testing.T) {
+		_, err := db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "gauge", Value: &v})
+		assert.Error(t, err)
+		db.Close(ctx)
+
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 8}, ctr)
+		gg, _ := db.GetGauges().ReadData(ctx)
+		assert.NotContains(t, gg, "c")
+	})
+
+	t.Run("Write Not Applied If Not Logged", func(t *testing.T) {
+		db.wal.file.Close()
+		_, err := db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+		assert.Error(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 8}, ctr)
+	})
+}
+
+func TestWriteAheadLogTimestamps(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), Restore: true}
+	from := time.Now().Add(-time.Hour)
+
+	var v = 1.5
+	db, err := New(ctx, args, logger)
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g", MType: "gauge", Value: &v})
+	assert.NoError(t, err)
+	written, _ := db.GetGauges().ReadRange(ctx, "g", from, time.Now())
+	db.Close(ctx)
+
+	t.Run("Samples Replayed With Accept Time", func(t *testing.T) {
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		replayed, _ := db.GetGauges().ReadRange(ctx, "g", from, time.Now())
+		if assert.Len(t, written, 1) && assert.Len(t, replayed, 1) {
+			assert.True(t, written[0].Timestamp.Equal(replayed[0].Timestamp))
+		}
+		db.Close(ctx)
+	})
+
+	t.Run("Records Without Time Replayed As Made Now", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(walFileName(args.FileStoragePath), []byte(`{"seq":1,"op":"write","metric":{"id":"g","type":"gauge","value":2}}`+"\n"), 0644))
+		start := time.Now()
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		replayed, _ := db.GetGauges().ReadRange(ctx, "g", from, time.Now())
+		if assert.Len(t, replayed, 1) {
+			assert.Equal(t, 2.0, replayed[0].Value)
+			assert.False(t, replayed[0].Timestamp.Before(start))
+		}
+		db.Close(ctx)
+	})
+}
+
+func TestRejectedWriteNotRegistered(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(ctx, config.ServerConfig{}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	for _, m := range []storagecommons.Metrics{
+		{ID: "g", MType: "gauge"},
+		{ID: "c", MType: "counter"},
+		{ID: "h", MType: "histogram", Histogram: &storagecommons.Histogram{Bounds: []float64{1}, Counts: []int64{1}}},
+		{ID: "s", MType: "summary"},
+		{ID: "u", MType: "unknown"},
+	} {
+		_, err := db.WriteData(ctx, m)
+		assert.Error(t, err, m.ID)
+	}
+	md, err := db.GetMetadata(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, md)
+
+	// Name is free for write of any type
+	var v = 1.0
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "gauge", Value: &v})
+	assert.NoError(t, err)
+}
+
+func TestMetadataRestored(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), StoreInterval: 300, Restore: true}
+
+	var d int64 = 1
+	db, err := New(ctx, args, logger)
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d, Unit: "bytes"})
+	assert.NoError(t, err)
+	before, _ := db.GetMetadata(ctx)
+	assert.NoError(t, db.Dump(ctx))
+	db.Close(ctx)
+
+	t.Run("Metadata Loaded From Snapshot", func(t *testing.T) {
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		after, _ := db.GetMetadata(ctx)
+		if assert.Len(t, after, 1) {
+			assert.Equal(t, "bytes", after[0].Unit)
+			assert.True(t, before[0].FirstSeen.Equal(after[0].FirstSeen))
+		}
+		var v = 1.0
+		_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "gauge", Value: &v})
+		assert.Error(t, err)
+		db.Close(ctx)
+	})
+
+	t.Run("Metadata Registered For Snapshot Without It", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(args.FileStoragePath, []byte(`{"metrics_db":[{"id":"g","type":"gauge","value":1}]}`), 0644))
+		assert.NoError(t, os.Truncate(walFileName(args.FileStoragePath), 0))
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		md, _ := db.GetMetadata(ctx)
+		if assert.Len(t, md, 1) {
+			assert.Equal(t, "g", md[0].Name)
+			assert.Equal(t, "gauge", md[0].Type)
+		}
+		db.Close(ctx)
+	})
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	h := newSeriesHistory(storagecommons.NewRetentionTiers(time.Hour, 0, 0))
+
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, v := range []float64{1, 5, 3} {
+		h.samples[0]["g"] = append(h.samples[0]["g"], storagecommons.Sample{Timestamp: base.Add(time.Duration(i) * 10 * time.Second), Value: v})
+	}
+	h.samples[0]["g"] = append(h.samples[0]["g"], storagecommons.Sample{Timestamp: now.Add(-10 * time.Second), Value: 7})
+
+	h.compact(now)
+
+	t.Run("Minute Rollup", func(t *testing.T) {
+		if assert.Len(t, h.samples[1]["g"], 1) {
+			r := h.samples[1]["g"][0]
+			assert.Equal(t, base, r.Timestamp)
+			assert.Equal(t, float64(1), r.Min)
+			assert.Equal(t, float64(5), r.Max)
+			assert.Equal(t, float64(3), r.Avg)
+			assert.Equal(t, float64(3), r.Value)
+			assert.Equal(t, int64(3), r.Count)
+		}
+	})
+
+	t.Run("Hour Rollup", func(t *testing.T) {
+		if assert.Len(t, h.samples[2]["g"], 1) {
+			assert.Equal(t, base, h.samples[2]["g"][0].Timestamp)
+			assert.Equal(t, int64(3), h.samples[2]["g"][0].Count)
+		}
+	})
+
+	t.Run("Raw Samples Expired", func(t *testing.T) {
+		if assert.Len(t, h.samples[0]["g"], 1) {
+			assert.Equal(t, float64(7), h.samples[0]["g"][0].Value)
+		}
+	})
+
+	t.Run("Repeated Compaction", func(t *testing.T) {
+		h.compact(now)
+		assert.Len(t, h.samples[1]["g"], 1)
+	})
+}
+
+func TestNoHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(ctx, config.ServerConfig{NoHistory: true}, testhelpers.GetCustomZap(zap.ErrorLevel))
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	var v = 1.0
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g", MType: "gauge", Value: &v})
+	assert.NoError(t, err)
+	data, _ := db.GetGauges().ReadData(ctx)
+	assert.Equal(t, map[string]float64{"g": 1}, data)
+	smp, err := db.ReadRange(ctx, "gauge", "g", time.Now().Add(-time.Hour), time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, smp)
+	db.Compact(ctx)
+	assert.Empty(t, db.Gauges.series.exportHistory("gauge"))
+}
+
+func TestSeriesExpiry(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	db, err := New(ctx, config.ServerConfig{MetricTTL: time.Hour}, logger)
+	assert.NoError(t, err)
+
+	var v = 1.0
+	var ttl int64 = 60
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g1", MType: "gauge", Value: &v})
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "g2", MType: "gauge", Value: &v, TTL: &ttl})
+	assert.NoError(t, err)
+
+	t.Run("Fresh Series Kept", func(t *testing.T) {
+		db.Expire(ctx)
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Len(t, data, 2)
+	})
+
+	t.Run("Expired Series Listed", func(t *testing.T) {
+		db.Gauges.series.setUpdated("g2", time.Now().Add(-10*time.Minute))
+		assert.Equal(t, []storagecommons.Metrics{{ID: "g2", MType: "gauge"}}, db.Expired(ctx))
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Len(t, data, 2)
+	})
+
+	t.Run("Own TTL Expired", func(t *testing.T) {
+		db.Gauges.series.setUpdated("g1", time.Now().Add(-10*time.Minute))
+		db.Gauges.series.setUpdated("g2", time.Now().Add(-10*time.Minute))
+		db.Expire(ctx)
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Equal(t, map[string]float64{"g1": 1}, data)
+		smp, _ := db.ReadRange(ctx, "gauge", "g2", time.Now().Add(-time.Hour), time.Now())
+		assert.Empty(t, smp)
+	})
+
+	t.Run("Global TTL Expired", func(t *testing.T) {
+		db.Gauges.series.setUpdated("g1", time.Now().Add(-2*time.Hour))
+		db.Expire(ctx)
+		data, _ := db.GetGauges().ReadData(ctx)
+		assert.Empty(t, data)
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), StoreInterval: 300, SnapshotsKeep: 3}
+
+	db, err := New(ctx, args, logger)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	var d int64 = 1
+	for i := 0; i < 4; i++ {
+		_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+		assert.NoError(t, err)
+		assert.NoError(t, db.Dump(ctx))
+	}
+
+	t.Run("Last Snapshots Kept", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, err := os.Stat(snapshotFileName(args.FileStoragePath, i))
+			assert.NoError(t, err)
+		}
+		_, err := os.Stat(snapshotFileName(args.FileStoragePath, 3))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		tmp, _ := filepath.Glob(args.FileStoragePath + ".tmp-*")
+		assert.Empty(t, tmp)
+	})
+
+	t.Run("Checksum Mismatch Detected", func(t *testing.T) {
+		raw, err := os.ReadFile(args.FileStoragePath)
+		assert.NoError(t, err)
+		raw[len(raw)-3] ^= 1
+		_, err = decodeSnapshot(raw)
+		assert.Error(t, err)
+	})
+
+	t.Run("Truncated Snapshot Falls Back To Previous", func(t *testing.T) {
+		raw, err := os.ReadFile(args.FileStoragePath)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(args.FileStoragePath, raw[:len(raw)/2], 0644))
+
+		assert.NoError(t, db.Load(ctx))
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 3}, ctr)
+	})
+
+	t.Run("All Snapshots Invalid", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, os.WriteFile(snapshotFileName(args.FileStoragePath, i), []byte("{"), 0644))
+		}
+		assert.Error(t, db.Load(ctx))
+	})
+
+	t.Run("Snapshot Without Header Accepted", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(args.FileStoragePath, []byte(`{"metrics_db":[{"id":"c","type":"counter","delta":10}]}`), 0644))
+		assert.NoError(t, db.Load(ctx))
+		ctr, _ := db.GetCounters().ReadData(ctx)
+		assert.Equal(t, map[string]int64{"c": 10}, ctr)
+	})
+}
+
+// Meant to be run with -race
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	db, err := New(ctx, config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), StoreInterval: 300}, logger)
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	const writers, iterations = 8, 200
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var d int64 = 1
+			for i := 0; i < iterations; i++ {
+				v := float64(i)
+				h := storagecommons.Histogram{Bounds: []float64{1, 10}, Counts: []int64{1, 0, 0}, Sum: 0.5, Count: 1}
+				err := db.WriteDataMulti(ctx, storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{
+					{ID: "c", MType: "counter", Delta: &d},
+					{ID: "g" + strconv.Itoa(w), MType: "gauge", Value: &v},
+					{ID: "h", MType: "histogram", Histogram: &h},
+				}})
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			gauges, err := db.GetGauges().ReadData(ctx)
+			assert.NoError(t, err)
+			// Returned map is a copy and may be modified freely
+			gauges["x"] = 1
+			// Returned histograms don't share buckets with stored ones merged by writers
+			histograms, err := db.GetHistograms().ReadData(ctx)
+			assert.NoError(t, err)
+			for _, h := range histograms {
+				var total int64
+				for _, c := range h.Counts {
+					total += c
+				}
+				assert.Equal(t, h.Count, total)
+			}
+			_, _ = db.ReadData(ctx, storagecommons.Metrics{ID: "c", MType: "counter"})
+			_, _ = db.ReadRange(ctx, "counter", "c", time.Now().Add(-time.Minute), time.Now())
+			assert.NoError(t, db.Dump(ctx))
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	ctr, err := db.GetCounters().ReadData(ctx, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(writers*iterations), ctr["c"])
+	gauges, err := db.GetGauges().ReadData(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, gauges, writers)
+	hist, err := db.GetHistograms().ReadData(ctx, "h")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{writers * iterations, 0, 0}, hist["h"].Counts)
+}
+
+func TestCounterSourcesRestored(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+	args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), StoreInterval: 300, Restore: true}
+
+	write := func(db *FileStore, value int64) {
+		_, err := db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &value, Cumulative: true, Source: "a"})
+		assert.NoError(t, err)
+	}
+	read := func(db *FileStore) int64 {
+		data, err := db.ReadData(ctx, storagecommons.Metrics{ID: "c", MType: "counter"})
+		assert.NoError(t, err)
+		return *data.Delta
+	}
+
+	db, err := New(ctx, args, logger)
+	assert.NoError(t, err)
+	write(db, 5)
+	assert.NoError(t, db.Dump(ctx))
+	write(db, 8)
+	db.Close(ctx)
+
+	t.Run("Sources Loaded From Snapshot And Log", func(t *testing.T) {
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), read(db))
+		write(db, 10)
+		assert.Equal(t, int64(10), read(db))
+		db.Close(ctx)
+	})
+
+	t.Run("Sources Dropped With Series", func(t *testing.T) {
+		db, err = New(ctx, args, logger)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Delete(ctx, storagecommons.Metrics{ID: "c", MType: "counter"}))
+		write(db, 12)
+		assert.Equal(t, int64(12), read(db))
+		db.Close(ctx)
+	})
+}
+
+func TestDumpFormats(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+
+	for _, compression := range []string{"", CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run("Compression "+compression, func(t *testing.T) {
+			args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), StoreInterval: 300, Restore: true, DumpCompression: compression}
+			db, err := New(ctx, args, logger)
+			assert.NoError(t, err)
+			var d int64 = 7
+			_, err = db.WriteData(ctx, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d})
+			assert.NoError(t, err)
+			assert.NoError(t, db.Dump(ctx))
+			db.Close(ctx)
+
+			raw, err := os.ReadFile(args.FileStoragePath)
+			assert.NoError(t, err)
+			data, err := decodeSnapshot(raw)
+			assert.NoError(t, err)
+			_, hdr, err := decodeDump(data)
+			assert.NoError(t, err)
+			assert.Equal(t, dumpFormatVersion, hdr.Version)
+			assert.False(t, hdr.Created.IsZero())
+			if compression != "" {
+				assert.Equal(t, compression, hdr.Compression)
+			}
+
+			db, err = New(ctx, args, logger)
+			assert.NoError(t, err)
+			ctr, _ := db.GetCounters().ReadData(ctx)
+			assert.Equal(t, map[string]int64{"c": 7}, ctr)
+			db.Close(ctx)
+		})
+	}
+
+	t.Run("Compressed Dump Without Header Accepted", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(`{"metrics_db":[{"id":"c","type":"counter","delta":3}]}`))
+		zw.Close()
+		mdb, _, err := decodeDump(buf.Bytes())
+		if assert.NoError(t, err) && assert.Len(t, mdb.MetricsDB, 1) {
+			assert.Equal(t, int64(3), *mdb.MetricsDB[0].Delta)
+		}
+	})
+
+	t.Run("Newer Format Version Rejected", func(t *testing.T) {
+		_, _, err := decodeDump([]byte(dumpHeaderPrefix + `{"version":99,"compression":"none"}` + "\n{}"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown Compression Rejected", func(t *testing.T) {
+		args := config.ServerConfig{FileStoragePath: filepath.Join(t.TempDir(), "test.json"), DumpCompression: "lz4"}
+		_, err := New(ctx, args, logger)
+		assert.Error(t, err)
+	})
 }
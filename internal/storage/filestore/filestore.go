@@ -8,17 +8,34 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/prom"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
 // InMemory, file-backed storage description (see Storager)
 type FileStore struct {
-	Gauges    *MetricFloat64
-	Counters  *MetricInt64Sum
-	dumpMutex sync.Mutex
-	syncWrite bool
-	fileName  string
+	Gauges             *MetricFloat64
+	Counters           *MetricInt64Sum
+	Histograms         *MetricHistogram
+	histogramBuckets   []float64
+	Summaries          *MetricSummary
+	summaryAccuracy    float64
+	metadata           *storagecommons.MetadataRegistry
+	sources            *storagecommons.CounterSources
+	dumpMutex          sync.RWMutex             // Writers hold it shared, so snapshot and log truncation see consistent state
+	nameMutexes        [seriesShards]sync.Mutex // Order log records and writes of the same metric name
+	syncWrite          bool
+	fileName           string
+	snapshotsKeep      int
+	dumpCompression    string
+	server             string
+	wal                *writeAheadLog
+	logger             *zap.Logger
+	compactionInterval time.Duration
+	metricTTL          time.Duration
+	ttlCheckInterval   time.Duration
 }
 
 func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*FileStore, error) {
@@ -28,15 +45,59 @@ func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*Fi
 
 	ms.fileName = args.FileStoragePath
 	ms.syncWrite = args.StoreInterval == 0 && ms.fileName != ""
+	ms.snapshotsKeep = args.SnapshotsKeep
+	ms.dumpCompression = args.DumpCompression
+	ms.logger = logger
 
-	ms.Gauges = NewMetricFloat64()
-	ms.Counters = NewMetricInt64Sum()
+	if err := CheckCompression(ms.dumpCompression); err != nil {
+		return nil, err
+	}
+	ms.server, _ = os.Hostname()
+
+	tiers := storagecommons.NewRetentionTiers(args.RetentionRaw, args.RetentionMinute, args.RetentionHour)
+	if args.NoHistory {
+		tiers = nil
+	}
+	ms.Gauges = NewMetricFloat64(tiers)
+	ms.Counters = NewMetricInt64Sum(tiers)
+	ms.Histograms = NewMetricHistogram(tiers)
+	ms.histogramBuckets = args.HistogramBuckets
+	ms.Summaries = NewMetricSummary(tiers)
+	ms.summaryAccuracy = args.SummaryAccuracy
+	ms.metadata = storagecommons.NewMetadataRegistry()
+	ms.sources = storagecommons.NewCounterSources()
+	ms.compactionInterval = args.CompactionInterval
+	ms.metricTTL = args.MetricTTL
+	ms.ttlCheckInterval = args.TTLCheckInterval
+
+	if ms.fileName != "" {
+		wal, err := openWAL(walFileName(ms.fileName), ms.syncWrite)
+		if err != nil {
+			logger.Sugar().Infof("Unable to open write-ahead log: %s", err.Error())
+		} else {
+			ms.wal = wal
+		}
+	}
 
 	if args.Restore {
 		err := ms.Load(ctx)
 		if err != nil {
 			logger.Sugar().Infof("Unable to load data from file: %s", err.Error())
 		}
+	} else if ms.wal != nil {
+		// Records of previous run are not applied, new ones must be numbered after existing snapshot
+		err := ms.wal.truncate(snapshotSeq(ms.fileName, ms.snapshotsKeep))
+		if err != nil {
+			logger.Sugar().Infof("Unable to truncate write-ahead log: %s", err.Error())
+		}
+	}
+
+	if ms.compactionInterval > 0 {
+		go ms.compactionWorker(ctx)
+	}
+
+	if ms.ttlCheckInterval > 0 {
+		go ms.expiryWorker(ctx)
 	}
 
 	return &ms, nil
@@ -45,28 +106,16 @@ func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*Fi
 // Float64
 
 type MetricFloat64 struct {
-	data map[string]float64
-	mu   sync.Mutex
+	series *shardedSeries[float64]
 }
 
-func NewMetricFloat64() *MetricFloat64 {
-	return &MetricFloat64{data: make(map[string]float64)}
+func NewMetricFloat64(tiers []storagecommons.RetentionTier) *MetricFloat64 {
+	return &MetricFloat64{series: newShardedSeries[float64](tiers)}
 }
 
+// Returns copy of requested values
 func (ths *MetricFloat64) ReadData(ctx context.Context, keys ...string) (map[string]float64, error) {
-	switch len(keys) {
-	case 0:
-		return ths.data, nil
-	case 1:
-		key := keys[0]
-		val, exist := ths.data[key]
-		if exist {
-			return map[string]float64{key: val}, nil
-		}
-		return nil, errors.New("Key gauge/" + key + " not exists")
-	default:
-		return nil, errors.New("it is allowed to request only one key at a time")
-	}
+	return ths.series.readData("gauge", keys)
 }
 
 func (ths *MetricFloat64) WriteData(ctx context.Context, key string, value string) error {
@@ -76,45 +125,44 @@ func (ths *MetricFloat64) WriteData(ctx context.Context, key string, value strin
 		return err
 	}
 
-	ths.mu.Lock()
-	ths.data[key] = v
-	ths.mu.Unlock()
-
-	return nil
+	return ths.WriteDataPP(ctx, key, v)
 }
 
 func (ths *MetricFloat64) WriteDataPP(ctx context.Context, key string, value float64) error {
-	ths.mu.Lock()
-	ths.data[key] = value
-	ths.mu.Unlock()
+	return ths.set(key, value, time.Now())
+}
+
+// Sets value written at `now`
+func (ths *MetricFloat64) set(key string, value float64, now time.Time) error {
+	_, err := ths.series.update(key, now, func(cur float64, exist bool) (float64, error) {
+		return value, nil
+	}, func(value float64) float64 { return value })
+	return err
+}
+
+// Sets value without recording a sample (used while loading data)
+func (ths *MetricFloat64) WriteDataPPInit(ctx context.Context, key string, value float64) error {
+	ths.series.init(key, value)
 	return nil
 }
 
+func (ths *MetricFloat64) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return ths.series.readRange(key, from, to), nil
+}
+
 // Int64 Cumulative
 
 type MetricInt64Sum struct {
-	data map[string]int64
-	mu   sync.Mutex
+	series *shardedSeries[int64]
 }
 
-func NewMetricInt64Sum() *MetricInt64Sum {
-	return &MetricInt64Sum{data: make(map[string]int64)}
+func NewMetricInt64Sum(tiers []storagecommons.RetentionTier) *MetricInt64Sum {
+	return &MetricInt64Sum{series: newShardedSeries[int64](tiers)}
 }
 
+// Returns copy of requested values
 func (ths *MetricInt64Sum) ReadData(ctx context.Context, keys ...string) (map[string]int64, error) {
-	switch len(keys) {
-	case 0:
-		return ths.data, nil
-	case 1:
-		key := keys[0]
-		val, exist := ths.data[key]
-		if exist {
-			return map[string]int64{key: val}, nil
-		}
-		return nil, errors.New("Key gauge/" + key + " not exists")
-	default:
-		return nil, errors.New("it is allowed to request only one key at a time")
-	}
+	return ths.series.readData("counter", keys)
 }
 
 func (ths *MetricInt64Sum) WriteData(ctx context.Context, key string, value string) error {
@@ -125,101 +173,391 @@ func (ths *MetricInt64Sum) WriteData(ctx context.Context, key string, value stri
 		return err
 	}
 
-	ths.mu.Lock()
-	ths.data[key] += v
-	ths.mu.Unlock()
-	return nil
+	return ths.WriteDataPP(ctx, key, v)
 }
 
 func (ths *MetricInt64Sum) WriteDataPP(ctx context.Context, key string, value int64) error {
-	ths.mu.Lock()
-	ths.data[key] += value
-	ths.mu.Unlock()
+	_, err := ths.add(key, value, time.Now())
+	return err
+}
 
-	return nil
+// Adds delta written at `now`, returns accumulated value
+func (ths *MetricInt64Sum) add(key string, value int64, now time.Time) (int64, error) {
+	return ths.series.update(key, now, func(cur int64, exist bool) (int64, error) {
+		return cur + value, nil
+	}, func(value int64) float64 { return float64(value) })
 }
 
 func (ths *MetricInt64Sum) WriteDataPPInit(ctx context.Context, key string, value int64) error {
-	ths.mu.Lock()
-	ths.data[key] = value
-	ths.mu.Unlock()
+	ths.series.init(key, value)
+	return nil
+}
+
+func (ths *MetricInt64Sum) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return ths.series.readRange(key, from, to), nil
+}
 
+// Histogram
+
+type MetricHistogram struct {
+	series *shardedSeries[storagecommons.Histogram]
+}
+
+func NewMetricHistogram(tiers []storagecommons.RetentionTier) *MetricHistogram {
+	return &MetricHistogram{series: newShardedSeries[storagecommons.Histogram](tiers)}
+}
+
+// Returns copy of requested values
+func (ths *MetricHistogram) ReadData(ctx context.Context, keys ...string) (map[string]storagecommons.Histogram, error) {
+	return ths.series.readData("histogram", keys)
+}
+
+// Writes JSON encoded histogram
+func (ths *MetricHistogram) WriteData(ctx context.Context, key string, value string) error {
+	var h storagecommons.Histogram
+	err := json.Unmarshal([]byte(value), &h)
+	if err != nil {
+		return err
+	}
+	err = h.Validate()
+	if err != nil {
+		return err
+	}
+
+	return ths.WriteDataPP(ctx, key, h)
+}
+
+// Merges histogram into stored one (history records total observations count)
+func (ths *MetricHistogram) WriteDataPP(ctx context.Context, key string, value storagecommons.Histogram) error {
+	_, err := ths.merge(key, value, time.Now())
+	return err
+}
+
+// Merges histogram written at `now` into stored one, returns merged value
+func (ths *MetricHistogram) merge(key string, value storagecommons.Histogram, now time.Time) (storagecommons.Histogram, error) {
+	return ths.series.update(key, now, func(cur storagecommons.Histogram, exist bool) (storagecommons.Histogram, error) {
+		if !exist {
+			cur = storagecommons.NewHistogram(value.Bounds)
+		}
+		err := cur.Merge(value)
+		return cur, err
+	}, func(value storagecommons.Histogram) float64 { return float64(value.Count) })
+}
+
+// Sets value without recording a sample (used while loading data)
+func (ths *MetricHistogram) WriteDataPPInit(ctx context.Context, key string, value storagecommons.Histogram) error {
+	ths.series.init(key, value)
 	return nil
 }
 
+func (ths *MetricHistogram) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return ths.series.readRange(key, from, to), nil
+}
+
+// Summary
+
+type MetricSummary struct {
+	series *shardedSeries[storagecommons.Summary]
+}
+
+func NewMetricSummary(tiers []storagecommons.RetentionTier) *MetricSummary {
+	return &MetricSummary{series: newShardedSeries[storagecommons.Summary](tiers)}
+}
+
+// Returns copy of requested values
+func (ths *MetricSummary) ReadData(ctx context.Context, keys ...string) (map[string]storagecommons.Summary, error) {
+	return ths.series.readData("summary", keys)
+}
+
+// Writes JSON encoded summary sketch
+func (ths *MetricSummary) WriteData(ctx context.Context, key string, value string) error {
+	var h storagecommons.Summary
+	err := json.Unmarshal([]byte(value), &h)
+	if err != nil {
+		return err
+	}
+	err = h.Validate()
+	if err != nil {
+		return err
+	}
+
+	return ths.WriteDataPP(ctx, key, h)
+}
+
+// Merges summary sketch into stored one (history records total observations count)
+func (ths *MetricSummary) WriteDataPP(ctx context.Context, key string, value storagecommons.Summary) error {
+	_, err := ths.merge(key, value, time.Now())
+	return err
+}
+
+// Merges summary sketch written at `now` into stored one, returns merged value
+func (ths *MetricSummary) merge(key string, value storagecommons.Summary, now time.Time) (storagecommons.Summary, error) {
+	return ths.series.update(key, now, func(cur storagecommons.Summary, exist bool) (storagecommons.Summary, error) {
+		if !exist {
+			cur = storagecommons.NewSummary(value.Alpha)
+		}
+		err := cur.Merge(value)
+		return cur, err
+	}, func(value storagecommons.Summary) float64 { return float64(value.Count) })
+}
+
+// Sets value without recording a sample (used while loading data)
+func (ths *MetricSummary) WriteDataPPInit(ctx context.Context, key string, value storagecommons.Summary) error {
+	ths.series.init(key, value)
+	return nil
+}
+
+func (ths *MetricSummary) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return ths.series.readRange(key, from, to), nil
+}
+
+// Runs history compaction of all metrics
+func (ms *FileStore) Compact(ctx context.Context) {
+	now := time.Now()
+	ms.Gauges.series.compact(now)
+	ms.Counters.series.compact(now)
+	ms.Histograms.series.compact(now)
+	ms.Summaries.series.compact(now)
+}
+
+// Routine for periodic history compaction
+func (ms *FileStore) compactionWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(ms.compactionInterval)
+		ms.Compact(ctx)
+	}
+}
+
 // DumpLoad
 
+// Writes snapshot of all data and truncates write-ahead log
 func (ms *FileStore) Dump(ctx context.Context) error {
 	ms.dumpMutex.Lock()
 	defer ms.dumpMutex.Unlock()
 
+	return ms.dump(ctx)
+}
+
+// Returns copy of all data with history
+func (ms *FileStore) Snapshot(ctx context.Context) (storagecommons.MetricsDB, error) {
+	ms.dumpMutex.Lock()
+	defer ms.dumpMutex.Unlock()
+
+	return ms.snapshot(ctx)
+}
+
+// Replaces all data with snapshot one and dumps it (write-ahead log records made before are dropped)
+func (ms *FileStore) Restore(ctx context.Context, mdb storagecommons.MetricsDB) error {
+	ms.dumpMutex.Lock()
+	defer ms.dumpMutex.Unlock()
+
+	ms.Gauges.series.reset()
+	ms.Counters.series.reset()
+	ms.Histograms.series.reset()
+	ms.Summaries.series.reset()
+	ms.metadata.Reset()
+	ms.sources.Reset()
+	mdb.WALSeq = 0
+	ms.loadSnapshot(ctx, mdb)
+
+	if ms.fileName == "" {
+		return nil
+	}
+	return ms.dump(ctx)
+}
+
+// Dumps data, dumpMutex must be held by caller
+func (ms *FileStore) dump(ctx context.Context) error {
+	start := time.Now()
+	mdb, err := ms.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeDump(mdb, ms.server, ms.dumpCompression)
+	if err != nil {
+		return err
+	}
+
+	err = writeSnapshot(ms.fileName, data, ms.snapshotsKeep)
+	if err != nil {
+		return err
+	}
+	prom.Storage().ObserveDump("memory", start, len(data))
+
+	if ms.wal == nil {
+		return nil
+	}
+	return ms.wal.truncate(mdb.WALSeq)
+}
+
+// Returns copy of all data with history, dumpMutex must be held by caller
+func (ms *FileStore) snapshot(ctx context.Context) (storagecommons.MetricsDB, error) {
 	mdb := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0)}
+	if ms.wal != nil {
+		mdb.WALSeq = ms.wal.lastSeq()
+	}
 
 	data, err := ms.Gauges.ReadData(ctx)
 	if err != nil {
-		return err
+		return mdb, err
 	}
 	for k, v := range data {
 		v2 := v
+		id, labels, _ := storagecommons.ParseSeriesKey(k)
 		mdb.MetricsDB = append(mdb.MetricsDB, storagecommons.Metrics{
-			ID:    k,
-			MType: "gauge",
-			Value: &v2,
+			ID:     id,
+			MType:  "gauge",
+			Labels: labels,
+			Value:  &v2,
+			TTL:    ms.Gauges.series.getTTL(k),
 		})
 	}
 
 	data2, err := ms.Counters.ReadData(ctx)
 	if err != nil {
-		return err
+		return mdb, err
 	}
 	for k, v := range data2 {
 		v2 := v
+		id, labels, _ := storagecommons.ParseSeriesKey(k)
 		mdb.MetricsDB = append(mdb.MetricsDB, storagecommons.Metrics{
-			ID:    k,
-			MType: "counter",
-			Delta: &v2,
+			ID:     id,
+			MType:  "counter",
+			Labels: labels,
+			Delta:  &v2,
+			TTL:    ms.Counters.series.getTTL(k),
 		})
 	}
 
-	jsn, err := json.MarshalIndent(mdb, "", "    ")
+	data3, err := ms.Histograms.ReadData(ctx)
 	if err != nil {
-		return err
+		return mdb, err
+	}
+	for k, v := range data3 {
+		v2 := v
+		id, labels, _ := storagecommons.ParseSeriesKey(k)
+		mdb.MetricsDB = append(mdb.MetricsDB, storagecommons.Metrics{
+			ID:        id,
+			MType:     "histogram",
+			Labels:    labels,
+			Histogram: &v2,
+			TTL:       ms.Histograms.series.getTTL(k),
+		})
 	}
 
-	f, err := os.OpenFile(ms.fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	data4, err := ms.Summaries.ReadData(ctx)
 	if err != nil {
-		return err
+		return mdb, err
 	}
-	defer f.Close()
-	_, err = f.Write(jsn)
-	if err != nil {
-		return err
+	for k, v := range data4 {
+		v2 := v
+		id, labels, _ := storagecommons.ParseSeriesKey(k)
+		mdb.MetricsDB = append(mdb.MetricsDB, storagecommons.Metrics{
+			ID:      id,
+			MType:   "summary",
+			Labels:  labels,
+			Summary: &v2,
+			TTL:     ms.Summaries.series.getTTL(k),
+		})
 	}
 
-	return nil
+	mdb.History = append(ms.Gauges.series.exportHistory("gauge"),
+		ms.Counters.series.exportHistory("counter")...)
+	mdb.History = append(mdb.History, ms.Histograms.series.exportHistory("histogram")...)
+	mdb.History = append(mdb.History, ms.Summaries.series.exportHistory("summary")...)
+	mdb.Metadata = ms.metadata.All()
+	mdb.Sources = ms.sources.All()
+
+	return mdb, nil
 }
 
+// Loads last snapshot and replays write-ahead log records made after it
 func (ms *FileStore) Load(ctx context.Context) error {
-	data, err := os.ReadFile(ms.fileName)
-	if err != nil {
+	ms.dumpMutex.Lock()
+	defer ms.dumpMutex.Unlock()
+
+	var seq uint64
+	mdb, err := readSnapshot(ms.fileName, ms.snapshotsKeep, ms.logger)
+	switch {
+	case err == nil:
+		seq = ms.loadSnapshot(ctx, mdb)
+	case !errors.Is(err, os.ErrNotExist) || ms.wal == nil:
 		return err
 	}
-	mdb := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0)}
-	err = json.Unmarshal(data, &mdb)
+
+	if ms.wal == nil {
+		return nil
+	}
+
+	records, size, err := readWAL(ms.wal.fileName)
 	if err != nil {
 		return err
 	}
+	for _, rec := range records {
+		if rec.Seq <= seq {
+			continue
+		}
+		// Records logged before accept time was recorded are replayed as made now
+		at := rec.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		switch rec.Op {
+		case walOpWrite:
+			ms.applyWrite(ctx, rec.Metric, at)
+		case walOpDelete:
+			ms.applyDelete(ctx, rec.Metric)
+		}
+		seq = rec.Seq
+	}
+	return ms.wal.restored(seq, len(records), size)
+}
 
+// Sets data and history from snapshot, returns last write-ahead log record included into it
+func (ms *FileStore) loadSnapshot(ctx context.Context, mdb storagecommons.MetricsDB) uint64 {
 	for _, v := range mdb.MetricsDB {
 		switch v.MType {
 		case "counter":
-			ms.Counters.WriteDataPPInit(ctx, v.ID, *v.Delta)
+			ms.Counters.WriteDataPPInit(ctx, v.Key(), *v.Delta)
 		case "gauge":
-			ms.Gauges.WriteDataPP(ctx, v.ID, *v.Value)
+			ms.Gauges.WriteDataPPInit(ctx, v.Key(), *v.Value)
+		case "histogram":
+			ms.Histograms.WriteDataPPInit(ctx, v.Key(), *v.Histogram)
+		case "summary":
+			ms.Summaries.WriteDataPPInit(ctx, v.Key(), *v.Summary)
+		}
+		if v.TTL != nil {
+			ms.setTTL(v.MType, v.Key(), *v.TTL)
 		}
 	}
 
-	return nil
+	for _, v := range mdb.History {
+		switch v.MType {
+		case "counter":
+			ms.Counters.series.setHistory(storagecommons.SeriesKey(v.ID, v.Labels), v.Step, v.Samples)
+		case "gauge":
+			ms.Gauges.series.setHistory(storagecommons.SeriesKey(v.ID, v.Labels), v.Step, v.Samples)
+		case "histogram":
+			ms.Histograms.series.setHistory(storagecommons.SeriesKey(v.ID, v.Labels), v.Step, v.Samples)
+		case "summary":
+			ms.Summaries.series.setHistory(storagecommons.SeriesKey(v.ID, v.Labels), v.Step, v.Samples)
+		}
+	}
+
+	for _, v := range mdb.Metadata {
+		ms.metadata.Set(v)
+	}
+	for _, v := range mdb.Sources {
+		ms.sources.Set(v)
+	}
+	// Snapshots made before metadata was introduced have none, so names are registered by their series
+	now := time.Now()
+	for _, v := range mdb.MetricsDB {
+		ms.metadata.Init(v, now)
+	}
+
+	return mdb.WALSeq
 }
 
 func (ms *FileStore) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
@@ -232,76 +570,304 @@ func (ms *FileStore) WriteDataMulti(ctx context.Context, metrics storagecommons.
 	return nil
 }
 
-func (ms *FileStore) WriteData(ctx context.Context, metrics storagecommons.Metrics) (rMetrics storagecommons.Metrics, rError error) {
-	rError = nil
-	rMetrics = metrics
+// Records write to write-ahead log and applies it.
+// Rejected writes are logged too: writes of the same name are replayed in the order they were applied, so replay rejects them the same way
+func (ms *FileStore) WriteData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	ms.dumpMutex.RLock()
+	unlock := ms.lockName(metrics.ID)
+	res, now := metrics, time.Now()
+	err := ms.logRecord(walOpWrite, metrics, now)
+	if err == nil {
+		res, err = ms.applyWrite(ctx, metrics, now)
+	}
+	unlock()
+	ms.dumpMutex.RUnlock()
+
+	if err != nil {
+		return res, err
+	}
+	ms.dumpIfLogFull(ctx)
+	return res, nil
+}
+
+// Applies write accepted at `now`
+func (ms *FileStore) applyWrite(ctx context.Context, metrics storagecommons.Metrics, now time.Time) (storagecommons.Metrics, error) {
+	rMetrics := metrics
+
+	metrics, err := ms.resolveCumulative(metrics, now)
+	if err != nil {
+		return rMetrics, err
+	}
 
+	// Write is checked before its name is registered, so rejected write leaves no metadata
 	switch metrics.MType {
 	case "gauge":
 		if metrics.Value == nil {
 			return metrics, errors.New("no Value data provided")
 		}
-		ms.Gauges.WriteDataPP(ctx, metrics.ID, *metrics.Value)
-		rMetrics = metrics
 	case "counter":
 		if metrics.Delta == nil {
 			return metrics, errors.New("no Value data provided")
 		}
-		ms.Counters.WriteDataPP(ctx, metrics.ID, *metrics.Delta)
+	case "histogram":
+		h, err := storagecommons.PrepareHistogram(metrics.Histogram, ms.histogramBuckets)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Histogram = &h
+	case "summary":
+		sm, err := storagecommons.PrepareSummary(metrics.Summary, ms.summaryAccuracy)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Summary = &sm
+	default:
+		return metrics, errors.New("Unknown metric type: " + metrics.MType)
+	}
+	if err := ms.metadata.Register(metrics, now); err != nil {
+		return metrics, err
+	}
 
-		data, err := ms.Counters.ReadData(ctx)
+	switch metrics.MType {
+	case "gauge":
+		ms.Gauges.set(metrics.Key(), *metrics.Value, now)
+	case "counter":
+		// Accumulated value is taken under series lock, so it doesn't include increments of later writes
+		vl, err := ms.Counters.add(metrics.Key(), *metrics.Delta, now)
 		if err != nil {
 			return rMetrics, err
 		}
-
-		vl := data[metrics.ID]
 		metrics.Delta = &vl
-		rMetrics = metrics
-	default:
-		rError = errors.New("Unknown metric type: " + metrics.MType)
+	case "histogram":
+		vl, err := ms.Histograms.merge(metrics.Key(), *metrics.Histogram, now)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Histogram = &vl
+	case "summary":
+		vl, err := ms.Summaries.merge(metrics.Key(), *metrics.Summary, now)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Summary = &vl
+	}
+
+	if metrics.TTL != nil {
+		ms.setTTL(metrics.MType, metrics.Key(), *metrics.TTL)
+	}
+
+	return metrics, nil
+}
+
+// Converts cumulative counter write to increment one, recording written value as last one of its source.
+// Metric name is registered first, so write of conflicting type does not change source state
+func (ms *FileStore) ResolveCumulative(metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	ms.dumpMutex.RLock()
+	defer ms.dumpMutex.RUnlock()
+	return ms.resolveCumulative(metrics, time.Now())
+}
+
+func (ms *FileStore) resolveCumulative(metrics storagecommons.Metrics, now time.Time) (storagecommons.Metrics, error) {
+	if !metrics.Cumulative {
+		return metrics, nil
+	}
+	if err := storagecommons.CheckCumulative(metrics); err != nil {
+		return metrics, err
+	}
+	if err := ms.metadata.Register(metrics, now); err != nil {
+		return metrics, err
 	}
 
-	if ms.syncWrite {
+	delta := ms.sources.Observe(metrics)
+	metrics.Delta = &delta
+	metrics.Cumulative = false
+	return metrics, nil
+}
+
+// Locks writes of metric name, returns unlock function
+func (ms *FileStore) lockName(name string) func() {
+	mu := &ms.nameMutexes[keyHash(name)&(seriesShards-1)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Appends record of request accepted at `now` to write-ahead log (if enabled)
+func (ms *FileStore) logRecord(op string, metrics storagecommons.Metrics, now time.Time) error {
+	if ms.wal == nil {
+		return nil
+	}
+	_, err := ms.wal.append(op, metrics, now)
+	return err
+}
+
+// Synchronously writing store has no periodic dumps, so log is truncated by dump once it grows long
+func (ms *FileStore) dumpIfLogFull(ctx context.Context) {
+	if !ms.syncWrite || ms.wal == nil {
+		return
+	}
+	ms.wal.mu.Lock()
+	full := ms.wal.count >= walDumpThreshold
+	ms.wal.mu.Unlock()
+	if full {
 		ms.Dump(ctx)
 	}
+}
 
-	return
+// Sets series own TTL in seconds (0 - use global TTL)
+func (ms *FileStore) setTTL(mtype string, key string, ttl int64) {
+	switch mtype {
+	case "gauge":
+		ms.Gauges.series.setTTL(key, ttl)
+	case "counter":
+		ms.Counters.series.setTTL(key, ttl)
+	case "histogram":
+		ms.Histograms.series.setTTL(key, ttl)
+	case "summary":
+		ms.Summaries.series.setTTL(key, ttl)
+	}
+}
+
+// Records delete to write-ahead log and deletes series
+func (ms *FileStore) Delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	ms.dumpMutex.RLock()
+	unlock := ms.lockName(metrics.ID)
+	err := ms.logRecord(walOpDelete, metrics, time.Now())
+	if err == nil {
+		err = ms.applyDelete(ctx, metrics)
+	}
+	unlock()
+	ms.dumpMutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+	ms.dumpIfLogFull(ctx)
+	return nil
+}
+
+func (ms *FileStore) applyDelete(ctx context.Context, metrics storagecommons.Metrics) error {
+	var exist bool
+	switch metrics.MType {
+	case "gauge":
+		exist = ms.Gauges.series.delete(metrics.Key())
+	case "counter":
+		exist = ms.Counters.series.delete(metrics.Key())
+		ms.sources.Drop(metrics.Key())
+	case "histogram":
+		exist = ms.Histograms.series.delete(metrics.Key())
+	case "summary":
+		exist = ms.Summaries.series.delete(metrics.Key())
+	default:
+		return errors.New("Unknown metric type: " + metrics.MType)
+	}
+	if !exist {
+		return storagecommons.NotExistsError(metrics.MType, metrics.Key())
+	}
+
+	return nil
+}
+
+// Drops series not updated within their TTL
+func (ms *FileStore) Expire(ctx context.Context) {
+	now := time.Now()
+	ms.Gauges.series.expire(now, ms.metricTTL)
+	ms.Counters.series.expire(now, ms.metricTTL)
+	ms.Histograms.series.expire(now, ms.metricTTL)
+	ms.Summaries.series.expire(now, ms.metricTTL)
+}
+
+// Returns series not updated within their TTL without dropping them (for owner deleting them elsewhere too)
+func (ms *FileStore) Expired(ctx context.Context) []storagecommons.Metrics {
+	now := time.Now()
+	res := make([]storagecommons.Metrics, 0)
+	for mtype, keys := range map[string][]string{
+		"gauge":     ms.Gauges.series.expired(now, ms.metricTTL),
+		"counter":   ms.Counters.series.expired(now, ms.metricTTL),
+		"histogram": ms.Histograms.series.expired(now, ms.metricTTL),
+		"summary":   ms.Summaries.series.expired(now, ms.metricTTL),
+	} {
+		for _, k := range keys {
+			id, labels, _ := storagecommons.ParseSeriesKey(k)
+			res = append(res, storagecommons.Metrics{ID: id, MType: mtype, Labels: labels})
+		}
+	}
+	return res
+}
+
+// Routine for periodic expired series removal
+func (ms *FileStore) expiryWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(ms.ttlCheckInterval)
+		ms.Expire(ctx)
+	}
 }
 
 func (ms *FileStore) ReadData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
 	switch metrics.MType {
 	case "gauge":
-		data, err := ms.Gauges.ReadData(ctx)
+		data, err := ms.Gauges.ReadData(ctx, metrics.Key())
 
 		if err != nil {
 			return metrics, err
 		}
 
-		vl, exist := data[metrics.ID]
-		if exist {
-			metrics.Value = &vl
-			return metrics, nil
-		}
-		return metrics, errors.New("Key gauge/" + metrics.ID + " not exists")
+		vl := data[metrics.Key()]
+		metrics.Value = &vl
+		return metrics, nil
 	case "counter":
-		data, err := ms.Counters.ReadData(ctx)
+		data, err := ms.Counters.ReadData(ctx, metrics.Key())
+
+		if err != nil {
+			return metrics, err
+		}
+
+		vl := data[metrics.Key()]
+		metrics.Delta = &vl
+		return metrics, nil
+	case "histogram":
+		data, err := ms.Histograms.ReadData(ctx, metrics.Key())
 
 		if err != nil {
 			return metrics, err
 		}
 
-		vl, exist := data[metrics.ID]
-		if exist {
-			metrics.Delta = &vl
-			return metrics, nil
+		vl := data[metrics.Key()]
+		metrics.Histogram = &vl
+		return metrics, nil
+	case "summary":
+		data, err := ms.Summaries.ReadData(ctx, metrics.Key())
+
+		if err != nil {
+			return metrics, err
 		}
-		return metrics, errors.New("Key counter/" + metrics.ID + " not exists")
+
+		vl := data[metrics.Key()]
+		metrics.Summary = &vl
+		return metrics, nil
 	default:
 		return metrics, errors.New("Unknown metric type: " + metrics.MType)
 	}
 }
 
+func (ms *FileStore) ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	switch mtype {
+	case "gauge":
+		return ms.Gauges.ReadRange(ctx, id, from, to)
+	case "counter":
+		return ms.Counters.ReadRange(ctx, id, from, to)
+	case "histogram":
+		return ms.Histograms.ReadRange(ctx, id, from, to)
+	case "summary":
+		return ms.Summaries.ReadRange(ctx, id, from, to)
+	default:
+		return nil, errors.New("Unknown metric type: " + mtype)
+	}
+}
+
 func (ms *FileStore) Close(ctx context.Context) error {
+	if ms.wal != nil {
+		return ms.wal.close()
+	}
 	return nil
 }
 
@@ -313,6 +879,29 @@ func (ms *FileStore) GetCounters() storagecommons.StoragerInt64Sum {
 	return ms.Counters
 }
 
+func (ms *FileStore) GetHistograms() storagecommons.StoragerHistogram {
+	return ms.Histograms
+}
+
+func (ms *FileStore) GetSummaries() storagecommons.StoragerSummary {
+	return ms.Summaries
+}
+
+// Returns metadata of all written metric names (metadata outlives deleted and expired series)
+func (ms *FileStore) GetMetadata(ctx context.Context) ([]storagecommons.MetricMetadata, error) {
+	return ms.metadata.All(), nil
+}
+
+// Returns number of stored series by metric type
+func (ms *FileStore) SeriesCount(ctx context.Context) (map[string]int, error) {
+	return map[string]int{
+		"gauge":     ms.Gauges.series.len(),
+		"counter":   ms.Counters.series.len(),
+		"histogram": ms.Histograms.series.len(),
+		"summary":   ms.Summaries.series.len(),
+	}, nil
+}
+
 func (ms *FileStore) Ping(ctx context.Context) error {
 	return nil
 }
@@ -0,0 +1,115 @@
+package filestore
+
+import (
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// In-memory samples of metrics, split into retention tiers (not thread safe, guarded by owner).
+// History without tiers records no samples
+type seriesHistory struct {
+	tiers   []storagecommons.RetentionTier
+	samples []map[string][]storagecommons.Sample
+	rolled  []time.Time // End of last rolled up bucket of each tier
+}
+
+func newSeriesHistory(tiers []storagecommons.RetentionTier) *seriesHistory {
+	h := seriesHistory{
+		tiers:   tiers,
+		samples: make([]map[string][]storagecommons.Sample, len(tiers)),
+		rolled:  make([]time.Time, len(tiers)),
+	}
+	for i := range h.samples {
+		h.samples[i] = make(map[string][]storagecommons.Sample)
+	}
+	return &h
+}
+
+// Records raw sample made at `now`
+func (h *seriesHistory) add(key string, value float64, now time.Time) {
+	if len(h.tiers) == 0 {
+		return
+	}
+	h.samples[0][key] = append(h.samples[0][key], storagecommons.Sample{Timestamp: now, Value: value})
+}
+
+// Returns samples within [from, to] of the finest tier covering `from`
+func (h *seriesHistory) readRange(key string, from time.Time, to time.Time) []storagecommons.Sample {
+	if len(h.tiers) == 0 {
+		return []storagecommons.Sample{}
+	}
+	tier := storagecommons.SelectTier(h.tiers, from, time.Now())
+	return storagecommons.SamplesInRange(h.samples[tier][key], from, to)
+}
+
+// Builds rollups of completed buckets and drops samples older than tier retention
+func (h *seriesHistory) compact(now time.Time) {
+	for i := 1; i < len(h.tiers); i++ {
+		step := h.tiers[i].Step
+		end := now.Truncate(step)
+		if !end.After(h.rolled[i]) {
+			continue
+		}
+		for key, samples := range h.samples[i-1] {
+			src := storagecommons.SamplesInRange(samples, h.rolled[i], end.Add(-time.Nanosecond))
+			if len(src) == 0 {
+				continue
+			}
+			h.samples[i][key] = append(h.samples[i][key], storagecommons.Downsample(src, step)...)
+		}
+		h.rolled[i] = end
+	}
+
+	for i, tier := range h.tiers {
+		if tier.Keep == 0 {
+			continue
+		}
+		cutoff := now.Add(-tier.Keep)
+		for key, samples := range h.samples[i] {
+			samples = storagecommons.ExpireSamples(samples, cutoff)
+			if len(samples) == 0 {
+				delete(h.samples[i], key)
+				continue
+			}
+			h.samples[i][key] = samples
+		}
+	}
+}
+
+// Returns copy of all stored samples
+func (h *seriesHistory) export(mtype string) []storagecommons.MetricHistory {
+	res := make([]storagecommons.MetricHistory, 0)
+	for i, tier := range h.tiers {
+		for k, v := range h.samples[i] {
+			samples := make([]storagecommons.Sample, len(v))
+			copy(samples, v)
+			id, labels, _ := storagecommons.ParseSeriesKey(k)
+			res = append(res, storagecommons.MetricHistory{ID: id, MType: mtype, Labels: labels, Step: tier.Step, Samples: samples})
+		}
+	}
+	return res
+}
+
+// Replaces stored samples of metric in tier with given step
+func (h *seriesHistory) set(key string, step time.Duration, samples []storagecommons.Sample) {
+	for i, tier := range h.tiers {
+		if tier.Step != step {
+			continue
+		}
+		h.samples[i][key] = samples
+		if i > 0 && len(samples) > 0 {
+			end := samples[len(samples)-1].Timestamp.Add(step)
+			if end.After(h.rolled[i]) {
+				h.rolled[i] = end
+			}
+		}
+		return
+	}
+}
+
+// Drops all samples of metric
+func (h *seriesHistory) drop(key string) {
+	for i := range h.samples {
+		delete(h.samples[i], key)
+	}
+}
@@ -0,0 +1,248 @@
+package filestore
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Number of shards of series map (power of two)
+const seriesShards = 32
+
+// Part of series map guarded by own lock
+type seriesShard[T any] struct {
+	mu      sync.Mutex
+	data    map[string]T
+	history *seriesHistory
+	expiry  *seriesExpiry
+}
+
+// Lock-striped map of series values with their samples and expiry state.
+// Series are spread over shards by key hash, so writers and readers of different series rarely contend.
+// Values are returned by copy, stored values are replaced on write and never mutated in place
+type shardedSeries[T any] struct {
+	shards [seriesShards]seriesShard[T]
+}
+
+func newShardedSeries[T any](tiers []storagecommons.RetentionTier) *shardedSeries[T] {
+	var s shardedSeries[T]
+	for i := range s.shards {
+		s.shards[i].data = make(map[string]T)
+		s.shards[i].history = newSeriesHistory(tiers)
+		s.shards[i].expiry = newSeriesExpiry()
+	}
+	return &s
+}
+
+// Returns shard of series
+func (s *shardedSeries[T]) shard(key string) *seriesShard[T] {
+	return &s.shards[keyHash(key)&(seriesShards-1)]
+}
+
+// Returns FNV-1a hash of key
+func keyHash(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (s *shardedSeries[T]) get(key string) (T, bool) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	val, ok := sh.data[key]
+	return val, ok
+}
+
+// Returns copy of all values
+func (s *shardedSeries[T]) all() map[string]T {
+	res := make(map[string]T)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for k, v := range sh.data {
+			res[k] = v
+		}
+		sh.mu.Unlock()
+	}
+	return res
+}
+
+// Returns number of stored series
+func (s *shardedSeries[T]) len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		n += len(sh.data)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// Replaces value with result of `f` applied to stored one, records sample and update time made at `now`. Returns new value
+func (s *shardedSeries[T]) update(key string, now time.Time, f func(cur T, exist bool) (T, error), sample func(value T) float64) (T, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	cur, exist := sh.data[key]
+	res, err := f(cur, exist)
+	if err != nil {
+		return cur, err
+	}
+	sh.data[key] = res
+	sh.history.add(key, sample(res), now)
+	sh.expiry.touch(key, now)
+	return res, nil
+}
+
+// Sets value without recording a sample (used while loading data)
+func (s *shardedSeries[T]) init(key string, value T) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.data[key] = value
+	sh.expiry.touch(key, time.Now())
+}
+
+func (s *shardedSeries[T]) readRange(key string, from time.Time, to time.Time) []storagecommons.Sample {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.history.readRange(key, from, to)
+}
+
+// Drops series data, samples and expiry state, returns false if series not exists
+func (s *shardedSeries[T]) delete(key string) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.data[key]; !ok {
+		return false
+	}
+	sh.drop(key)
+	return true
+}
+
+func (sh *seriesShard[T]) drop(key string) {
+	delete(sh.data, key)
+	sh.history.drop(key)
+	sh.expiry.drop(key)
+}
+
+// Drops all series
+func (s *shardedSeries[T]) reset() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for key := range sh.data {
+			sh.drop(key)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// Drops series not updated within their TTL (`global` if own TTL not set, 0 - never expire)
+func (s *shardedSeries[T]) expire(now time.Time, global time.Duration) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for _, key := range sh.expiry.expired(now, global) {
+			sh.drop(key)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// Returns keys of series not updated within their TTL, series are left in place
+func (s *shardedSeries[T]) expired(now time.Time, global time.Duration) []string {
+	res := make([]string, 0)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		res = append(res, sh.expiry.expired(now, global)...)
+		sh.mu.Unlock()
+	}
+	return res
+}
+
+// Sets series own TTL in seconds (0 - use global TTL)
+func (s *shardedSeries[T]) setTTL(key string, ttl int64) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.expiry.setTTL(key, time.Duration(ttl)*time.Second)
+}
+
+// Returns series own TTL in seconds, nil if not set
+func (s *shardedSeries[T]) getTTL(key string) *int64 {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	ttl, ok := sh.expiry.ttl[key]
+	if !ok {
+		return nil
+	}
+	res := int64(ttl / time.Second)
+	return &res
+}
+
+// Overrides series update time
+func (s *shardedSeries[T]) setUpdated(key string, updated time.Time) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.expiry.updated[key] = updated
+}
+
+// Returns copy of all stored samples
+func (s *shardedSeries[T]) exportHistory(mtype string) []storagecommons.MetricHistory {
+	res := make([]storagecommons.MetricHistory, 0)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		res = append(res, sh.history.export(mtype)...)
+		sh.mu.Unlock()
+	}
+	return res
+}
+
+// Replaces stored samples of series in tier with given step
+func (s *shardedSeries[T]) setHistory(key string, step time.Duration, samples []storagecommons.Sample) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.history.set(key, step, samples)
+}
+
+// Builds rollups and drops expired samples
+func (s *shardedSeries[T]) compact(now time.Time) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.history.compact(now)
+		sh.mu.Unlock()
+	}
+}
+
+// Returns values of requested series (all series if no keys given, at most one key allowed otherwise)
+func (s *shardedSeries[T]) readData(mtype string, keys []string) (map[string]T, error) {
+	switch len(keys) {
+	case 0:
+		return s.all(), nil
+	case 1:
+		key := keys[0]
+		val, exist := s.get(key)
+		if exist {
+			return map[string]T{key: val}, nil
+		}
+		return nil, storagecommons.NotExistsError(mtype, key)
+	default:
+		return nil, errors.New("it is allowed to request only one key at a time")
+	}
+}
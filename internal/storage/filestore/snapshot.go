@@ -0,0 +1,138 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strconv"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Snapshot file starts with header line holding checksum of dump data following it (see encodeDump)
+const snapshotHeaderPrefix = "# metrics snapshot sha256="
+
+// Returns file name of i-th snapshot (0 - newest, then `<name>.1`, `<name>.2`, ...)
+func snapshotFileName(fileName string, i int) string {
+	if i == 0 {
+		return fileName
+	}
+	return fileName + "." + strconv.Itoa(i)
+}
+
+// Prepends checksum header to snapshot data
+func encodeSnapshot(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	res := make([]byte, 0, len(snapshotHeaderPrefix)+sha256.Size*2+1+len(data))
+	res = append(res, snapshotHeaderPrefix...)
+	res = append(res, hex.EncodeToString(sum[:])...)
+	res = append(res, '\n')
+	return append(res, data...)
+}
+
+// Verifies checksum header and returns snapshot data.
+// Files without header (written before checksums were introduced) are returned as is
+func decodeSnapshot(raw []byte) ([]byte, error) {
+	if !bytes.HasPrefix(raw, []byte(snapshotHeaderPrefix)) {
+		return raw, nil
+	}
+	header, data, found := bytes.Cut(raw, []byte{'\n'})
+	if !found {
+		return nil, errors.New("snapshot header is not terminated")
+	}
+	sum := sha256.Sum256(data)
+	if string(header[len(snapshotHeaderPrefix):]) != hex.EncodeToString(sum[:]) {
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+	return data, nil
+}
+
+// Atomically replaces newest snapshot: data is written to temp file, synced and renamed.
+// Previous snapshots are shifted keeping `keep` files in total
+func writeSnapshot(fileName string, data []byte, keep int) error {
+	dir := filepath.Dir(fileName)
+	f, err := os.CreateTemp(dir, filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+
+	_, err = f.Write(encodeSnapshot(data))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	for i := keep - 1; i > 0; i-- {
+		err = os.Rename(snapshotFileName(fileName, i-1), snapshotFileName(fileName, i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+
+	err = os.Rename(tmpName, fileName)
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	// Renames reach disc with directory sync
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Returns newest valid snapshot out of `keep` ones. Invalid snapshots are reported to `logger` (if not nil).
+// Returns os.ErrNotExist if there are no snapshots at all
+func readSnapshot(fileName string, keep int, logger *zap.Logger) (storagecommons.MetricsDB, error) {
+	var errs []error
+	found := false
+	for i := 0; i < max(keep, 1); i++ {
+		name := snapshotFileName(fileName, i)
+		raw, err := os.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		found = true
+
+		var mdb storagecommons.MetricsDB
+		if err == nil {
+			var data []byte
+			data, err = decodeSnapshot(raw)
+			if err == nil {
+				mdb, _, err = decodeDump(data)
+			}
+		}
+		if err == nil {
+			if i > 0 && logger != nil {
+				logger.Sugar().Infof("Data restored from older snapshot %s, writes made after it may be lost", name)
+			}
+			return mdb, nil
+		}
+
+		err = fmt.Errorf("snapshot %s is invalid: %w", name, err)
+		if logger != nil {
+			logger.Sugar().Infof("%s, falling back to older snapshot", err.Error())
+		}
+		errs = append(errs, err)
+	}
+
+	if !found {
+		return storagecommons.MetricsDB{}, os.ErrNotExist
+	}
+	return storagecommons.MetricsDB{}, errors.Join(errs...)
+}
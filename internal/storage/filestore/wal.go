@@ -0,0 +1,156 @@
+package filestore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Write-ahead log operations
+const (
+	walOpWrite  = "write"
+	walOpDelete = "delete"
+)
+
+// Number of records after which synchronously writing store dumps snapshot and truncates log
+const walDumpThreshold = 10000
+
+// Accepted write or delete request
+type walRecord struct {
+	Seq    uint64                 `json:"seq"`
+	Op     string                 `json:"op"`
+	Time   time.Time              `json:"time"` // Accept time, samples of replayed writes are stamped with it
+	Metric storagecommons.Metrics `json:"metric"`
+}
+
+// Append-only log of JSON encoded records, one per line
+type writeAheadLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	fileName string
+	seq      uint64 // Sequence number of last appended record
+	count    int    // Records appended since last truncation
+	sync     bool   // Flush every record to disc
+}
+
+// Returns log file name of snapshot file
+func walFileName(snapshot string) string {
+	return snapshot + ".wal"
+}
+
+func openWAL(fileName string, sync bool) (*writeAheadLog, error) {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{file: f, fileName: fileName, sync: sync}, nil
+}
+
+// Appends record of request accepted at `now`, returns number of records since last truncation
+func (w *writeAheadLog) append(op string, metrics storagecommons.Metrics, now time.Time) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rec := walRecord{Seq: w.seq + 1, Op: op, Time: now, Metric: metrics}
+	jsn, err := json.Marshal(rec)
+	if err != nil {
+		return w.count, err
+	}
+	_, err = w.file.Write(append(jsn, '\n'))
+	if err != nil {
+		return w.count, err
+	}
+	if w.sync {
+		err = w.file.Sync()
+		if err != nil {
+			return w.count, err
+		}
+	}
+	w.seq = rec.Seq
+	w.count++
+
+	return w.count, nil
+}
+
+// Returns sequence number of last appended record
+func (w *writeAheadLog) lastSeq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// Drops all records, numbering continues from `seq` (if greater than current)
+func (w *writeAheadLog) truncate(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	w.seq = max(w.seq, seq)
+	w.count = 0
+	return nil
+}
+
+// Continues numbering after replayed records, drops malformed tail of log (of `size` valid bytes)
+func (w *writeAheadLog) restored(seq uint64, count int, size int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq = max(w.seq, seq)
+	w.count = count
+	return w.file.Truncate(size)
+}
+
+func (w *writeAheadLog) close() error {
+	return w.file.Close()
+}
+
+// Reads all records of log, returns them with size of valid part of log.
+// Reading stops at first malformed record, which is left by write interrupted by crash
+func readWAL(fileName string) ([]walRecord, int64, error) {
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	res := make([]walRecord, 0)
+	var size int64
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			// Last record without line end is incomplete
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, 0, err
+		}
+		var rec walRecord
+		if json.Unmarshal(line, &rec) != nil {
+			break
+		}
+		res = append(res, rec)
+		size += int64(len(line))
+	}
+
+	return res, size, nil
+}
+
+// Returns sequence number of last log record included into newest valid snapshot
+func snapshotSeq(fileName string, keep int) uint64 {
+	mdb, err := readSnapshot(fileName, keep, nil)
+	if err != nil {
+		return 0
+	}
+	return mdb.WALSeq
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+	"yaprakticum-go-track2/internal/prom"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Storager recording latency of backend operations and written batch sizes (see prom.StorageMetrics)
+type instrumentedStorage struct {
+	storagecommons.Storager
+	backend string
+	metrics *prom.StorageMetrics
+}
+
+func newInstrumentedStorage(s storagecommons.Storager, backend string) *instrumentedStorage {
+	return &instrumentedStorage{Storager: s, backend: backend, metrics: prom.Storage()}
+}
+
+func (is *instrumentedStorage) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	defer is.metrics.ObserveOp(is.backend, "write_batch", time.Now())
+	is.metrics.ObserveBatch(is.backend, len(metrics.MetricsDB))
+	return is.Storager.WriteDataMulti(ctx, metrics)
+}
+
+func (is *instrumentedStorage) WriteData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	defer is.metrics.ObserveOp(is.backend, "write", time.Now())
+	return is.Storager.WriteData(ctx, metrics)
+}
+
+func (is *instrumentedStorage) ReadData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	defer is.metrics.ObserveOp(is.backend, "read", time.Now())
+	return is.Storager.ReadData(ctx, metrics)
+}
+
+func (is *instrumentedStorage) ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	defer is.metrics.ObserveOp(is.backend, "read_range", time.Now())
+	return is.Storager.ReadRange(ctx, mtype, id, from, to)
+}
+
+func (is *instrumentedStorage) Delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	defer is.metrics.ObserveOp(is.backend, "delete", time.Now())
+	return is.Storager.Delete(ctx, metrics)
+}
+
+func (is *instrumentedStorage) GetMetadata(ctx context.Context) ([]storagecommons.MetricMetadata, error) {
+	defer is.metrics.ObserveOp(is.backend, "read_metadata", time.Now())
+	return is.Storager.GetMetadata(ctx)
+}
+
+func (is *instrumentedStorage) GetGauges() storagecommons.StoragerFloat64 {
+	return instrumentedSubstorage[float64]{Substorager: is.Storager.GetGauges(), is: is}
+}
+
+func (is *instrumentedStorage) GetCounters() storagecommons.StoragerInt64Sum {
+	return instrumentedSubstorage[int64]{Substorager: is.Storager.GetCounters(), is: is}
+}
+
+func (is *instrumentedStorage) GetHistograms() storagecommons.StoragerHistogram {
+	return instrumentedSubstorage[storagecommons.Histogram]{Substorager: is.Storager.GetHistograms(), is: is}
+}
+
+func (is *instrumentedStorage) GetSummaries() storagecommons.StoragerSummary {
+	return instrumentedSubstorage[storagecommons.Summary]{Substorager: is.Storager.GetSummaries(), is: is}
+}
+
+func (is *instrumentedStorage) Snapshot(ctx context.Context) (storagecommons.MetricsDB, error) {
+	ss, ok := is.Storager.(storagecommons.Snapshotter)
+	if !ok {
+		return storagecommons.MetricsDB{}, errors.New("storage does not support snapshots")
+	}
+	return ss.Snapshot(ctx)
+}
+
+func (is *instrumentedStorage) Restore(ctx context.Context, mdb storagecommons.MetricsDB) error {
+	ss, ok := is.Storager.(storagecommons.Snapshotter)
+	if !ok {
+		return errors.New("storage does not support snapshots")
+	}
+	return ss.Restore(ctx, mdb)
+}
+
+// Substorager recording latency of value reads
+type instrumentedSubstorage[T any] struct {
+	storagecommons.Substorager[T]
+	is *instrumentedStorage
+}
+
+func (iss instrumentedSubstorage[T]) ReadData(ctx context.Context, keys ...string) (map[string]T, error) {
+	defer iss.is.metrics.ObserveOp(iss.is.backend, "read_values", time.Now())
+	return iss.Substorager.ReadData(ctx, keys...)
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+// Returns gathered metric family of default registry
+func gatherFamily(t *testing.T, name string) *dto.MetricFamily {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func TestStorageMetrics(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	db, err := InitStorage(ctx, config.ServerConfig{FileStoragePath: fileName, StoreInterval: 300, SnapshotsKeep: 1},
+		testhelpers.GetCustomZap(zap.ErrorLevel))
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	var d int64 = 1
+	var v = 2.5
+	err = db.WriteDataMulti(storagecommons.WithTenant(ctx, "team_m"), storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{
+		{ID: "c", MType: "counter", Delta: &d},
+		{ID: "g", MType: "gauge", Value: &v},
+	}})
+	assert.NoError(t, err)
+	_, err = db.ReadData(ctx, storagecommons.Metrics{ID: "c", MType: "counter"})
+	assert.Error(t, err)
+	assert.NoError(t, db.Dump(ctx))
+
+	t.Run("Operations", func(t *testing.T) {
+		f := gatherFamily(t, "ypmetricssrv_storage_operation_duration_seconds")
+		if assert.NotNil(t, f) {
+			ops := make(map[string]bool)
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "operation" {
+						ops[l.GetValue()] = true
+					}
+				}
+			}
+			assert.True(t, ops["write_batch"])
+			assert.True(t, ops["read"])
+		}
+	})
+
+	t.Run("Batch Size", func(t *testing.T) {
+		f := gatherFamily(t, "ypmetricssrv_storage_batch_size")
+		if assert.NotNil(t, f) {
+			assert.NotZero(t, f.GetMetric()[0].GetHistogram().GetSampleSum())
+		}
+	})
+
+	t.Run("Dump", func(t *testing.T) {
+		f := gatherFamily(t, "ypmetricssrv_storage_dump_size_bytes")
+		if assert.NotNil(t, f) {
+			assert.NotZero(t, f.GetMetric()[0].GetGauge().GetValue())
+		}
+	})
+
+	t.Run("Series", func(t *testing.T) {
+		f := gatherFamily(t, "ypmetricssrv_storage_series")
+		if assert.NotNil(t, f) {
+			series := make(map[string]float64)
+			for _, m := range f.GetMetric() {
+				labels := make(map[string]string)
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				series[labels["tenant"]+"/"+labels["type"]] = m.GetGauge().GetValue()
+			}
+			assert.Equal(t, 1.0, series["team_m/counter"])
+			assert.Equal(t, 1.0, series["team_m/gauge"])
+			assert.Equal(t, 0.0, series["/counter"])
+		}
+	})
+}
@@ -4,29 +4,52 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"go.uber.org/zap"
 	"yaprakticum-go-track2/internal/config"
-	"yaprakticum-go-track2/internal/storage/dbstore"
-	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/prom"
+	"yaprakticum-go-track2/internal/replication"
 	"yaprakticum-go-track2/internal/storage/storagecommons"
 )
 
 // Storage interface type
 type Storage struct {
 	storagecommons.Storager
+	tenants *tenantStorage
 }
 
 // Storage constructor
+//
+// Storage calls are scoped to data of tenant set in call context (see storagecommons.WithTenant).
+// Writes are replicated to followers if any configured
 func InitStorage(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*Storage, error) {
-	var ms Storage
-
-	if args.ConnString == "" || args.ConnString == "$test$" {
-		fs, _ := filestore.New(ctx, args, logger)
-		ms.Storager = fs
-	} else {
-		dbs, _ := dbstore.New(ctx, args, logger)
-		ms.Storager = dbs
+	ts, err := newTenantStorage(ctx, args, logger)
+	if err != nil {
+		return nil, err
+	}
+	prom.Storage().SetSeriesSource(ts.seriesCount)
+	if len(args.Replicas) > 0 {
+		// Followers are caught up from snapshots, so they would never get batches of other backends
+		if !ts.snapshots() {
+			ts.Close(ctx)
+			return nil, errors.New("replication requires storage supporting snapshots (in-memory storage)")
+		}
+		return &Storage{Storager: replication.NewPrimary(ctx, ts, args, logger), tenants: ts}, nil
 	}
+	return &Storage{Storager: ts, tenants: ts}, nil
+}
+
+// Returns tenants having data
+func (s *Storage) Tenants() []string {
+	return s.tenants.Tenants()
+}
+
+// Returns copy of all data of tenant the call context is scoped to
+func (s *Storage) Snapshot(ctx context.Context) (storagecommons.MetricsDB, error) {
+	return s.tenants.Snapshot(ctx)
+}
 
-	return &ms, nil
+// Replaces all data of tenant the call context is scoped to
+func (s *Storage) Restore(ctx context.Context, mdb storagecommons.MetricsDB) error {
+	return s.tenants.Restore(ctx, mdb)
 }
@@ -0,0 +1,121 @@
+package storagecommons
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// JSON serializable structure describing last value of cumulative counter reported by source
+type CounterSource struct {
+	ID     string            `json:"id"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Source string            `json:"source"`
+	Value  int64             `json:"value"`
+}
+
+// Returns key of counter series the source reports (see SeriesKey)
+func (cs CounterSource) Key() string {
+	return SeriesKey(cs.ID, cs.Labels)
+}
+
+// Checks cumulative write: only counters may be written so, with non-negative value
+func CheckCumulative(m Metrics) error {
+	if !m.Cumulative {
+		return nil
+	}
+	if m.MType != "counter" {
+		return errors.New("only counters can be written as cumulative, got " + m.MType)
+	}
+	if m.Delta == nil {
+		return errors.New("no Delta data provided")
+	}
+	if *m.Delta < 0 {
+		return errors.New("cumulative counter value must not be negative")
+	}
+	return nil
+}
+
+// Returns increment of cumulative counter reported as `value` after `last` one.
+// Value lower than last one means counter reset, so it is counted from zero.
+// First value of source is counted from zero as well
+func CumulativeDelta(last int64, exist bool, value int64) int64 {
+	if !exist || value < last {
+		return value
+	}
+	return value - last
+}
+
+// Returns source state recorded by cumulative write
+func SourceOf(m Metrics) CounterSource {
+	return CounterSource{ID: m.ID, Labels: m.Labels, Source: m.Source, Value: *m.Delta}
+}
+
+// In-memory last values of cumulative counters by series and source
+type CounterSources struct {
+	mu   sync.Mutex
+	data map[[2]string]CounterSource
+}
+
+func NewCounterSources() *CounterSources {
+	return &CounterSources{data: make(map[[2]string]CounterSource)}
+}
+
+// Records value of cumulative write, returns counter increment (see CumulativeDelta)
+func (cs *CounterSources) Observe(m Metrics) int64 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	k := [2]string{m.Key(), m.Source}
+	last, exist := cs.data[k]
+	cs.data[k] = SourceOf(m)
+	return CumulativeDelta(last.Value, exist, *m.Delta)
+}
+
+// Sets source state as is (used while loading data)
+func (cs *CounterSources) Set(src CounterSource) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.data[[2]string{src.Key(), src.Source}] = src
+}
+
+// Drops states of all sources of series
+func (cs *CounterSources) Drop(key string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for k := range cs.data {
+		if k[0] == key {
+			delete(cs.data, k)
+		}
+	}
+}
+
+// Returns copy of all source states ordered by series key and source
+func (cs *CounterSources) All() []CounterSource {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	keys := make([][2]string, 0, len(cs.data))
+	for k := range cs.data {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	res := make([]CounterSource, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, cs.data[k])
+	}
+	return res
+}
+
+// Drops all source states
+func (cs *CounterSources) Reset() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.data = make(map[[2]string]CounterSource)
+}
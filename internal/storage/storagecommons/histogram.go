@@ -0,0 +1,76 @@
+package storagecommons
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+// JSON serializable histogram state.
+// Counts[i] is number of observations within (Bounds[i-1], Bounds[i]], last element counts observations above all bounds
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []int64   `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  int64     `json:"count"`
+}
+
+// Returns empty histogram with given bucket bounds
+func NewHistogram(bounds []float64) Histogram {
+	return Histogram{Bounds: slices.Clone(bounds), Counts: make([]int64, len(bounds)+1)}
+}
+
+// Adds single observation
+func (h *Histogram) Observe(v float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Sum += v
+	h.Count++
+}
+
+// Checks histogram consistency
+func (h Histogram) Validate() error {
+	if !sort.Float64sAreSorted(h.Bounds) {
+		return errors.New("histogram bounds must be sorted")
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return errors.New("histogram must have one more bucket count than bounds")
+	}
+	var total int64
+	for _, c := range h.Counts {
+		if c < 0 {
+			return errors.New("histogram bucket counts must not be negative")
+		}
+		total += c
+	}
+	if total != h.Count {
+		return errors.New("histogram count does not match bucket counts")
+	}
+	return nil
+}
+
+// Adds buckets, sum and count of other histogram with same bounds
+func (h *Histogram) Merge(o Histogram) error {
+	if !slices.Equal(h.Bounds, o.Bounds) {
+		return errors.New("histogram bounds mismatch")
+	}
+	counts := slices.Clone(h.Counts)
+	for i := range counts {
+		counts[i] += o.Counts[i]
+	}
+	h.Counts = counts
+	h.Sum += o.Sum
+	h.Count += o.Count
+	return nil
+}
+
+// Returns validated copy of written histogram, empty bounds are replaced with `defaultBounds`
+func PrepareHistogram(h *Histogram, defaultBounds []float64) (Histogram, error) {
+	if h == nil {
+		return Histogram{}, errors.New("no Histogram data provided")
+	}
+	res := Histogram{Bounds: slices.Clone(h.Bounds), Counts: slices.Clone(h.Counts), Sum: h.Sum, Count: h.Count}
+	if len(res.Bounds) == 0 {
+		res.Bounds = slices.Clone(defaultBounds)
+	}
+	return res, res.Validate()
+}
@@ -0,0 +1,159 @@
+package storagecommons
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returns key identifying series of metric `id` with `labels` in substorages.
+// Series without labels are keyed by metric name, otherwise key looks like `name{k1="v1",k2="v2"}`
+func SeriesKey(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(id)
+	sb.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(k)
+		sb.WriteString(`="`)
+		sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(labels[k]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// Splits series key (see SeriesKey) to metric name and labels
+func ParseSeriesKey(key string) (string, map[string]string, error) {
+	pos := strings.IndexByte(key, '{')
+	if pos < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil, nil
+	}
+
+	id := key[:pos]
+	rest := key[pos+1 : len(key)-1]
+	labels := make(map[string]string)
+
+	for len(rest) > 0 {
+		eq := strings.Index(rest, `="`)
+		if eq <= 0 {
+			return key, nil, errors.New("malformed series key: " + key)
+		}
+		name := rest[:eq]
+		rest = rest[eq+2:]
+
+		var (
+			sb     strings.Builder
+			closed bool
+			i      int
+		)
+		for i = 0; i < len(rest); i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				sb.WriteByte(rest[i])
+				continue
+			}
+			if rest[i] == '"' {
+				closed = true
+				break
+			}
+			sb.WriteByte(rest[i])
+		}
+		if !closed {
+			return key, nil, errors.New("malformed series key: " + key)
+		}
+		labels[name] = sb.String()
+
+		rest = rest[i+1:]
+		if len(rest) > 0 {
+			if rest[0] != ',' {
+				return key, nil, errors.New("malformed series key: " + key)
+			}
+			rest = rest[1:]
+		}
+	}
+
+	return id, labels, nil
+}
+
+// Checks if `name` is valid label name (`[a-zA-Z_][a-zA-Z0-9_]*`).
+// Names are written to series keys as is, so they must not contain key syntax characters
+func IsValidLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLabelNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLabelNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// Fails on first label with invalid name (see IsValidLabelName)
+func CheckLabels(labels map[string]string) error {
+	for k := range labels {
+		if !IsValidLabelName(k) {
+			return errors.New("invalid label name " + strconv.Quote(k) + ", [a-zA-Z_][a-zA-Z0-9_]* expected")
+		}
+	}
+	return nil
+}
+
+// Returns label name with characters not allowed in it replaced by `_` (used for tags of third-party protocols)
+func SanitizeLabelName(name string) string {
+	if IsValidLabelName(name) {
+		return name
+	}
+	res := []byte(name)
+	for i := range res {
+		if !isLabelNameChar(res[i], false) {
+			res[i] = '_'
+		}
+	}
+	if len(res) == 0 || (res[0] >= '0' && res[0] <= '9') {
+		res = append([]byte{'_'}, res...)
+	}
+	return string(res)
+}
+
+// Checks if `labels` contain all of `filter` labels with equal values
+func MatchLabels(labels map[string]string, filter map[string]string) bool {
+	for k, v := range filter {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns values of series of metric `id` which labels match `filter` (see MatchLabels)
+func FilterSeries[T any](data map[string]T, id string, filter map[string]string) map[string]T {
+	res := make(map[string]T)
+	for key, val := range data {
+		name, labels, err := ParseSeriesKey(key)
+		if err != nil || name != id || !MatchLabels(labels, filter) {
+			continue
+		}
+		res[key] = val
+	}
+	return res
+}
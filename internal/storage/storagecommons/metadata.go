@@ -0,0 +1,149 @@
+package storagecommons
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JSON serializable structure describing metric name, shared by all its series.
+// Type of metric is locked by its first write
+type MetricMetadata struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Unit      string    `json:"unit,omitempty"`
+	Help      string    `json:"help,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Error of metric write with type other than registered one
+type TypeConflictError struct {
+	Name       string
+	Type       string
+	Registered string
+}
+
+func (e *TypeConflictError) Error() string {
+	return fmt.Sprintf("metric %s is registered as %s, cannot write it as %s", e.Name, e.Registered, e.Type)
+}
+
+// Checks if metric type is supported by storages
+func IsKnownType(mtype string) bool {
+	switch mtype {
+	case "gauge", "counter", "histogram", "summary":
+		return true
+	}
+	return false
+}
+
+// Returns metadata of metric names written by batch (ordered by name) with FirstSeen and LastSeen set to `now`.
+// Fails if batch has metric of unknown type or writes same name as different types
+func BatchMetadata(metrics []Metrics, now time.Time) ([]MetricMetadata, error) {
+	byName := make(map[string]MetricMetadata)
+	for _, m := range metrics {
+		if !IsKnownType(m.MType) {
+			return nil, errors.New("Unknown metric type: " + m.MType)
+		}
+		md, ok := byName[m.ID]
+		if !ok {
+			byName[m.ID] = MetricMetadata{Name: m.ID, Type: m.MType, Unit: m.Unit, Help: m.Help, FirstSeen: now, LastSeen: now}
+			continue
+		}
+		if md.Type != m.MType {
+			return nil, &TypeConflictError{Name: m.ID, Type: m.MType, Registered: md.Type}
+		}
+		md.update(m.Unit, m.Help, now)
+		byName[m.ID] = md
+	}
+
+	res := make([]MetricMetadata, 0, len(byName))
+	for _, md := range byName {
+		res = append(res, md)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Applies unit and help text (if given) and last seen time of write
+func (md *MetricMetadata) update(unit string, help string, seen time.Time) {
+	if unit != "" {
+		md.Unit = unit
+	}
+	if help != "" {
+		md.Help = help
+	}
+	if seen.After(md.LastSeen) {
+		md.LastSeen = seen
+	}
+}
+
+// In-memory metadata registry of storages keeping all data in memory
+type MetadataRegistry struct {
+	mu   sync.RWMutex
+	data map[string]MetricMetadata
+}
+
+func NewMetadataRegistry() *MetadataRegistry {
+	return &MetadataRegistry{data: make(map[string]MetricMetadata)}
+}
+
+// Registers metric name of write or updates registered one, fails if metric is registered with other type
+func (r *MetadataRegistry) Register(m Metrics, now time.Time) error {
+	if !IsKnownType(m.MType) {
+		return errors.New("Unknown metric type: " + m.MType)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	md, ok := r.data[m.ID]
+	if !ok {
+		r.data[m.ID] = MetricMetadata{Name: m.ID, Type: m.MType, Unit: m.Unit, Help: m.Help, FirstSeen: now, LastSeen: now}
+		return nil
+	}
+	if md.Type != m.MType {
+		return &TypeConflictError{Name: m.ID, Type: m.MType, Registered: md.Type}
+	}
+	md.update(m.Unit, m.Help, now)
+	r.data[m.ID] = md
+	return nil
+}
+
+// Sets metadata as is (used while loading data)
+func (r *MetadataRegistry) Set(md MetricMetadata) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[md.Name] = md
+}
+
+// Registers metric name unless it is registered already (used while loading data stored without metadata)
+func (r *MetadataRegistry) Init(m Metrics, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data[m.ID]; !ok {
+		r.data[m.ID] = MetricMetadata{Name: m.ID, Type: m.MType, FirstSeen: now, LastSeen: now}
+	}
+}
+
+// Returns copy of all metadata ordered by name
+func (r *MetadataRegistry) All() []MetricMetadata {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]MetricMetadata, 0, len(r.data))
+	for _, md := range r.data {
+		res = append(res, md)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Drops all metadata
+func (r *MetadataRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data = make(map[string]MetricMetadata)
+}
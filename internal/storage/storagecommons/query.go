@@ -0,0 +1,218 @@
+package storagecommons
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Aggregations of samples within query step
+const (
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggSum  = "sum"
+	AggLast = "last"
+	AggRate = "rate" // Per-second increase of counter value (resets are counted from zero)
+)
+
+// Limit of points per series returned by range query
+const MaxQueryPoints = 11000
+
+// Range query of metric series which labels match Labels (see MatchLabels)
+type RangeQuery struct {
+	Name   string
+	MType  string
+	Labels map[string]string
+	Start  time.Time
+	End    time.Time
+	Step   time.Duration
+	Agg    string
+}
+
+// Value of series aggregated over (Timestamp - step, Timestamp] interval
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Series returned by range query
+type RangeSeries struct {
+	ID     string
+	Labels map[string]string
+	Points []Point
+}
+
+// Checks if aggregation is supported by range queries
+func IsKnownAggregation(agg string) bool {
+	switch agg {
+	case AggAvg, AggMin, AggMax, AggSum, AggLast, AggRate:
+		return true
+	}
+	return false
+}
+
+// Checks range query parameters
+func (q RangeQuery) Validate() error {
+	switch {
+	case q.Name == "":
+		return errors.New("metric name is not set")
+	case !IsKnownType(q.MType):
+		return errors.New("Unknown metric type: " + q.MType)
+	case !IsKnownAggregation(q.Agg):
+		return errors.New("unknown aggregation: " + q.Agg)
+	case q.Step <= 0:
+		return errors.New("step must be positive")
+	case q.End.Before(q.Start):
+		return errors.New("end of range is before its start")
+	case q.End.Sub(q.Start)/q.Step >= MaxQueryPoints:
+		return errors.New("too many points requested, increase step")
+	}
+	return nil
+}
+
+// Returns keys of all stored series of metric type
+func seriesKeys(ctx context.Context, db Storager, mtype string) ([]string, error) {
+	var (
+		keys []string
+		err  error
+	)
+	switch mtype {
+	case "gauge":
+		keys, err = substorageKeys[float64](ctx, db.GetGauges())
+	case "counter":
+		keys, err = substorageKeys[int64](ctx, db.GetCounters())
+	case "histogram":
+		keys, err = substorageKeys[Histogram](ctx, db.GetHistograms())
+	case "summary":
+		keys, err = substorageKeys[Summary](ctx, db.GetSummaries())
+	default:
+		return nil, errors.New("Unknown metric type: " + mtype)
+	}
+	sort.Strings(keys)
+	return keys, err
+}
+
+// Returns keys of all series stored in substorage
+func substorageKeys[T any](ctx context.Context, ss Substorager[T]) ([]string, error) {
+	data, err := ss.ReadData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Returns series of metric matching query labels with samples aggregated by query steps, ordered by series key.
+// Steps without samples are omitted
+func QueryRange(ctx context.Context, db Storager, q RangeQuery) ([]RangeSeries, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	keys, err := seriesKeys(ctx, db, q.MType)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]RangeSeries, 0)
+	for _, key := range keys {
+		id, labels, err := ParseSeriesKey(key)
+		if err != nil || id != q.Name || !MatchLabels(labels, q.Labels) {
+			continue
+		}
+
+		// Rate of first step is counted from last value before it
+		from := q.Start.Add(-q.Step)
+		if q.Agg == AggRate {
+			from = from.Add(-q.Step)
+		}
+		samples, err := db.ReadRange(ctx, q.MType, key, from, q.End)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, RangeSeries{ID: id, Labels: labels, Points: AlignSamples(samples, q.Start, q.End, q.Step, q.Agg)})
+	}
+	return res, nil
+}
+
+// Aggregates time ordered samples (raw or rollups) into points at `start`, `start + step`, ... up to `end`,
+// each one aggregating samples of preceding step. Earlier samples are only used as base of rate
+func AlignSamples(samples []Sample, start time.Time, end time.Time, step time.Duration, agg string) []Point {
+	res := make([]Point, 0)
+
+	i := 0
+	var (
+		prev    float64
+		hasPrev bool
+	)
+	for ; i < len(samples) && !samples[i].Timestamp.After(start.Add(-step)); i++ {
+		prev, hasPrev = samples[i].Value, true
+	}
+
+	for t := start; !t.After(end); t = t.Add(step) {
+		first := i
+		for i < len(samples) && !samples[i].Timestamp.After(t) {
+			i++
+		}
+		if first == i {
+			continue
+		}
+
+		bucket := samples[first:i]
+		res = append(res, Point{Timestamp: t, Value: aggregate(bucket, agg, prev, hasPrev, step)})
+		prev, hasPrev = bucket[len(bucket)-1].Value, true
+	}
+
+	return res
+}
+
+// Returns aggregation of non-empty samples bucket, `prev` is last value before bucket (if `hasPrev`)
+func aggregate(bucket []Sample, agg string, prev float64, hasPrev bool, step time.Duration) float64 {
+	switch agg {
+	case AggLast:
+		return bucket[len(bucket)-1].Value
+	case AggRate:
+		var increase float64
+		if !hasPrev {
+			prev = bucket[0].Value
+		}
+		for _, s := range bucket {
+			if s.Value < prev {
+				increase += s.Value
+			} else {
+				increase += s.Value - prev
+			}
+			prev = s.Value
+		}
+		return increase / step.Seconds()
+	}
+
+	var (
+		min, max = math.Inf(1), math.Inf(-1)
+		sum      float64
+		count    int64
+	)
+	for _, s := range bucket {
+		smin, smax, avg, n := s.aggregates()
+		min = math.Min(min, smin)
+		max = math.Max(max, smax)
+		sum += avg * float64(n)
+		count += n
+	}
+
+	switch agg {
+	case AggMin:
+		return min
+	case AggMax:
+		return max
+	case AggSum:
+		return sum
+	}
+	return sum / float64(count)
+}
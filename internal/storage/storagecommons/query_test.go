@@ -0,0 +1,112 @@
+package storagecommons
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAlignSamples(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	step := 10 * time.Second
+	at := func(d time.Duration, v float64) Sample { return Sample{Timestamp: t0.Add(d), Value: v} }
+	points := func(values ...float64) []Point {
+		// Step (t0 + 10s, t0 + 20s] has no samples, so it is omitted
+		ts := []time.Duration{0, 10 * time.Second, 30 * time.Second}
+		res := make([]Point, len(values))
+		for i, v := range values {
+			res[i] = Point{Timestamp: t0.Add(ts[i]), Value: v}
+		}
+		return res
+	}
+
+	samples := []Sample{
+		at(-15*time.Second, 1), // Before first step, base of rate only
+		at(-5*time.Second, 2),
+		at(0, 4), // Sample at point timestamp belongs to its step
+		at(3*time.Second, 6),
+		at(10*time.Second, 3), // Counter reset
+		at(25*time.Second, 5),
+		at(35*time.Second, 7), // After end
+	}
+
+	tests := []struct {
+		agg  string
+		want []Point
+	}{
+		{agg: AggAvg, want: points(3, 4.5, 5)},
+		{agg: AggMin, want: points(2, 3, 5)},
+		{agg: AggMax, want: points(4, 6, 5)},
+		{agg: AggSum, want: points(6, 9, 5)},
+		{agg: AggLast, want: points(4, 3, 5)},
+		// Increase per second: 1 + 2, 2 + 3 counted from zero after reset, 2
+		{agg: AggRate, want: points(0.3, 0.5, 0.2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			assert.Equal(t, tt.want, AlignSamples(samples, t0, t0.Add(30*time.Second), step, tt.agg))
+		})
+	}
+
+	t.Run("Rate Without Base", func(t *testing.T) {
+		got := AlignSamples(samples[1:], t0, t0, step, AggRate)
+		assert.Equal(t, []Point{{Timestamp: t0, Value: 0.2}}, got)
+	})
+
+	t.Run("No Samples", func(t *testing.T) {
+		assert.Empty(t, AlignSamples(nil, t0, t0.Add(time.Minute), step, AggAvg))
+		assert.Empty(t, AlignSamples(samples[:1], t0, t0.Add(time.Minute), step, AggAvg))
+	})
+
+	t.Run("Rollup Tier Range", func(t *testing.T) {
+		raw := make([]Sample, 0, 18)
+		for i := 0; i < 18; i++ {
+			raw = append(raw, at(time.Duration(i)*step, float64(i)))
+		}
+		// Minute rollups are stamped with bucket start, so point of bucket start aggregates the minute after it
+		rollups := Downsample(raw, time.Minute)
+		minutes := func(values ...float64) []Point {
+			res := make([]Point, len(values))
+			for i, v := range values {
+				res[i] = Point{Timestamp: t0.Add(time.Duration(i) * time.Minute), Value: v}
+			}
+			return res
+		}
+
+		for agg, want := range map[string][]Point{
+			AggAvg:  minutes(2.5, 8.5, 14.5),
+			AggMin:  minutes(0, 6, 12),
+			AggMax:  minutes(5, 11, 17),
+			AggSum:  minutes(15, 51, 87),
+			AggLast: minutes(5, 11, 17),
+		} {
+			assert.Equal(t, want, AlignSamples(rollups, t0, t0.Add(2*time.Minute), time.Minute, agg), agg)
+		}
+	})
+}
+
+func TestAggregate(t *testing.T) {
+	rollups := []Sample{
+		{Value: 5, Min: 1, Max: 9, Avg: 4, Count: 3},
+		{Value: 2, Min: 2, Max: 3, Avg: 2.5, Count: 2},
+		{Value: 6}, // Raw sample counts as single value
+	}
+
+	tests := []struct {
+		agg  string
+		want float64
+	}{
+		{agg: AggAvg, want: 23.0 / 6},
+		{agg: AggMin, want: 1},
+		{agg: AggMax, want: 9},
+		{agg: AggSum, want: 23},
+		{agg: AggLast, want: 6},
+		// Increase from base 4: 1, 2 after reset, 4
+		{agg: AggRate, want: 0.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			assert.InDelta(t, tt.want, aggregate(rollups, tt.agg, 4, true, 10*time.Second), 1e-9)
+		})
+	}
+}
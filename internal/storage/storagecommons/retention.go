@@ -0,0 +1,84 @@
+package storagecommons
+
+import (
+	"math"
+	"time"
+)
+
+// Samples storage tier: raw samples (Step == 0) or rollups of Step duration, kept for Keep duration (0 - forever)
+type RetentionTier struct {
+	Step time.Duration
+	Keep time.Duration
+}
+
+// Returns history retention tiers: raw samples followed by minute and hour rollups
+func NewRetentionTiers(raw time.Duration, minute time.Duration, hour time.Duration) []RetentionTier {
+	return []RetentionTier{
+		{Step: 0, Keep: raw},
+		{Step: time.Minute, Keep: minute},
+		{Step: time.Hour, Keep: hour},
+	}
+}
+
+// Returns index of the finest tier still holding samples written at `from`
+func SelectTier(tiers []RetentionTier, from time.Time, now time.Time) int {
+	for i, t := range tiers {
+		if t.Keep == 0 || !from.Before(now.Add(-t.Keep)) {
+			return i
+		}
+	}
+	return len(tiers) - 1
+}
+
+// Returns min, max, avg and number of raw samples described by sample
+func (s Sample) aggregates() (min float64, max float64, avg float64, count int64) {
+	if s.Count == 0 {
+		return s.Value, s.Value, s.Value, 1
+	}
+	return s.Min, s.Max, s.Avg, s.Count
+}
+
+// Aggregates time ordered samples (raw or rollups) into rollups of `step` duration.
+// Rollup timestamp is the start of its bucket, Value holds the last value in bucket
+func Downsample(samples []Sample, step time.Duration) []Sample {
+	res := make([]Sample, 0)
+	var (
+		cur Sample
+		sum float64
+	)
+
+	for i, s := range samples {
+		bucket := s.Timestamp.Truncate(step)
+		if i == 0 || !bucket.Equal(cur.Timestamp) {
+			if i > 0 {
+				cur.Avg = sum / float64(cur.Count)
+				res = append(res, cur)
+			}
+			cur = Sample{Timestamp: bucket, Min: math.Inf(1), Max: math.Inf(-1)}
+			sum = 0
+		}
+		min, max, avg, count := s.aggregates()
+		cur.Min = math.Min(cur.Min, min)
+		cur.Max = math.Max(cur.Max, max)
+		cur.Count += count
+		cur.Value = s.Value
+		sum += avg * float64(count)
+	}
+
+	if len(samples) > 0 {
+		cur.Avg = sum / float64(cur.Count)
+		res = append(res, cur)
+	}
+
+	return res
+}
+
+// Returns part of time ordered samples slice written not before `cutoff`
+func ExpireSamples(samples []Sample, cutoff time.Time) []Sample {
+	for i, s := range samples {
+		if !s.Timestamp.Before(cutoff) {
+			return samples[i:]
+		}
+	}
+	return samples[:0]
+}
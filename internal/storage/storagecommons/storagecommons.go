@@ -1,6 +1,20 @@
 package storagecommons
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Error of reading or deleting not existing series
+var ErrNotExists = errors.New("not exists")
+
+// Returns error of not existing series of type `mtype` with key `key` (wraps ErrNotExists)
+func NotExistsError(mtype string, key string) error {
+	return fmt.Errorf("Key %s/%s %w", mtype, key, ErrNotExists)
+}
 
 type Substorager[T any] interface {
 	// Read substorage values for `keys` keys (if `keys` empty, returns all stored values)
@@ -9,6 +23,8 @@ type Substorager[T any] interface {
 	WriteData(ctx context.Context, key string, value string) error
 	// Wrire data (value is pre-parsed)
 	WriteDataPP(ctx context.Context, key string, value T) error
+	// Read stored samples of `key` within [from, to] time range, ordered by time
+	ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]Sample, error)
 }
 
 // Gauge storage interface
@@ -21,6 +37,16 @@ type StoragerInt64Sum interface {
 	Substorager[int64]
 }
 
+// Histogram storage interface
+type StoragerHistogram interface {
+	Substorager[Histogram]
+}
+
+// Summary storage interface
+type StoragerSummary interface {
+	Substorager[Summary]
+}
+
 // Whole storage interface
 type Storager interface {
 	// Store data to power independed storage
@@ -35,23 +61,96 @@ type Storager interface {
 	WriteData(ctx context.Context, metrics Metrics) (Metrics, error)
 	// Returns JSON serializable structure with requested metric data
 	ReadData(ctx context.Context, metrics Metrics) (Metrics, error)
+	// Returns samples of requested metric series (`id` is series key, see SeriesKey) written within [from, to] time range
+	ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]Sample, error)
+	// Drops requested metric series with its history
+	Delete(ctx context.Context, metrics Metrics) error
 	// Returns Gauges sub-storage object
 	GetGauges() StoragerFloat64
 	// Returns Counters sub-storage object
 	GetCounters() StoragerInt64Sum
+	// Returns Histograms sub-storage object
+	GetHistograms() StoragerHistogram
+	// Returns Summaries sub-storage object
+	GetSummaries() StoragerSummary
+	// Returns metadata of all written metric names, ordered by name
+	GetMetadata(ctx context.Context) ([]MetricMetadata, error)
 	// Check if storage is up
 	Ping(ctx context.Context) error
 }
 
+// Storage able to export and replace all its data (of tenant the call context is scoped to)
+type Snapshotter interface {
+	// Returns copy of all data with history
+	Snapshot(ctx context.Context) (MetricsDB, error)
+	// Replaces all data with snapshot one
+	Restore(ctx context.Context, mdb MetricsDB) error
+}
+
+// Storage able to count stored series without reading their values
+type SeriesCounter interface {
+	// Returns number of stored series by metric type
+	SeriesCount(ctx context.Context) (map[string]int, error)
+}
+
 // JSON serializable structure describing single metric
 type Metrics struct {
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
+	Delta      *int64            `json:"delta,omitempty"`      // значение метрики в случае передачи counter
+	Value      *float64          `json:"value,omitempty"`      // значение метрики в случае передачи gauge
+	Histogram  *Histogram        `json:"histogram,omitempty"`  // значение метрики в случае передачи histogram
+	Summary    *Summary          `json:"summary,omitempty"`    // значение метрики в случае передачи summary
+	ID         string            `json:"id"`                   // имя метрики
+	MType      string            `json:"type"`                 // параметр, принимающий значение gauge, counter, histogram или summary
+	Labels     map[string]string `json:"labels,omitempty"`     // метки, вместе с именем идентифицирующие серию
+	TTL        *int64            `json:"ttl,omitempty"`        // время жизни серии без обновлений, с (0 - глобальное значение)
+	Unit       string            `json:"unit,omitempty"`       // единица измерения метрики (сохраняется в метаданных)
+	Help       string            `json:"help,omitempty"`       // описание метрики (сохраняется в метаданных)
+	Cumulative bool              `json:"cumulative,omitempty"` // Delta counter содержит накопленное значение источника, прирост вычисляет сервер
+	Source     string            `json:"source,omitempty"`     // источник накопленного значения counter
+}
+
+// Returns key of metric series in substorages (see SeriesKey)
+func (m Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
 }
 
 // JSON serializable structure describing batch of metrics
 type MetricsDB struct {
-	MetricsDB []Metrics `json:"metrics_db"`
+	MetricsDB []Metrics        `json:"metrics_db"`
+	History   []MetricHistory  `json:"history,omitempty"`
+	Metadata  []MetricMetadata `json:"metadata,omitempty"`
+	Sources   []CounterSource  `json:"sources,omitempty"` // Last values of cumulative counters
+	WALSeq    uint64           `json:"wal_seq,omitempty"` // Last write-ahead log record included into snapshot
+}
+
+// Timestamped value of metric (for counters it is accumulated value after write).
+// Rollup samples have non-zero Count and hold last value of their bucket in Value
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Min       float64   `json:"min,omitempty"`
+	Max       float64   `json:"max,omitempty"`
+	Avg       float64   `json:"avg,omitempty"`
+	Count     int64     `json:"count,omitempty"`
+}
+
+// JSON serializable structure describing stored samples of single metric
+type MetricHistory struct {
+	ID      string            `json:"id"`
+	MType   string            `json:"type"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Step    time.Duration     `json:"step,omitempty"` // Rollup step (0 for raw samples)
+	Samples []Sample          `json:"samples"`
+}
+
+// Returns part of time ordered `samples` slice lying within [from, to] time range
+func SamplesInRange(samples []Sample, from time.Time, to time.Time) []Sample {
+	start := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(from) })
+	end := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(to) })
+	if start >= end {
+		return []Sample{}
+	}
+	res := make([]Sample, end-start)
+	copy(res, samples[start:end])
+	return res
 }
@@ -0,0 +1,189 @@
+package storagecommons
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"sort"
+)
+
+// Values closer to zero than this are counted as zeros
+const summaryMinIndexable = 1e-9
+
+// JSON serializable mergeable quantile sketch (DDSketch).
+// Observation v > 0 is counted in Positive[i] where i = ceil(log(v)/log(gamma)), gamma = (1+Alpha)/(1-Alpha),
+// negative observations are counted the same way by absolute value in Negative.
+// Quantiles are estimated with relative error not exceeding Alpha
+type Summary struct {
+	Alpha    float64         `json:"alpha"`
+	Positive map[int32]int64 `json:"positive,omitempty"`
+	Negative map[int32]int64 `json:"negative,omitempty"`
+	Zero     int64           `json:"zero,omitempty"`
+	Sum      float64         `json:"sum"`
+	Count    int64           `json:"count"`
+	Min      float64         `json:"min"`
+	Max      float64         `json:"max"`
+}
+
+// Returns empty sketch with given relative accuracy
+func NewSummary(alpha float64) Summary {
+	return Summary{Alpha: alpha, Positive: make(map[int32]int64), Negative: make(map[int32]int64)}
+}
+
+func (s Summary) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+func (s Summary) index(v float64) int32 {
+	return int32(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+func (s Summary) value(i int32) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Adds single observation
+func (s *Summary) Observe(v float64) {
+	switch {
+	case v > summaryMinIndexable:
+		if s.Positive == nil {
+			s.Positive = make(map[int32]int64)
+		}
+		s.Positive[s.index(v)]++
+	case v < -summaryMinIndexable:
+		if s.Negative == nil {
+			s.Negative = make(map[int32]int64)
+		}
+		s.Negative[s.index(-v)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+// Checks sketch consistency
+func (s Summary) Validate() error {
+	if s.Alpha <= 0 || s.Alpha >= 1 {
+		return errors.New("summary accuracy must be within (0, 1)")
+	}
+	total := s.Zero
+	if s.Zero < 0 {
+		return errors.New("summary bucket counts must not be negative")
+	}
+	for _, bins := range []map[int32]int64{s.Positive, s.Negative} {
+		for _, c := range bins {
+			if c < 0 {
+				return errors.New("summary bucket counts must not be negative")
+			}
+			total += c
+		}
+	}
+	if total != s.Count {
+		return errors.New("summary count does not match bucket counts")
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return errors.New("summary min is greater than max")
+	}
+	return nil
+}
+
+// Adds buckets, sum and count of other sketch with same accuracy
+func (s *Summary) Merge(o Summary) error {
+	if s.Alpha != o.Alpha {
+		return errors.New("summary accuracy mismatch")
+	}
+	if o.Count == 0 {
+		return nil
+	}
+
+	pos, neg := make(map[int32]int64, len(s.Positive)), make(map[int32]int64, len(s.Negative))
+	maps.Copy(pos, s.Positive)
+	maps.Copy(neg, s.Negative)
+	for i, c := range o.Positive {
+		pos[i] += c
+	}
+	for i, c := range o.Negative {
+		neg[i] += c
+	}
+	s.Positive, s.Negative = pos, neg
+
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Zero += o.Zero
+	s.Sum += o.Sum
+	s.Count += o.Count
+	return nil
+}
+
+// Returns estimation of q-quantile (0 <= q <= 1) of observed values
+func (s Summary) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 || math.IsNaN(q) {
+		return 0, errors.New("quantile must be within [0, 1]")
+	}
+	if s.Count == 0 {
+		return 0, errors.New("summary is empty")
+	}
+
+	// Buckets in ascending order of values: negatives by descending index, zeros, positives by ascending index
+	type bin struct {
+		value float64
+		count int64
+	}
+	bins := make([]bin, 0, len(s.Negative)+len(s.Positive)+1)
+	neg := sortedIndexes(s.Negative)
+	for i := len(neg) - 1; i >= 0; i-- {
+		bins = append(bins, bin{-s.value(neg[i]), s.Negative[neg[i]]})
+	}
+	bins = append(bins, bin{0, s.Zero})
+	for _, i := range sortedIndexes(s.Positive) {
+		bins = append(bins, bin{s.value(i), s.Positive[i]})
+	}
+
+	rank := int64(q * float64(s.Count-1))
+	res := s.Max
+	var seen int64
+	for _, b := range bins {
+		seen += b.count
+		if seen > rank {
+			res = b.value
+			break
+		}
+	}
+
+	return math.Max(s.Min, math.Min(s.Max, res)), nil
+}
+
+func sortedIndexes(bins map[int32]int64) []int32 {
+	res := make([]int32, 0, len(bins))
+	for i := range bins {
+		res = append(res, i)
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a] < res[b] })
+	return res
+}
+
+// Returns validated copy of written sketch, zero accuracy is replaced with `defaultAlpha`
+func PrepareSummary(s *Summary, defaultAlpha float64) (Summary, error) {
+	if s == nil {
+		return Summary{}, errors.New("no Summary data provided")
+	}
+	res := *s
+	res.Positive = maps.Clone(s.Positive)
+	res.Negative = maps.Clone(s.Negative)
+	if res.Alpha == 0 {
+		res.Alpha = defaultAlpha
+	}
+	return res, res.Validate()
+}
@@ -0,0 +1,42 @@
+package storagecommons
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+)
+
+// Name of tenant owning series which are written without tenant provided
+const DefaultTenant = ""
+
+type tenantCtxKey struct{}
+
+var tenantNameRe = regexp.MustCompile(`^[a-z0-9_]{1,48}$`)
+
+// Checks if tenant name is valid (it is used as part of file paths and DB schema names)
+func ValidateTenant(tenant string) error {
+	if tenant == DefaultTenant || tenantNameRe.MatchString(tenant) {
+		return nil
+	}
+	return errors.New("tenant name must consist of 1-48 lowercase latin letters, digits or underscores")
+}
+
+// Returns context scoping storage calls to `tenant` data
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// Returns tenant which data storage call is scoped to (DefaultTenant if not set)
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantCtxKey{}).(string)
+	return tenant
+}
+
+// Returns name of `tenant` data file placed next to `fileName` of default tenant data
+func TenantFileName(fileName string, tenant string) string {
+	if tenant == DefaultTenant || fileName == "" {
+		return fileName
+	}
+	return filepath.Join(filepath.Dir(fileName), "tenants", tenant, filepath.Base(fileName))
+}
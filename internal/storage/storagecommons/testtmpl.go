@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func PerformStoragerTest(t *testing.T, db Storager) {
@@ -89,4 +90,312 @@ func PerformStoragerTest(t *testing.T, db Storager) {
 		_, err := db.ReadData(ctx, m)
 		assert.Error(t, err)
 	})
+
+	t.Run("Read Counter History", func(t *testing.T) {
+		smp, err := db.ReadRange(ctx, "counter", "cm1", time.Now().Add(-time.Minute), time.Now())
+		assert.NoError(t, err)
+		if assert.Len(t, smp, 1) {
+			assert.Equal(t, float64(1), smp[0].Value)
+		}
+	})
+
+	t.Run("Read Gauge History", func(t *testing.T) {
+		smp, err := db.ReadRange(ctx, "gauge", "gm1", time.Now().Add(-time.Minute), time.Now())
+		assert.NoError(t, err)
+		if assert.Len(t, smp, 1) {
+			assert.Equal(t, 6.6, smp[0].Value)
+		}
+	})
+
+	t.Run("Read History Out Of Range", func(t *testing.T) {
+		smp, err := db.ReadRange(ctx, "gauge", "gm1", time.Now().Add(-2*time.Minute), time.Now().Add(-time.Minute))
+		assert.NoError(t, err)
+		assert.Empty(t, smp)
+	})
+
+	t.Run("Write Metric As Other Type", func(t *testing.T) {
+		var v = 1.5
+		_, err := db.WriteData(ctx, Metrics{ID: "cm1", MType: "gauge", Value: &v})
+		var conflict *TypeConflictError
+		if assert.ErrorAs(t, err, &conflict) {
+			assert.Equal(t, "counter", conflict.Registered)
+		}
+		_, err = db.ReadData(ctx, Metrics{ID: "cm1", MType: "gauge"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Write Batch With Type Conflict", func(t *testing.T) {
+		var v = 1.5
+		var d int64 = 1
+		err := db.WriteDataMulti(ctx, MetricsDB{MetricsDB: []Metrics{
+			{ID: "mixed", MType: "gauge", Value: &v},
+			{ID: "mixed", MType: "counter", Delta: &d},
+		}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Update Metadata", func(t *testing.T) {
+		var d int64 = 1
+		_, err := db.WriteData(ctx, Metrics{ID: "cm2", MType: "counter", Delta: &d, Unit: "requests", Help: "Handled requests"})
+		assert.NoError(t, err)
+		_, err = db.WriteData(ctx, Metrics{ID: "cm2", MType: "counter", Delta: &d})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Read Metadata", func(t *testing.T) {
+		data, err := db.GetMetadata(ctx)
+		assert.NoError(t, err)
+		byName := make(map[string]MetricMetadata)
+		for _, md := range data {
+			byName[md.Name] = md
+		}
+		assert.Equal(t, "gauge", byName["gm1"].Type)
+		assert.Equal(t, "counter", byName["cm1"].Type)
+		if assert.Contains(t, byName, "cm2") {
+			md := byName["cm2"]
+			assert.Equal(t, "counter", md.Type)
+			assert.Equal(t, "requests", md.Unit)
+			assert.Equal(t, "Handled requests", md.Help)
+			assert.False(t, md.LastSeen.Before(md.FirstSeen))
+		}
+	})
+
+	t.Run("Read Counter Value After Metadata Update", func(t *testing.T) {
+		data, err := db.ReadData(ctx, Metrics{ID: "cm2", MType: "counter"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(2), *data.Delta)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		source string
+		values []int64
+		want   int64
+	}{
+		{"Write Cumulative Counter", "a", []int64{5}, 5},
+		{"Write Same Cumulative Value", "a", []int64{5}, 5},
+		{"Write Grown Cumulative Value", "a", []int64{8}, 8},
+		{"Write Cumulative Value After Reset", "a", []int64{2}, 10},
+		{"Write Cumulative Value Of Other Source", "b", []int64{4}, 14},
+		{"Write Cumulative Batch", "a", []int64{3, 6}, 18},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			batch := MetricsDB{}
+			for _, v := range tc.values {
+				v := v
+				batch.MetricsDB = append(batch.MetricsDB, Metrics{ID: "cc1", MType: "counter", Delta: &v, Cumulative: true, Source: tc.source})
+			}
+			assert.NoError(t, db.WriteDataMulti(ctx, batch))
+			data, err := db.ReadData(ctx, Metrics{ID: "cc1", MType: "counter"})
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.want, *data.Delta)
+			}
+		})
+	}
+
+	t.Run("Query Range Of Cumulative Counter", func(t *testing.T) {
+		now := time.Now()
+		series, err := QueryRange(ctx, db, RangeQuery{Name: "cc1", MType: "counter", Start: now, End: now, Step: time.Minute, Agg: AggLast})
+		if assert.NoError(t, err) && assert.Len(t, series, 1) && assert.Len(t, series[0].Points, 1) {
+			assert.Equal(t, float64(18), series[0].Points[0].Value)
+		}
+		series, err = QueryRange(ctx, db, RangeQuery{Name: "cc1", MType: "counter", Start: now, End: now, Step: time.Minute, Agg: AggRate})
+		if assert.NoError(t, err) && assert.Len(t, series, 1) && assert.Len(t, series[0].Points, 1) {
+			assert.Greater(t, series[0].Points[0].Value, float64(0))
+		}
+	})
+
+	t.Run("Query Range With Unknown Aggregation", func(t *testing.T) {
+		_, err := QueryRange(ctx, db, RangeQuery{Name: "cc1", MType: "counter", Start: time.Now(), End: time.Now(), Step: time.Minute, Agg: "median"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Write Cumulative Gauge", func(t *testing.T) {
+		var v = 1.5
+		_, err := db.WriteData(ctx, Metrics{ID: "gm1", MType: "gauge", Value: &v, Cumulative: true, Source: "a"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Write Negative Cumulative Value", func(t *testing.T) {
+		var d int64 = -1
+		_, err := db.WriteData(ctx, Metrics{ID: "cc1", MType: "counter", Delta: &d, Cumulative: true, Source: "a"})
+		assert.Error(t, err)
+	})
+
+	var fa, fb = 1.5, 2.5
+	t.Run("Write Labeled Gauges", func(t *testing.T) {
+		err := db.WriteDataMulti(ctx, MetricsDB{MetricsDB: []Metrics{
+			{ID: "lg1", MType: "gauge", Value: &fa, Labels: map[string]string{"host": "a"}},
+			{ID: "lg1", MType: "gauge", Value: &fb, Labels: map[string]string{"host": "b", "dc": "x"}},
+		}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Read Labeled Gauges", func(t *testing.T) {
+		data, err := db.ReadData(ctx, Metrics{ID: "lg1", MType: "gauge", Labels: map[string]string{"host": "a"}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, fa, *data.Value)
+		}
+		data, err = db.ReadData(ctx, Metrics{ID: "lg1", MType: "gauge", Labels: map[string]string{"dc": "x", "host": "b"}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, fb, *data.Value)
+		}
+	})
+
+	t.Run("Query Range Of Labeled Gauges", func(t *testing.T) {
+		now := time.Now()
+		series, err := QueryRange(ctx, db, RangeQuery{Name: "lg1", MType: "gauge", Labels: map[string]string{"host": "a"}, Start: now.Add(-time.Minute), End: now, Step: time.Minute, Agg: AggAvg})
+		if assert.NoError(t, err) && assert.Len(t, series, 1) {
+			assert.Equal(t, map[string]string{"host": "a"}, series[0].Labels)
+			if assert.Len(t, series[0].Points, 1) {
+				assert.Equal(t, fa, series[0].Points[0].Value)
+				assert.True(t, series[0].Points[0].Timestamp.Equal(now))
+			}
+		}
+		series, err = QueryRange(ctx, db, RangeQuery{Name: "lg1", MType: "gauge", Start: now, End: now, Step: time.Minute, Agg: AggMax})
+		assert.NoError(t, err)
+		assert.Len(t, series, 2)
+	})
+
+	t.Run("Read Unlabeled Series Of Labeled Gauge", func(t *testing.T) {
+		_, err := db.ReadData(ctx, Metrics{ID: "lg1", MType: "gauge"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Filter Labeled Gauges", func(t *testing.T) {
+		data, err := db.GetGauges().ReadData(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, FilterSeries(data, "lg1", nil), 2)
+		assert.Equal(t, map[string]float64{`lg1{dc="x",host="b"}`: fb}, FilterSeries(data, "lg1", map[string]string{"host": "b"}))
+	})
+
+	h1 := NewHistogram([]float64{1, 10})
+	h1.Observe(0.5)
+	h1.Observe(5)
+	h2 := NewHistogram([]float64{1, 10})
+	h2.Observe(20)
+	t.Run("Write Histograms", func(t *testing.T) {
+		err := db.WriteDataMulti(ctx, MetricsDB{MetricsDB: []Metrics{
+			{ID: "hm1", MType: "histogram", Histogram: &h1},
+			{ID: "hm1", MType: "histogram", Histogram: &h2},
+		}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Check Histogram Value", func(t *testing.T) {
+		data, err := db.ReadData(ctx, Metrics{ID: "hm1", MType: "histogram"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int64{1, 1, 1}, data.Histogram.Counts)
+			assert.Equal(t, int64(3), data.Histogram.Count)
+			assert.Equal(t, 25.5, data.Histogram.Sum)
+		}
+	})
+
+	t.Run("Write Histogram With Other Bounds", func(t *testing.T) {
+		h := NewHistogram([]float64{2})
+		_, err := db.WriteData(ctx, Metrics{ID: "hm1", MType: "histogram", Histogram: &h})
+		assert.Error(t, err)
+	})
+
+	t.Run("Write Inconsistent Histogram", func(t *testing.T) {
+		h := Histogram{Bounds: []float64{1}, Counts: []int64{1, 1}, Count: 1}
+		_, err := db.WriteData(ctx, Metrics{ID: "hm2", MType: "histogram", Histogram: &h})
+		assert.Error(t, err)
+	})
+
+	t.Run("Read Histogram History", func(t *testing.T) {
+		smp, err := db.ReadRange(ctx, "histogram", "hm1", time.Now().Add(-time.Minute), time.Now())
+		assert.NoError(t, err)
+		if assert.NotEmpty(t, smp) {
+			assert.Equal(t, float64(3), smp[len(smp)-1].Value)
+		}
+	})
+
+	s1, s2 := NewSummary(0.01), NewSummary(0.01)
+	for v := 1; v <= 1000; v++ {
+		if v%2 == 0 {
+			s1.Observe(float64(v))
+		} else {
+			s2.Observe(float64(v))
+		}
+	}
+	t.Run("Write Summaries", func(t *testing.T) {
+		err := db.WriteDataMulti(ctx, MetricsDB{MetricsDB: []Metrics{
+			{ID: "sm1", MType: "summary", Summary: &s1},
+			{ID: "sm1", MType: "summary", Summary: &s2},
+		}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Check Summary Quantiles", func(t *testing.T) {
+		data, err := db.ReadData(ctx, Metrics{ID: "sm1", MType: "summary"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(1000), data.Summary.Count)
+			q, err := data.Summary.Quantile(0.99)
+			assert.NoError(t, err)
+			assert.InEpsilon(t, 990, q, 0.01)
+			q, err = data.Summary.Quantile(0.5)
+			assert.NoError(t, err)
+			assert.InEpsilon(t, 500, q, 0.01)
+			q, err = data.Summary.Quantile(1)
+			assert.NoError(t, err)
+			assert.Equal(t, float64(1000), q)
+		}
+	})
+
+	t.Run("Write Summary With Other Accuracy", func(t *testing.T) {
+		sm := NewSummary(0.05)
+		sm.Observe(1)
+		_, err := db.WriteData(ctx, Metrics{ID: "sm1", MType: "summary", Summary: &sm})
+		assert.Error(t, err)
+	})
+
+	t.Run("Delete Gauge", func(t *testing.T) {
+		err := db.Delete(ctx, Metrics{ID: "gm1", MType: "gauge"})
+		assert.NoError(t, err)
+		_, err = db.ReadData(ctx, Metrics{ID: "gm1", MType: "gauge"})
+		assert.Error(t, err)
+		smp, err := db.ReadRange(ctx, "gauge", "gm1", time.Now().Add(-time.Minute), time.Now())
+		assert.NoError(t, err)
+		assert.Empty(t, smp)
+	})
+
+	t.Run("Delete Labeled Gauge Keeps Other Series", func(t *testing.T) {
+		err := db.Delete(ctx, Metrics{ID: "lg1", MType: "gauge", Labels: map[string]string{"host": "a"}})
+		assert.NoError(t, err)
+		data, err := db.ReadData(ctx, Metrics{ID: "lg1", MType: "gauge", Labels: map[string]string{"dc": "x", "host": "b"}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, fb, *data.Value)
+		}
+	})
+
+	t.Run("Series Count", func(t *testing.T) {
+		sc, ok := db.(SeriesCounter)
+		if !ok {
+			t.Skip("storage does not count series")
+		}
+		counts, err := sc.SeriesCount(ctx)
+		assert.NoError(t, err)
+		gauges, _ := db.GetGauges().ReadData(ctx)
+		counters, _ := db.GetCounters().ReadData(ctx)
+		histograms, _ := db.GetHistograms().ReadData(ctx)
+		summaries, _ := db.GetSummaries().ReadData(ctx)
+		assert.Equal(t, map[string]int{"gauge": len(gauges), "counter": len(counters), "histogram": len(histograms), "summary": len(summaries)}, counts)
+	})
+
+	t.Run("Delete Not Existing Metric", func(t *testing.T) {
+		err := db.Delete(ctx, Metrics{ID: "gm1", MType: "gauge"})
+		assert.ErrorIs(t, err, ErrNotExists)
+	})
+
+	t.Run("Delete Metric Of Unknown Type", func(t *testing.T) {
+		err := db.Delete(ctx, Metrics{ID: "cm1", MType: "countter"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Read History Of Unknown Type", func(t *testing.T) {
+		_, err := db.ReadRange(ctx, "countter", "cm1", time.Now().Add(-time.Minute), time.Now())
+		assert.Error(t, err)
+	})
 }
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/boltstore"
+	"yaprakticum-go-track2/internal/storage/dbstore"
+	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/storage/tieredstore"
+)
+
+// Storager routing each call to data of tenant the call context is scoped to (see storagecommons.WithTenant).
+// Every tenant has its own storage (separate file or DB schema), created on first access.
+// Dump, Load and Close apply to storages of all tenants
+type tenantStorage struct {
+	ctx     context.Context
+	args    config.ServerConfig
+	logger  *zap.Logger
+	mu      sync.RWMutex
+	tenants map[string]storagecommons.Storager
+}
+
+func newTenantStorage(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*tenantStorage, error) {
+	ts := &tenantStorage{ctx: ctx, args: args, logger: logger, tenants: make(map[string]storagecommons.Storager)}
+
+	def, err := newStorager(ctx, args, logger)
+	if err != nil {
+		return nil, err
+	}
+	ts.tenants[storagecommons.DefaultTenant] = def
+
+	return ts, nil
+}
+
+// Creates instrumented storage of backend selected by configuration
+func newStorager(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (storagecommons.Storager, error) {
+	var (
+		s       storagecommons.Storager
+		backend string
+		err     error
+	)
+	if args.ConnString == "" || args.ConnString == "$test$" {
+		s, _ = filestore.New(ctx, args, logger)
+		backend = "memory"
+	} else if boltstore.IsBoltDSN(args.ConnString) {
+		s, err = boltstore.New(ctx, args, logger)
+		backend = "bolt"
+	} else if args.TieredFlushInterval > 0 {
+		s, err = tieredstore.New(ctx, args, logger)
+		backend = "tiered"
+	} else {
+		s, _ = dbstore.New(ctx, args, logger)
+		backend = "postgres"
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newInstrumentedStorage(s, backend), nil
+}
+
+// Returns number of stored series by tenant and metric type.
+// Storages are counted after the lock is released, so slow count doesn't block creation of tenants
+func (ts *tenantStorage) seriesCount() map[[2]string]int {
+	ts.mu.RLock()
+	tenants := maps.Clone(ts.tenants)
+	ts.mu.RUnlock()
+
+	res := make(map[[2]string]int)
+	for tenant, s := range tenants {
+		// Scrapes are not counted as storage reads
+		if is, ok := s.(*instrumentedStorage); ok {
+			s = is.Storager
+		}
+		sc, ok := s.(storagecommons.SeriesCounter)
+		if !ok {
+			continue
+		}
+		counts, err := sc.SeriesCount(ts.ctx)
+		if err != nil {
+			continue
+		}
+		for mtype, n := range counts {
+			res[[2]string{tenant, mtype}] = n
+		}
+	}
+	return res
+}
+
+// Returns true if storage backend supports snapshots (see storagecommons.Snapshotter)
+func (ts *tenantStorage) snapshots() bool {
+	ts.mu.RLock()
+	s := ts.tenants[storagecommons.DefaultTenant]
+	ts.mu.RUnlock()
+
+	// Instrumented storage forwards snapshots to backend if it supports them
+	if is, ok := s.(*instrumentedStorage); ok {
+		s = is.Storager
+	}
+	_, ok := s.(storagecommons.Snapshotter)
+	return ok
+}
+
+// Returns configuration of `tenant` storage
+func (ts *tenantStorage) tenantConfig(tenant string) (config.ServerConfig, error) {
+	args := ts.args
+	var err error
+
+	if args.ConnString == "" || args.ConnString == "$test$" {
+		args.FileStoragePath = storagecommons.TenantFileName(args.FileStoragePath, tenant)
+		if args.FileStoragePath != "" {
+			err = os.MkdirAll(filepath.Dir(args.FileStoragePath), 0700)
+		}
+	} else if boltstore.IsBoltDSN(args.ConnString) {
+		args.ConnString, err = boltstore.TenantDSN(args.ConnString, tenant)
+	} else {
+		args.ConnString, err = dbstore.TenantDSN(ts.ctx, args.ConnString, tenant)
+	}
+
+	return args, err
+}
+
+// Returns storage of tenant the context is scoped to
+func (ts *tenantStorage) storage(ctx context.Context) (storagecommons.Storager, error) {
+	tenant := storagecommons.TenantFromContext(ctx)
+
+	ts.mu.RLock()
+	s, ok := ts.tenants[tenant]
+	ts.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	err := storagecommons.ValidateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if s, ok := ts.tenants[tenant]; ok {
+		return s, nil
+	}
+
+	args, err := ts.tenantConfig(tenant)
+	if err != nil {
+		return nil, err
+	}
+	ts.logger.Sugar().Infof("Creating storage of tenant %s...", tenant)
+	s, err = newStorager(ts.ctx, args, ts.logger)
+	if err != nil {
+		return nil, err
+	}
+	ts.tenants[tenant] = s
+
+	return s, nil
+}
+
+// Calls `f` for storages of all tenants, returns joined errors
+func (ts *tenantStorage) forAll(f func(s storagecommons.Storager) error) error {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var errs []error
+	for _, s := range ts.tenants {
+		errs = append(errs, f(s))
+	}
+	return errors.Join(errs...)
+}
+
+// Returns tenants having storage opened or (for file storage) stored on disc
+func (ts *tenantStorage) Tenants() []string {
+	ts.mu.RLock()
+	res := make([]string, 0, len(ts.tenants))
+	for tenant := range ts.tenants {
+		res = append(res, tenant)
+	}
+	ts.mu.RUnlock()
+
+	if (ts.args.ConnString == "" || ts.args.ConnString == "$test$") && ts.args.FileStoragePath != "" {
+		entries, _ := os.ReadDir(filepath.Join(filepath.Dir(ts.args.FileStoragePath), "tenants"))
+		for _, e := range entries {
+			if e.IsDir() && storagecommons.ValidateTenant(e.Name()) == nil && !slices.Contains(res, e.Name()) {
+				res = append(res, e.Name())
+			}
+		}
+	}
+
+	slices.Sort(res)
+	return res
+}
+
+func (ts *tenantStorage) Dump(ctx context.Context) error {
+	return ts.forAll(func(s storagecommons.Storager) error { return s.Dump(ctx) })
+}
+
+func (ts *tenantStorage) Load(ctx context.Context) error {
+	return ts.forAll(func(s storagecommons.Storager) error { return s.Load(ctx) })
+}
+
+func (ts *tenantStorage) Close(ctx context.Context) error {
+	return ts.forAll(func(s storagecommons.Storager) error { return s.Close(ctx) })
+}
+
+// Label names are checked here, as backends write them to series keys as is
+func (ts *tenantStorage) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics.MetricsDB {
+		if err := storagecommons.CheckLabels(m.Labels); err != nil {
+			return err
+		}
+	}
+	for _, h := range metrics.History {
+		if err := storagecommons.CheckLabels(h.Labels); err != nil {
+			return err
+		}
+	}
+	return s.WriteDataMulti(ctx, metrics)
+}
+
+func (ts *tenantStorage) WriteData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return metrics, err
+	}
+	if err := storagecommons.CheckLabels(metrics.Labels); err != nil {
+		return metrics, err
+	}
+	return s.WriteData(ctx, metrics)
+}
+
+func (ts *tenantStorage) ReadData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return metrics, err
+	}
+	return s.ReadData(ctx, metrics)
+}
+
+func (ts *tenantStorage) ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.ReadRange(ctx, mtype, id, from, to)
+}
+
+func (ts *tenantStorage) Delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, metrics)
+}
+
+func (ts *tenantStorage) GetMetadata(ctx context.Context) ([]storagecommons.MetricMetadata, error) {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMetadata(ctx)
+}
+
+func (ts *tenantStorage) Ping(ctx context.Context) error {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Ping(ctx)
+}
+
+func (ts *tenantStorage) Snapshot(ctx context.Context) (storagecommons.MetricsDB, error) {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return storagecommons.MetricsDB{}, err
+	}
+	ss, ok := s.(storagecommons.Snapshotter)
+	if !ok {
+		return storagecommons.MetricsDB{}, errors.New("storage does not support snapshots")
+	}
+	return ss.Snapshot(ctx)
+}
+
+func (ts *tenantStorage) Restore(ctx context.Context, mdb storagecommons.MetricsDB) error {
+	s, err := ts.storage(ctx)
+	if err != nil {
+		return err
+	}
+	ss, ok := s.(storagecommons.Snapshotter)
+	if !ok {
+		return errors.New("storage does not support snapshots")
+	}
+	return ss.Restore(ctx, mdb)
+}
+
+func (ts *tenantStorage) GetGauges() storagecommons.StoragerFloat64 {
+	return tenantSubstorage[float64]{ts: ts, get: func(s storagecommons.Storager) storagecommons.Substorager[float64] { return s.GetGauges() }}
+}
+
+func (ts *tenantStorage) GetCounters() storagecommons.StoragerInt64Sum {
+	return tenantSubstorage[int64]{ts: ts, get: func(s storagecommons.Storager) storagecommons.Substorager[int64] { return s.GetCounters() }}
+}
+
+func (ts *tenantStorage) GetHistograms() storagecommons.StoragerHistogram {
+	return tenantSubstorage[storagecommons.Histogram]{ts: ts, get: func(s storagecommons.Storager) storagecommons.Substorager[storagecommons.Histogram] {
+		return s.GetHistograms()
+	}}
+}
+
+func (ts *tenantStorage) GetSummaries() storagecommons.StoragerSummary {
+	return tenantSubstorage[storagecommons.Summary]{ts: ts, get: func(s storagecommons.Storager) storagecommons.Substorager[storagecommons.Summary] {
+		return s.GetSummaries()
+	}}
+}
+
+// Substorager routing each call to substorage of tenant the call context is scoped to
+type tenantSubstorage[T any] struct {
+	ts  *tenantStorage
+	get func(s storagecommons.Storager) storagecommons.Substorager[T]
+}
+
+func (tss tenantSubstorage[T]) ReadData(ctx context.Context, keys ...string) (map[string]T, error) {
+	s, err := tss.ts.storage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tss.get(s).ReadData(ctx, keys...)
+}
+
+func (tss tenantSubstorage[T]) WriteData(ctx context.Context, key string, value string) error {
+	s, err := tss.ts.storage(ctx)
+	if err != nil {
+		return err
+	}
+	return tss.get(s).WriteData(ctx, key, value)
+}
+
+func (tss tenantSubstorage[T]) WriteDataPP(ctx context.Context, key string, value T) error {
+	s, err := tss.ts.storage(ctx)
+	if err != nil {
+		return err
+	}
+	return tss.get(s).WriteDataPP(ctx, key, value)
+}
+
+func (tss tenantSubstorage[T]) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	s, err := tss.ts.storage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tss.get(s).ReadRange(ctx, key, from, to)
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+	"yaprakticum-go-track2/internal/testhelpers"
+)
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	db, err := InitStorage(ctx, config.ServerConfig{FileStoragePath: fileName, StoreInterval: 300, SnapshotsKeep: 1},
+		testhelpers.GetCustomZap(zap.ErrorLevel))
+	assert.NoError(t, err)
+	defer db.Close(ctx)
+
+	ctxA := storagecommons.WithTenant(ctx, "team_a")
+	ctxB := storagecommons.WithTenant(ctx, "team_b")
+
+	var d1, d2 int64 = 1, 10
+	_, err = db.WriteData(ctxA, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d1})
+	assert.NoError(t, err)
+	_, err = db.WriteData(ctxB, storagecommons.Metrics{ID: "c", MType: "counter", Delta: &d2})
+	assert.NoError(t, err)
+
+	t.Run("Data Isolated", func(t *testing.T) {
+		ctr, err := db.GetCounters().ReadData(ctxA)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int64{"c": 1}, ctr)
+
+		ctr, err = db.GetCounters().ReadData(ctxB)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int64{"c": 10}, ctr)
+
+		ctr, err = db.GetCounters().ReadData(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, ctr)
+	})
+
+	t.Run("Separate Dump Files", func(t *testing.T) {
+		assert.NoError(t, db.Dump(ctx))
+		for _, tenant := range []string{"team_a", "team_b"} {
+			_, err := os.Stat(storagecommons.TenantFileName(fileName, tenant))
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("Series Counted By Tenant", func(t *testing.T) {
+		counts := db.tenants.seriesCount()
+		assert.Equal(t, 1, counts[[2]string{"team_a", "counter"}])
+		assert.Equal(t, 1, counts[[2]string{"team_b", "counter"}])
+		assert.Equal(t, 0, counts[[2]string{"team_a", "gauge"}])
+		assert.Equal(t, 0, counts[[2]string{storagecommons.DefaultTenant, "counter"}])
+	})
+
+	t.Run("Invalid Tenant Rejected", func(t *testing.T) {
+		_, err := db.GetCounters().ReadData(storagecommons.WithTenant(ctx, "../x"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid Label Name Rejected", func(t *testing.T) {
+		// Name would make series key of other labels
+		labels := map[string]string{`a="x",b`: "y"}
+		_, err := db.WriteData(ctxA, storagecommons.Metrics{ID: "l", MType: "counter", Delta: &d1, Labels: labels})
+		assert.Error(t, err)
+		err = db.WriteDataMulti(ctxA, storagecommons.MetricsDB{MetricsDB: []storagecommons.Metrics{
+			{ID: "l", MType: "counter", Delta: &d1, Labels: map[string]string{"host": "a"}},
+			{ID: "l", MType: "counter", Delta: &d1, Labels: map[string]string{"1st": "a"}},
+		}})
+		assert.Error(t, err)
+		ctr, _ := db.GetCounters().ReadData(ctxA)
+		assert.Equal(t, map[string]int64{"c": 1}, ctr)
+	})
+}
+
+func TestReplicasRequireSnapshots(t *testing.T) {
+	ctx := context.Background()
+	logger := testhelpers.GetCustomZap(zap.ErrorLevel)
+
+	_, err := InitStorage(ctx, config.ServerConfig{
+		ConnString: "bolt://" + filepath.Join(t.TempDir(), "metrics.db"),
+		Replicas:   []string{"127.0.0.1:1"},
+	}, logger)
+	assert.Error(t, err)
+
+	db, err := InitStorage(ctx, config.ServerConfig{Replicas: []string{"127.0.0.1:1"}}, logger)
+	if assert.NoError(t, err) {
+		db.Close(ctx)
+	}
+}
@@ -0,0 +1,198 @@
+package tieredstore
+
+import (
+	"slices"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Writes accepted by memory tier and not persisted yet, aggregated per series:
+// counter deltas are summed, gauges keep last value, histograms and summaries are merged.
+// Every write keeps its history sample. Sources of cumulative counters keep last written value
+type pendingWrites struct {
+	mu               sync.Mutex
+	data             map[string]storagecommons.Metrics
+	history          map[string]storagecommons.MetricHistory
+	sources          map[[2]string]storagecommons.CounterSource
+	histogramBuckets []float64
+	summaryAccuracy  float64
+}
+
+func newPendingWrites(histogramBuckets []float64, summaryAccuracy float64) *pendingWrites {
+	return &pendingWrites{
+		data:             make(map[string]storagecommons.Metrics),
+		history:          make(map[string]storagecommons.MetricHistory),
+		sources:          make(map[[2]string]storagecommons.CounterSource),
+		histogramBuckets: histogramBuckets,
+		summaryAccuracy:  summaryAccuracy,
+	}
+}
+
+func pendingKey(mtype string, key string) string {
+	return mtype + "/" + key
+}
+
+// Returns write with default histogram bounds (summary accuracy) set, as memory tier prepares it
+func (pw *pendingWrites) prepare(metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	var err error
+	switch metrics.MType {
+	case "histogram":
+		var h storagecommons.Histogram
+		h, err = storagecommons.PrepareHistogram(metrics.Histogram, pw.histogramBuckets)
+		metrics.Histogram = &h
+	case "summary":
+		var s storagecommons.Summary
+		s, err = storagecommons.PrepareSummary(metrics.Summary, pw.summaryAccuracy)
+		metrics.Summary = &s
+	}
+	return metrics, err
+}
+
+// Adds prepared write accepted by memory tier, `value` is sample of series value after write (see sampleValue).
+// Merge does not fail, as pending value of series is merged into memory tier one, which accepted the write.
+// Sample is timestamped under lock, so samples of later takes are never older than taken ones.
+// Last value of cumulative counter source `src` (nil for other writes) is recorded along with write increment,
+// so they are taken together
+func (pw *pendingWrites) add(metrics storagecommons.Metrics, value float64, src *storagecommons.CounterSource) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	var err error
+	k := pendingKey(metrics.MType, metrics.Key())
+	res := metrics
+	if cur, ok := pw.data[k]; ok {
+		res, err = mergeWrites(cur, metrics)
+		if err != nil {
+			return err
+		}
+	}
+	pw.data[k] = res
+	if src != nil {
+		pw.sources[[2]string{src.Key(), src.Source}] = *src
+	}
+
+	h, ok := pw.history[k]
+	if !ok {
+		h = storagecommons.MetricHistory{ID: metrics.ID, MType: metrics.MType, Labels: metrics.Labels}
+	}
+	h.Samples = append(h.Samples, storagecommons.Sample{Timestamp: time.Now(), Value: value})
+	pw.history[k] = h
+	return nil
+}
+
+// Returns samples of pending writes of series within [from, to]
+func (pw *pendingWrites) samples(mtype string, key string, from time.Time, to time.Time) []storagecommons.Sample {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return slices.Clone(storagecommons.SamplesInRange(pw.history[pendingKey(mtype, key)].Samples, from, to))
+}
+
+// Returns all pending writes and clears them
+func (pw *pendingWrites) take() storagecommons.MetricsDB {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	res := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0, len(pw.data))}
+	for _, v := range pw.data {
+		res.MetricsDB = append(res.MetricsDB, v)
+	}
+	for _, v := range pw.history {
+		res.History = append(res.History, v)
+	}
+	for _, v := range pw.sources {
+		res.Sources = append(res.Sources, v)
+	}
+	pw.data = make(map[string]storagecommons.Metrics)
+	pw.history = make(map[string]storagecommons.MetricHistory)
+	pw.sources = make(map[[2]string]storagecommons.CounterSource)
+	return res
+}
+
+// Returns writes taken but failed to persist, they are merged before ones added since
+func (pw *pendingWrites) requeue(mdb storagecommons.MetricsDB) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	for _, v := range mdb.MetricsDB {
+		k := pendingKey(v.MType, v.Key())
+		cur, ok := pw.data[k]
+		if !ok {
+			pw.data[k] = v
+			continue
+		}
+		res, err := mergeWrites(v, cur)
+		if err == nil {
+			pw.data[k] = res
+		}
+	}
+	for _, v := range mdb.History {
+		k := pendingKey(v.MType, storagecommons.SeriesKey(v.ID, v.Labels))
+		v.Samples = append(slices.Clip(v.Samples), pw.history[k].Samples...)
+		pw.history[k] = v
+	}
+	for _, v := range mdb.Sources {
+		k := [2]string{v.Key(), v.Source}
+		if _, ok := pw.sources[k]; !ok {
+			pw.sources[k] = v
+		}
+	}
+}
+
+// Drops pending writes of series
+func (pw *pendingWrites) drop(mtype string, key string) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	delete(pw.data, pendingKey(mtype, key))
+	delete(pw.history, pendingKey(mtype, key))
+	if mtype != "counter" {
+		return
+	}
+	for k := range pw.sources {
+		if k[0] == key {
+			delete(pw.sources, k)
+		}
+	}
+}
+
+// Returns result of `older` write followed by `newer` one of the same series
+func mergeWrites(older storagecommons.Metrics, newer storagecommons.Metrics) (storagecommons.Metrics, error) {
+	res := newer
+	if res.TTL == nil {
+		res.TTL = older.TTL
+	}
+	if res.Unit == "" {
+		res.Unit = older.Unit
+	}
+	if res.Help == "" {
+		res.Help = older.Help
+	}
+
+	switch newer.MType {
+	case "counter":
+		delta := *older.Delta + *newer.Delta
+		res.Delta = &delta
+	case "histogram":
+		h := storagecommons.NewHistogram(older.Histogram.Bounds)
+		err := h.Merge(*older.Histogram)
+		if err == nil {
+			err = h.Merge(*newer.Histogram)
+		}
+		if err != nil {
+			return older, err
+		}
+		res.Histogram = &h
+	case "summary":
+		s := storagecommons.NewSummary(older.Summary.Alpha)
+		err := s.Merge(*older.Summary)
+		if err == nil {
+			err = s.Merge(*newer.Summary)
+		}
+		if err != nil {
+			return older, err
+		}
+		res.Summary = &s
+	}
+
+	return res, nil
+}
@@ -0,0 +1,122 @@
+package tieredstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+func TestPendingWrites(t *testing.T) {
+	pw := newPendingWrites([]float64{1, 10}, 0.01)
+
+	counter := func(delta int64) storagecommons.Metrics {
+		return storagecommons.Metrics{ID: "c", MType: "counter", Delta: &delta}
+	}
+	gauge := func(value float64) storagecommons.Metrics {
+		return storagecommons.Metrics{ID: "g", MType: "gauge", Value: &value}
+	}
+	histogram := func(counts ...int64) storagecommons.Metrics {
+		m, err := pw.prepare(storagecommons.Metrics{ID: "h", MType: "histogram", Histogram: &storagecommons.Histogram{Counts: counts, Count: 1}})
+		assert.NoError(t, err)
+		return m
+	}
+
+	byKey := func(mdb storagecommons.MetricsDB) map[string]storagecommons.Metrics {
+		res := make(map[string]storagecommons.Metrics)
+		for _, v := range mdb.MetricsDB {
+			res[v.MType+"/"+v.Key()] = v
+		}
+		return res
+	}
+
+	t.Run("Aggregated", func(t *testing.T) {
+		assert.NoError(t, pw.add(counter(1), 1, nil))
+		assert.NoError(t, pw.add(counter(2), 2, nil))
+		assert.NoError(t, pw.add(gauge(1), 1, nil))
+		assert.NoError(t, pw.add(gauge(5), 5, nil))
+		assert.NoError(t, pw.add(histogram(1, 0, 0), 1, nil))
+		assert.NoError(t, pw.add(histogram(0, 1, 0), 1, nil))
+
+		data := byKey(pw.take())
+		assert.Len(t, data, 3)
+		assert.Equal(t, int64(3), *data["counter/c"].Delta)
+		assert.Equal(t, 5.0, *data["gauge/g"].Value)
+		assert.Equal(t, []int64{1, 1, 0}, data["histogram/h"].Histogram.Counts)
+		assert.Equal(t, []float64{1, 10}, data["histogram/h"].Histogram.Bounds)
+
+		assert.Empty(t, pw.take().MetricsDB)
+	})
+
+	t.Run("Invalid Write Rejected Before Memory Tier", func(t *testing.T) {
+		_, err := pw.prepare(storagecommons.Metrics{ID: "h", MType: "histogram"})
+		assert.Error(t, err)
+		_, err = pw.prepare(storagecommons.Metrics{ID: "h", MType: "histogram", Histogram: &storagecommons.Histogram{Counts: []int64{1}, Count: 1}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Requeued Before Newer", func(t *testing.T) {
+		assert.NoError(t, pw.add(counter(1), 1, nil))
+		assert.NoError(t, pw.add(gauge(1), 1, nil))
+		failed := pw.take()
+
+		assert.NoError(t, pw.add(counter(10), 10, nil))
+		assert.NoError(t, pw.add(gauge(2), 2, nil))
+		pw.requeue(failed)
+
+		data := byKey(pw.take())
+		assert.Equal(t, int64(11), *data["counter/c"].Delta)
+		assert.Equal(t, 2.0, *data["gauge/g"].Value)
+	})
+
+	t.Run("Samples Of Every Write", func(t *testing.T) {
+		from := time.Now()
+		assert.NoError(t, pw.add(gauge(1), 1, nil))
+		assert.NoError(t, pw.add(gauge(2), 2, nil))
+		failed := pw.take()
+		if assert.Len(t, failed.History, 1) {
+			assert.Equal(t, "g", failed.History[0].ID)
+			assert.Len(t, failed.History[0].Samples, 2)
+		}
+
+		assert.NoError(t, pw.add(gauge(3), 3, nil))
+		pw.requeue(failed)
+		values := make([]float64, 0)
+		for _, smp := range pw.samples("gauge", "g", from, time.Now()) {
+			values = append(values, smp.Value)
+		}
+		assert.Equal(t, []float64{1, 2, 3}, values)
+		assert.Empty(t, pw.samples("gauge", "g", time.Now(), time.Now()))
+
+		pw.drop("gauge", "g")
+		assert.Empty(t, pw.take().History)
+	})
+
+	t.Run("Dropped", func(t *testing.T) {
+		assert.NoError(t, pw.add(counter(1), 1, nil))
+		pw.drop("counter", "c")
+		assert.Empty(t, pw.take().MetricsDB)
+	})
+
+	t.Run("Sources", func(t *testing.T) {
+		source := func(value int64) *storagecommons.CounterSource {
+			return &storagecommons.CounterSource{ID: "c", Source: "a", Value: value}
+		}
+
+		assert.NoError(t, pw.add(counter(5), 5, source(5)))
+		failed := pw.take()
+		assert.Len(t, failed.Sources, 1)
+
+		assert.NoError(t, pw.add(counter(2), 12, source(7)))
+		pw.requeue(failed)
+		data := pw.take()
+		if assert.Len(t, data.Sources, 1) {
+			assert.Equal(t, int64(7), data.Sources[0].Value)
+		}
+		assert.Equal(t, int64(7), *byKey(data)["counter/c"].Delta)
+
+		assert.NoError(t, pw.add(counter(1), 13, source(1)))
+		pw.drop("counter", "c")
+		assert.Empty(t, pw.take().Sources)
+	})
+}
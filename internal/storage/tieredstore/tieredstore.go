@@ -0,0 +1,391 @@
+package tieredstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"time"
+	"yaprakticum-go-track2/internal/config"
+	"yaprakticum-go-track2/internal/prom"
+	"yaprakticum-go-track2/internal/storage/dbstore"
+	"yaprakticum-go-track2/internal/storage/filestore"
+	"yaprakticum-go-track2/internal/storage/storagecommons"
+)
+
+// Storage with in-memory hot tier in front of DB storage (see Storager).
+// Memory tier serves all reads and writes, accepted writes are persisted to DB by background flusher.
+// Memory tier is warmed from DB on start, history ranges are read from DB along with samples of pending writes.
+// Memory tier keeps no history, DB one is compacted by DB storage. Series are expired from both tiers by tiered store,
+// as memory tier knows their last update time before it is flushed
+type TieredStore struct {
+	hot           *filestore.FileStore
+	cold          *dbstore.DBStore
+	pending       *pendingWrites
+	flushMutex    sync.Mutex   // Keeps deletes from being overwritten by flush in progress
+	writeMutex    sync.RWMutex // Writers hold it shared, so delete does not interleave with memory tier write and its pending record
+	sourceMutex   sync.Mutex   // Cumulative writers hold it, so source values are recorded for DB in order memory tier observes them
+	flushInterval time.Duration
+	ttlInterval   time.Duration
+	logger        *zap.Logger
+}
+
+func New(ctx context.Context, args config.ServerConfig, logger *zap.Logger) (*TieredStore, error) {
+	var ms TieredStore
+
+	logger.Sugar().Infof("Creating tiered memory/database storage...")
+
+	coldArgs := args
+	coldArgs.BandwidthPriority = false
+	coldArgs.ReadCacheSize = 0
+	coldArgs.TTLCheckInterval = 0
+	cold, err := dbstore.New(ctx, coldArgs, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	hotArgs := args
+	hotArgs.FileStoragePath = ""
+	hotArgs.Restore = false
+	hotArgs.NoHistory = true
+	hotArgs.RetentionRaw, hotArgs.RetentionMinute, hotArgs.RetentionHour = 0, 0, 0
+	hotArgs.CompactionInterval = 0
+	hotArgs.TTLCheckInterval = 0
+	hot, err := filestore.New(ctx, hotArgs, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.hot = hot
+	ms.cold = cold
+	ms.pending = newPendingWrites(args.HistogramBuckets, args.SummaryAccuracy)
+	ms.flushInterval = args.TieredFlushInterval
+	ms.ttlInterval = args.TTLCheckInterval
+	ms.logger = logger
+
+	// Memory tier is always warmed, otherwise it would not hold values DB ones are updated from
+	err = ms.warm(ctx)
+	if err != nil {
+		logger.Sugar().Infof("Unable to warm memory tier from database: %s", err.Error())
+	}
+
+	if ms.flushInterval > 0 {
+		go ms.flushWorker(ctx)
+	}
+
+	if ms.ttlInterval > 0 {
+		go ms.expiryWorker(ctx)
+	}
+
+	return &ms, nil
+}
+
+// Replaces memory tier data with DB one
+func (ms *TieredStore) warm(ctx context.Context) error {
+	mdb := storagecommons.MetricsDB{MetricsDB: make([]storagecommons.Metrics, 0)}
+
+	gauges, err := ms.cold.GetGauges().ReadData(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range gauges {
+		v := v
+		mdb.MetricsDB = append(mdb.MetricsDB, seriesMetrics(k, "gauge", func(m *storagecommons.Metrics) { m.Value = &v }))
+	}
+
+	counters, err := ms.cold.GetCounters().ReadData(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range counters {
+		v := v
+		mdb.MetricsDB = append(mdb.MetricsDB, seriesMetrics(k, "counter", func(m *storagecommons.Metrics) { m.Delta = &v }))
+	}
+
+	histograms, err := ms.cold.GetHistograms().ReadData(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range histograms {
+		v := v
+		mdb.MetricsDB = append(mdb.MetricsDB, seriesMetrics(k, "histogram", func(m *storagecommons.Metrics) { m.Histogram = &v }))
+	}
+
+	summaries, err := ms.cold.GetSummaries().ReadData(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range summaries {
+		v := v
+		mdb.MetricsDB = append(mdb.MetricsDB, seriesMetrics(k, "summary", func(m *storagecommons.Metrics) { m.Summary = &v }))
+	}
+
+	mdb.Metadata, err = ms.cold.GetMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	mdb.Sources, err = ms.cold.GetCounterSources(ctx)
+	if err != nil {
+		return err
+	}
+
+	ms.logger.Sugar().Infof("Memory tier warmed with %d series", len(mdb.MetricsDB))
+	return ms.hot.Restore(ctx, mdb)
+}
+
+// Returns metric of series `key` with value set by `set`
+func seriesMetrics(key string, mtype string, set func(m *storagecommons.Metrics)) storagecommons.Metrics {
+	id, labels, _ := storagecommons.ParseSeriesKey(key)
+	m := storagecommons.Metrics{ID: id, MType: mtype, Labels: labels}
+	set(&m)
+	return m
+}
+
+// Persists pending writes to DB, failed ones are kept for next flush
+func (ms *TieredStore) Flush(ctx context.Context) error {
+	ms.flushMutex.Lock()
+	defer ms.flushMutex.Unlock()
+
+	mdb := ms.pending.take()
+	if len(mdb.MetricsDB) == 0 && len(mdb.Sources) == 0 {
+		return nil
+	}
+	start := time.Now()
+	err := ms.cold.WriteDataMulti(ctx, mdb)
+	prom.Storage().ObserveFlush("tiered", start, err)
+	if err != nil {
+		ms.pending.requeue(mdb)
+	}
+	return err
+}
+
+// Routine for periodic flush of memory tier writes
+func (ms *TieredStore) flushWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(ms.flushInterval)
+		err := ms.Flush(ctx)
+		if err != nil {
+			ms.logger.Sugar().Infof("Unable to flush memory tier: %s", err.Error())
+		}
+	}
+}
+
+// Persists pending writes
+func (ms *TieredStore) Dump(ctx context.Context) error {
+	return ms.Flush(ctx)
+}
+
+// Persists pending writes and reloads memory tier from DB
+func (ms *TieredStore) Load(ctx context.Context) error {
+	err := ms.Flush(ctx)
+	if err != nil {
+		return err
+	}
+	return ms.warm(ctx)
+}
+
+func (ms *TieredStore) Close(ctx context.Context) error {
+	return errors.Join(ms.Flush(ctx), ms.cold.Close(ctx), ms.hot.Close(ctx))
+}
+
+// Writes metrics one by one, as memory tier does
+func (ms *TieredStore) WriteDataMulti(ctx context.Context, metrics storagecommons.MetricsDB) error {
+	for _, record := range metrics.MetricsDB {
+		_, err := ms.WriteData(ctx, record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *TieredStore) WriteData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	ms.writeMutex.RLock()
+	defer ms.writeMutex.RUnlock()
+
+	// Otherwise older value of source observed first could be recorded last, so DB would double count it after restart
+	var src *storagecommons.CounterSource
+	if metrics.Cumulative {
+		ms.sourceMutex.Lock()
+		defer ms.sourceMutex.Unlock()
+		s := storagecommons.SourceOf(metrics)
+		src = &s
+	}
+
+	// Increment is computed by memory tier, DB gets it along with source last value
+	written, err := ms.hot.ResolveCumulative(metrics)
+	if err != nil {
+		return metrics, err
+	}
+	// Pending write is prepared first, so write accepted by memory tier is always recorded for DB
+	prepared, err := ms.pending.prepare(written)
+	if err != nil {
+		return metrics, err
+	}
+	res, err := ms.hot.WriteData(ctx, written)
+	if err != nil {
+		return res, err
+	}
+	return res, ms.pending.add(prepared, sampleValue(res), src)
+}
+
+// Returns value recorded to history for series value after write (histograms and summaries record observations count)
+func sampleValue(metrics storagecommons.Metrics) float64 {
+	switch metrics.MType {
+	case "gauge":
+		return *metrics.Value
+	case "counter":
+		return float64(*metrics.Delta)
+	case "histogram":
+		return float64(metrics.Histogram.Count)
+	case "summary":
+		return float64(metrics.Summary.Count)
+	}
+	return 0
+}
+
+func (ms *TieredStore) ReadData(ctx context.Context, metrics storagecommons.Metrics) (storagecommons.Metrics, error) {
+	return ms.hot.ReadData(ctx, metrics)
+}
+
+// Reads DB history followed by samples of writes not persisted yet.
+// Flush in progress is waited for, so its samples are read from one of tiers only
+func (ms *TieredStore) ReadRange(ctx context.Context, mtype string, id string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	ms.flushMutex.Lock()
+	defer ms.flushMutex.Unlock()
+
+	samples, err := ms.cold.ReadRange(ctx, mtype, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(samples, ms.pending.samples(mtype, id, from, to)...), nil
+}
+
+func (ms *TieredStore) Delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	ms.flushMutex.Lock()
+	defer ms.flushMutex.Unlock()
+	ms.writeMutex.Lock()
+	defer ms.writeMutex.Unlock()
+
+	return ms.delete(ctx, metrics)
+}
+
+// Deletes series from both tiers, flushMutex and writeMutex must be held by caller
+func (ms *TieredStore) delete(ctx context.Context, metrics storagecommons.Metrics) error {
+	ms.pending.drop(metrics.MType, metrics.Key())
+	err := ms.hot.Delete(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	// Series may be not flushed yet
+	err = ms.cold.Delete(ctx, metrics)
+	if err != nil && !errors.Is(err, storagecommons.ErrNotExists) {
+		return err
+	}
+	return nil
+}
+
+// Deletes series not updated within their TTL from both tiers
+func (ms *TieredStore) Expire(ctx context.Context) error {
+	ms.flushMutex.Lock()
+	defer ms.flushMutex.Unlock()
+	ms.writeMutex.Lock()
+	defer ms.writeMutex.Unlock()
+
+	errs := make([]error, 0)
+	for _, m := range ms.hot.Expired(ctx) {
+		errs = append(errs, ms.delete(ctx, m))
+	}
+	return errors.Join(errs...)
+}
+
+// Routine for periodic expired series removal
+func (ms *TieredStore) expiryWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(ms.ttlInterval)
+		err := ms.Expire(ctx)
+		if err != nil {
+			ms.logger.Sugar().Infof("Unable to expire series: %s", err.Error())
+		}
+	}
+}
+
+func (ms *TieredStore) GetGauges() storagecommons.StoragerFloat64 {
+	return tieredSubstorage[float64]{ms: ms, hot: ms.hot.GetGauges(), mtype: "gauge",
+		parse: func(value string) (float64, error) { return strconv.ParseFloat(value, 64) },
+		set:   func(m *storagecommons.Metrics, value float64) { m.Value = &value },
+	}
+}
+
+func (ms *TieredStore) GetCounters() storagecommons.StoragerInt64Sum {
+	return tieredSubstorage[int64]{ms: ms, hot: ms.hot.GetCounters(), mtype: "counter",
+		parse: func(value string) (int64, error) { return strconv.ParseInt(value, 10, 64) },
+		set:   func(m *storagecommons.Metrics, value int64) { m.Delta = &value },
+	}
+}
+
+func (ms *TieredStore) GetHistograms() storagecommons.StoragerHistogram {
+	return tieredSubstorage[storagecommons.Histogram]{ms: ms, hot: ms.hot.GetHistograms(), mtype: "histogram",
+		parse: parseJSON[storagecommons.Histogram],
+		set:   func(m *storagecommons.Metrics, value storagecommons.Histogram) { m.Histogram = &value },
+	}
+}
+
+func (ms *TieredStore) GetSummaries() storagecommons.StoragerSummary {
+	return tieredSubstorage[storagecommons.Summary]{ms: ms, hot: ms.hot.GetSummaries(), mtype: "summary",
+		parse: parseJSON[storagecommons.Summary],
+		set:   func(m *storagecommons.Metrics, value storagecommons.Summary) { m.Summary = &value },
+	}
+}
+
+func (ms *TieredStore) GetMetadata(ctx context.Context) ([]storagecommons.MetricMetadata, error) {
+	return ms.hot.GetMetadata(ctx)
+}
+
+// Returns number of series of memory tier (it holds all series)
+func (ms *TieredStore) SeriesCount(ctx context.Context) (map[string]int, error) {
+	return ms.hot.SeriesCount(ctx)
+}
+
+func (ms *TieredStore) Ping(ctx context.Context) error {
+	return ms.cold.Ping(ctx)
+}
+
+func parseJSON[T any](value string) (T, error) {
+	var res T
+	err := json.Unmarshal([]byte(value), &res)
+	return res, err
+}
+
+// Substorager reading memory tier and writing through the tiered store (so writes are persisted)
+type tieredSubstorage[T any] struct {
+	ms    *TieredStore
+	hot   storagecommons.Substorager[T]
+	mtype string
+	parse func(value string) (T, error)
+	set   func(m *storagecommons.Metrics, value T)
+}
+
+func (tss tieredSubstorage[T]) ReadData(ctx context.Context, keys ...string) (map[string]T, error) {
+	return tss.hot.ReadData(ctx, keys...)
+}
+
+func (tss tieredSubstorage[T]) WriteData(ctx context.Context, key string, value string) error {
+	v, err := tss.parse(value)
+	if err != nil {
+		return err
+	}
+	return tss.WriteDataPP(ctx, key, v)
+}
+
+func (tss tieredSubstorage[T]) WriteDataPP(ctx context.Context, key string, value T) error {
+	_, err := tss.ms.WriteData(ctx, seriesMetrics(key, tss.mtype, func(m *storagecommons.Metrics) { tss.set(m, value) }))
+	return err
+}
+
+func (tss tieredSubstorage[T]) ReadRange(ctx context.Context, key string, from time.Time, to time.Time) ([]storagecommons.Sample, error) {
+	return tss.ms.ReadRange(ctx, tss.mtype, key, from, to)
+}
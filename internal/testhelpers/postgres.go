@@ -6,6 +6,7 @@ import (
 	"github.com/docker/docker/pkg/ioutils"
 	"log"
 	"sync/atomic"
+	"testing"
 	"time"
 
 	"github.com/testcontainers/testcontainers-go"
@@ -81,3 +82,22 @@ func (db *PostgresContainer) Close() error {
 func (db *PostgresContainer) Host() string {
 	return "localhost"
 }
+
+// Starts Postgres container for test and returns its connection string, container is terminated on test cleanup.
+// Test is skipped if Docker is not available
+func StartPostgres(t *testing.T) string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	postgres, err := NewPostgresContainer()
+	if err != nil {
+		t.Fatalf("unable to start Postgres container: %s", err)
+	}
+	t.Cleanup(func() { postgres.Close() })
+
+	connectionString, err := postgres.ConnectionString()
+	if err != nil {
+		t.Fatalf("unable to get Postgres connection string: %s", err)
+	}
+	return connectionString
+}